@@ -0,0 +1,306 @@
+// Copyright (c) 2020 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package blockwatch
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// AggFunc defines how multiple values of a column are combined into one.
+type AggFunc string
+
+const (
+	AggFirst        AggFunc = "first"
+	AggLast         AggFunc = "last"
+	AggMin          AggFunc = "min"
+	AggMax          AggFunc = "max"
+	AggSum          AggFunc = "sum"
+	AggMean         AggFunc = "mean"
+	AggCount        AggFunc = "count"
+	AggWeightedMean AggFunc = "wmean"    // mean weighted by AggRule.Weight
+	AggVwap         AggFunc = "vwap"     // volume weighted mean, weight defaults to vol_base
+	AggStd          AggFunc = "std"      // sample standard deviation (n-1), pooled when AggRule.Mean is set
+	AggDistinct     AggFunc = "distinct" // number of distinct non-null values
+	AggMedian       AggFunc = "median"
+)
+
+// AggQuantile returns the aggregation for the q-th quantile (0 <= q <= 1),
+// e.g. AggQuantile(0.95) is "q95".
+func AggQuantile(q float64) AggFunc {
+	return AggFunc("q" + strconv.FormatFloat(q*100, 'f', -1, 64))
+}
+
+// quantile returns the quantile of AggMedian and AggQuantile functions.
+func (f AggFunc) quantile() (float64, bool) {
+	if f == AggMedian {
+		return 0.5, true
+	}
+	if len(f) < 2 || f[0] != 'q' {
+		return 0, false
+	}
+	p, err := strconv.ParseFloat(string(f[1:]), 64)
+	if err != nil || p < 0 || p > 100 {
+		return 0, false
+	}
+	return p / 100, true
+}
+
+// AggRule describes how to aggregate a column. Source is the input column
+// and defaults to the output column name. Weight is the weight column for
+// weighted means and pooled standard deviations. Mean is the column that
+// holds per-row means when pooling standard deviations, e.g. for combining
+// OHLCV bars.
+type AggRule struct {
+	Func   AggFunc `json:"func"`
+	Source string  `json:"source,omitempty"`
+	Weight string  `json:"weight,omitempty"`
+	Mean   string  `json:"mean,omitempty"`
+}
+
+func (r AggRule) source(name string) string {
+	if r.Source != "" {
+		return r.Source
+	}
+	return name
+}
+
+func (r AggRule) weight() string {
+	if r.Weight == "" && r.Func == AggVwap {
+		return "vol_base"
+	}
+	return r.Weight
+}
+
+// resultType returns the column type of an aggregation result.
+func (r AggRule) resultType(typ FieldType) FieldType {
+	switch r.Func {
+	case AggCount, AggDistinct:
+		return FieldTypeInt64
+	case AggMean, AggWeightedMean, AggVwap, AggStd:
+		return FieldTypeFloat64
+	default:
+		if _, ok := r.Func.quantile(); ok {
+			return FieldTypeFloat64
+		}
+		return typ
+	}
+}
+
+// check returns an error when the aggregation is not supported on a column
+// type.
+func (r AggRule) check(typ FieldType) error {
+	fn := r.Func
+	if _, ok := fn.quantile(); ok {
+		fn = AggMedian
+	}
+	switch fn {
+	case AggFirst, AggLast, AggCount, AggDistinct:
+		return nil
+	case AggMin, AggMax:
+		if typ == FieldTypeBoolean || typ == FieldTypeBytes {
+			return fmt.Errorf("aggregation %s is unsupported on %s columns", r.Func, typ)
+		}
+		return nil
+	case AggSum, AggMean, AggWeightedMean, AggVwap, AggStd, AggMedian:
+		switch typ {
+		case FieldTypeInt64, FieldTypeUint64, FieldTypeFloat64:
+			return nil
+		default:
+			return fmt.Errorf("aggregation %s is unsupported on %s columns", r.Func, typ)
+		}
+	default:
+		return fmt.Errorf("unknown aggregation '%s'", r.Func)
+	}
+}
+
+// aggregate combines the values at positions idx into a single value. vals
+// contains decoded column values (nil for null), weights and means are the
+// decoded weight and mean columns or nil. Null values are skipped, nil is
+// returned when no value is left.
+func aggregate(fn AggFunc, typ FieldType, vals []interface{}, idx []int, weights, means []interface{}) interface{} {
+	switch fn {
+	case AggFirst:
+		for _, i := range idx {
+			if vals[i] != nil {
+				return vals[i]
+			}
+		}
+		return nil
+	case AggLast:
+		for k := len(idx) - 1; k >= 0; k-- {
+			if v := vals[idx[k]]; v != nil {
+				return v
+			}
+		}
+		return nil
+	case AggMin, AggMax:
+		var res interface{}
+		for _, i := range idx {
+			v := vals[i]
+			if v == nil {
+				continue
+			}
+			if f, ok := v.(float64); ok && math.IsNaN(f) {
+				continue
+			}
+			if res == nil {
+				res = v
+				continue
+			}
+			c := compareValues(typ, v, res)
+			if fn == AggMin && c < 0 || fn == AggMax && c > 0 {
+				res = v
+			}
+		}
+		return res
+	case AggCount:
+		var n int64
+		for _, i := range idx {
+			if vals[i] != nil {
+				n++
+			}
+		}
+		return n
+	case AggDistinct:
+		seen := make(map[string]struct{})
+		for _, i := range idx {
+			if vals[i] != nil {
+				seen[keyString(vals[i:i+1])] = struct{}{}
+			}
+		}
+		return int64(len(seen))
+	case AggSum:
+		var (
+			isum int64
+			usum uint64
+			fsum float64
+			n    int
+		)
+		for _, i := range idx {
+			switch v := vals[i].(type) {
+			case int64:
+				isum += v
+			case uint64:
+				usum += v
+			case float64:
+				if math.IsNaN(v) {
+					continue
+				}
+				fsum += v
+			default:
+				continue
+			}
+			n++
+		}
+		if n == 0 {
+			return nil
+		}
+		switch typ {
+		case FieldTypeInt64:
+			return isum
+		case FieldTypeUint64:
+			return usum
+		default:
+			return fsum
+		}
+	case AggMean:
+		var (
+			sum float64
+			n   int
+		)
+		for _, i := range idx {
+			if f, ok := toFloat64(vals[i]); ok && !math.IsNaN(f) {
+				sum += f
+				n++
+			}
+		}
+		if n == 0 {
+			return nil
+		}
+		return sum / float64(n)
+	case AggWeightedMean, AggVwap:
+		if weights == nil {
+			return aggregate(AggMean, typ, vals, idx, nil, nil)
+		}
+		var sum, wsum float64
+		for _, i := range idx {
+			f, ok := toFloat64(vals[i])
+			w, wok := toFloat64(weights[i])
+			if !ok || !wok || math.IsNaN(f) || math.IsNaN(w) {
+				continue
+			}
+			sum += f * w
+			wsum += w
+		}
+		if wsum == 0 {
+			return nil
+		}
+		return sum / wsum
+	case AggStd:
+		if weights != nil && means != nil {
+			return pooledStd(vals, idx, weights, means)
+		}
+		var sum, sum2 float64
+		var n int
+		for _, i := range idx {
+			if f, ok := toFloat64(vals[i]); ok && !math.IsNaN(f) {
+				sum += f
+				sum2 += f * f
+				n++
+			}
+		}
+		if n < 2 {
+			return nil
+		}
+		mean := sum / float64(n)
+		return math.Sqrt(math.Max(0, (sum2-float64(n)*mean*mean)/float64(n-1)))
+	default:
+		q, ok := fn.quantile()
+		if !ok {
+			return nil
+		}
+		buf := make([]float64, 0, len(idx))
+		for _, i := range idx {
+			if f, ok := toFloat64(vals[i]); ok && !math.IsNaN(f) {
+				buf = append(buf, f)
+			}
+		}
+		if len(buf) == 0 {
+			return nil
+		}
+		sort.Float64s(buf)
+		return quantileSorted(buf, q)
+	}
+}
+
+// pooledStd combines per-row sample standard deviations with per-row means
+// and sample counts into the sample standard deviation (n-1) of the union of
+// all samples, so pooled and raw rows use the same definition. Rows with a
+// single sample contribute their mean only.
+func pooledStd(stds []interface{}, idx []int, counts, means []interface{}) interface{} {
+	var n, sum, sum2 float64
+	for _, i := range idx {
+		s, sok := toFloat64(stds[i])
+		c, cok := toFloat64(counts[i])
+		m, mok := toFloat64(means[i])
+		if c == 1 && (!sok || math.IsNaN(s)) {
+			// the sample std of a single value is undefined
+			s, sok = 0, true
+		}
+		if !sok || !cok || !mok || c <= 0 || math.IsNaN(s) || math.IsNaN(m) {
+			continue
+		}
+		n += c
+		sum += c * m
+		sum2 += (c-1)*s*s + c*m*m
+	}
+	if n < 2 {
+		return nil
+	}
+	mean := sum / n
+	return math.Sqrt(math.Max(0, (sum2-n*mean*mean)/(n-1)))
+}
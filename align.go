@@ -0,0 +1,229 @@
+// Copyright (c) 2020 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package blockwatch
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// AlignMode defines which timestamps AlignSeries keeps.
+type AlignMode int
+
+const (
+	AlignOuter AlignMode = iota // keep timestamps present in any series
+	AlignInner                  // keep timestamps present in all series
+)
+
+func (m AlignMode) String() string {
+	switch m {
+	case AlignOuter:
+		return "outer"
+	case AlignInner:
+		return "inner"
+	default:
+		return "invalid"
+	}
+}
+
+// alignSource is a series prepared for alignment.
+type alignSource struct {
+	key    string
+	series *Series
+	tcol   int
+	times  []time.Time // sorted unique timestamps
+	rows   []int       // row position for each timestamp
+	rank   int         // collapse rank, zero without step
+	asof   bool
+}
+
+// lookup returns the row for time t or -1. As-of sources return the last row
+// at or before t as long as t is within the collapse bucket of that row.
+func (a *alignSource) lookup(t time.Time) int {
+	i := sort.Search(len(a.times), func(i int) bool { return a.times[i].After(t) }) - 1
+	if i < 0 {
+		return -1
+	}
+	if !a.asof {
+		if a.times[i].Equal(t) {
+			return a.rows[i]
+		}
+		return -1
+	}
+	if c := a.series.Collapse; c.HasStep() && !t.Before(c.Next(a.times[i])) {
+		return -1
+	}
+	return a.rows[i]
+}
+
+// AlignSeries joins multiple series on their timestamps into a single wide
+// dataframe. The result has a single time column followed by the columns of
+// all series in key order. Column codes are prefixed with the map key and an
+// underscore, column names with the map key and a space, column types are
+// preserved. An error is returned when two prefixed codes collide, e.g. key
+// "a_b" with column "c" and key "a" with column "b_c".
+//
+// The series with the finest collapse mode define the output timestamps. In
+// AlignOuter mode these are the union of their timestamps, missing values are
+// null. In AlignInner mode only timestamps present in all of them are kept.
+// Series with a coarser collapse mode are joined as-of: each output row gets
+// the last observation at or before its timestamp (last observation carried
+// forward), but values are never carried beyond the collapse bucket they
+// belong to. In AlignInner mode rows without such an observation are dropped.
+//
+// When a series contains duplicate timestamps the last row wins.
+func AlignSeries(series map[string]*Series, mode AlignMode) (*Dataframe, error) {
+	if len(series) == 0 {
+		return nil, fmt.Errorf("blockwatch: align requires at least one series")
+	}
+	keys := make([]string, 0, len(series))
+	for k := range series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	// prepare sources and find the finest collapse step
+	srcs := make([]*alignSource, len(keys))
+	fields := []Datafield{{Name: "Time", Code: "time", Type: FieldTypeDatetime}}
+	codes := map[string]string{"time": ""}
+	minRank := -1
+	for i, k := range keys {
+		s := series[k]
+		if s == nil {
+			return nil, fmt.Errorf("blockwatch: align series '%s' is nil", k)
+		}
+		times, idx, err := s.sortedTimes()
+		if err != nil {
+			return nil, fmt.Errorf("blockwatch: align series '%s': %v", k, err)
+		}
+		a := &alignSource{
+			key:    k,
+			series: s,
+			tcol:   s.TimeColumn(),
+			times:  make([]time.Time, 0, len(idx)),
+			rows:   make([]int, 0, len(idx)),
+		}
+		for _, r := range idx {
+			if n := len(a.times); n > 0 && a.times[n-1].Equal(times[r]) {
+				a.rows[n-1] = r
+				continue
+			}
+			a.times = append(a.times, times[r])
+			a.rows = append(a.rows, r)
+		}
+		a.rank = s.Collapse.rank()
+		if minRank < 0 || a.rank < minRank {
+			minRank = a.rank
+		}
+		for j, c := range s.Columns {
+			if j == a.tcol {
+				continue
+			}
+			name := c.Name
+			if name == "" {
+				name = c.Code
+			}
+			code := k + "_" + c.Code
+			if other, ok := codes[code]; ok {
+				return nil, fmt.Errorf("blockwatch: align column '%s' of series '%s' collides with series '%s'",
+					code, k, other)
+			}
+			codes[code] = k
+			fields = append(fields, Datafield{
+				Name: k + " " + name,
+				Code: code,
+				Type: c.Type,
+			})
+		}
+		srcs[i] = a
+	}
+
+	// build the time grid from the finest series
+	var grid []time.Time
+	nexact := 0
+	for _, a := range srcs {
+		a.asof = a.rank > minRank
+		if a.asof {
+			continue
+		}
+		nexact++
+		grid = mergeTimes(grid, a.times, mode == AlignInner && nexact > 1)
+	}
+
+	// join rows
+	out := NewDataframe(fields...)
+	row := make([]interface{}, len(fields))
+	pos := make([]int, len(srcs))
+	for _, t := range grid {
+		skip := false
+		for i, a := range srcs {
+			pos[i] = a.lookup(t)
+			if pos[i] < 0 && mode == AlignInner {
+				skip = true
+				break
+			}
+		}
+		if skip {
+			continue
+		}
+		row[0] = t
+		n := 1
+		for i, a := range srcs {
+			var vals []interface{}
+			if pos[i] >= 0 {
+				var err error
+				vals, err = a.series.RowValues(pos[i])
+				if err != nil {
+					return nil, err
+				}
+			}
+			for j := range a.series.Columns {
+				if j == a.tcol {
+					continue
+				}
+				if vals != nil {
+					row[n] = vals[j]
+				} else {
+					row[n] = nil
+				}
+				n++
+			}
+		}
+		if err := out.Append(row...); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// mergeTimes returns the sorted union or intersection of two sorted
+// timestamp lists.
+func mergeTimes(a, b []time.Time, intersect bool) []time.Time {
+	res := make([]time.Time, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i].Equal(b[j]):
+			res = append(res, a[i])
+			i++
+			j++
+		case a[i].Before(b[j]):
+			if !intersect {
+				res = append(res, a[i])
+			}
+			i++
+		default:
+			if !intersect {
+				res = append(res, b[j])
+			}
+			j++
+		}
+	}
+	if !intersect {
+		res = append(res, a[i:]...)
+		res = append(res, b[j:]...)
+	}
+	return res
+}
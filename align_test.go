@@ -0,0 +1,135 @@
+// Copyright (c) 2020 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package blockwatch
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAlignSeries(t *testing.T) {
+	m := time.Minute
+	a := newTestSeries(t, []Datafield{
+		{Code: "time", Type: FieldTypeDatetime},
+		{Name: "Value", Code: "value", Type: FieldTypeFloat64},
+	}, [][]interface{}{
+		{0 * m, 1.0},
+		{1 * m, 2.0},
+		{3 * m, 3.0},
+	})
+	a.Collapse = CollapseOneMinute
+	// unsorted with a duplicate timestamp
+	b := newTestSeries(t, []Datafield{
+		{Code: "time", Type: FieldTypeDatetime},
+		{Code: "n", Type: FieldTypeInt64},
+	}, [][]interface{}{
+		{2 * m, int64(20)},
+		{1 * m, int64(10)},
+		{2 * m, int64(21)},
+	})
+	b.Collapse = CollapseOneMinute
+	at := func(d time.Duration) time.Time { return resampleTime.Add(d) }
+
+	res, err := AlignSeries(map[string]*Series{"b": b, "a": a}, AlignOuter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Datafield{
+		{Name: "Time", Code: "time", Type: FieldTypeDatetime},
+		{Name: "a Value", Code: "a_value", Type: FieldTypeFloat64},
+		{Name: "b n", Code: "b_n", Type: FieldTypeInt64},
+	}
+	for i, f := range want {
+		if res.Columns[i] != f {
+			t.Errorf("column %d: got %+v, want %+v", i, res.Columns[i], f)
+		}
+	}
+	checkRows(t, res, [][]interface{}{
+		{at(0), 1.0, nil},
+		{at(m), 2.0, int64(10)},
+		{at(2 * m), nil, int64(21)},
+		{at(3 * m), 3.0, nil},
+	})
+
+	res, err = AlignSeries(map[string]*Series{"b": b, "a": a}, AlignInner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkRows(t, res, [][]interface{}{{at(m), 2.0, int64(10)}})
+}
+
+func TestAlignSeriesAsOf(t *testing.T) {
+	m, h := time.Minute, time.Hour
+	fine := newTestSeries(t, []Datafield{
+		{Code: "time", Type: FieldTypeDatetime},
+		{Code: "v", Type: FieldTypeFloat64},
+	}, [][]interface{}{
+		{0 * m, 1.0},
+		{30 * m, 2.0},
+		{90 * m, 3.0},
+		{150 * m, 4.0},
+	})
+	fine.Collapse = CollapseOneMinute
+	// hourly series without a row for the second hour
+	coarse := newTestSeries(t, []Datafield{
+		{Code: "time", Type: FieldTypeDatetime},
+		{Code: "v", Type: FieldTypeFloat64},
+	}, [][]interface{}{
+		{0 * h, 100.0},
+		{2 * h, 300.0},
+	})
+	coarse.Collapse = CollapseOneHour
+	at := func(d time.Duration) time.Time { return resampleTime.Add(d) }
+	series := map[string]*Series{"m": fine, "h": coarse}
+
+	res, err := AlignSeries(series, AlignOuter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// values are carried forward within their hour only
+	checkRows(t, res, [][]interface{}{
+		{at(0), 100.0, 1.0},
+		{at(30 * m), 100.0, 2.0},
+		{at(90 * m), nil, 3.0},
+		{at(150 * m), 300.0, 4.0},
+	})
+
+	res, err = AlignSeries(series, AlignInner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkRows(t, res, [][]interface{}{
+		{at(0), 100.0, 1.0},
+		{at(30 * m), 100.0, 2.0},
+		{at(150 * m), 300.0, 4.0},
+	})
+}
+
+func TestAlignSeriesErrors(t *testing.T) {
+	s := func(code string) *Series {
+		return newTestSeries(t, []Datafield{
+			{Code: "time", Type: FieldTypeDatetime},
+			{Code: code, Type: FieldTypeFloat64},
+		}, [][]interface{}{{time.Duration(0), 1.0}})
+	}
+	var tests = []struct {
+		series map[string]*Series
+		want   string
+	}{
+		{nil, "at least one series"},
+		{map[string]*Series{"a": nil}, "is nil"},
+		{map[string]*Series{"a_b": s("c"), "a": s("b_c")}, "'a_b_c' of series 'a_b' collides with series 'a'"},
+	}
+	for _, test := range tests {
+		_, err := AlignSeries(test.series, AlignOuter)
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("got error %v, want %q", err, test.want)
+		}
+	}
+	// codes that only look alike are fine
+	if _, err := AlignSeries(map[string]*Series{"a_b": s("c"), "a": s("b")}, AlignOuter); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,251 @@
+// Copyright (c) 2020 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+// Package arrow converts dataframes and paged query results into Apache
+// Arrow record batches and writes them in Arrow IPC stream and file format.
+//
+// Columns are named by their code and keep their type. The table below shows
+// how each field type maps to an Arrow type.
+//
+//	string    utf8
+//	bytes     binary
+//	date      date32
+//	datetime  timestamp[ms, tz=UTC]
+//	boolean   bool
+//	float64   float64
+//	int64     int64
+//	uint64    uint64
+//
+// All fields are nullable and null values are marked in the validity bitmap.
+// Column names are stored as field metadata with key "name".
+package arrow
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+
+	"blockwatch.cc/blockwatch-go"
+)
+
+// Schema returns the Arrow schema for dataframe columns.
+func Schema(cols []blockwatch.Datafield) (*arrow.Schema, error) {
+	fields := make([]arrow.Field, len(cols))
+	for i, c := range cols {
+		typ, err := DataType(c.Type)
+		if err != nil {
+			return nil, fmt.Errorf("arrow: column '%s': %v", c.Code, err)
+		}
+		fields[i] = arrow.Field{
+			Name:     c.Code,
+			Type:     typ,
+			Nullable: true,
+			Metadata: arrow.NewMetadata([]string{"name"}, []string{c.Name}),
+		}
+	}
+	return arrow.NewSchema(fields, nil), nil
+}
+
+// DataType returns the Arrow data type for a field type.
+func DataType(typ blockwatch.FieldType) (arrow.DataType, error) {
+	switch typ {
+	case blockwatch.FieldTypeString:
+		return arrow.BinaryTypes.String, nil
+	case blockwatch.FieldTypeBytes:
+		return arrow.BinaryTypes.Binary, nil
+	case blockwatch.FieldTypeDate:
+		return arrow.FixedWidthTypes.Date32, nil
+	case blockwatch.FieldTypeDatetime:
+		return &arrow.TimestampType{Unit: arrow.Millisecond, TimeZone: "UTC"}, nil
+	case blockwatch.FieldTypeBoolean:
+		return arrow.FixedWidthTypes.Boolean, nil
+	case blockwatch.FieldTypeFloat64:
+		return arrow.PrimitiveTypes.Float64, nil
+	case blockwatch.FieldTypeInt64:
+		return arrow.PrimitiveTypes.Int64, nil
+	case blockwatch.FieldTypeUint64:
+		return arrow.PrimitiveTypes.Uint64, nil
+	default:
+		return nil, fmt.Errorf("unsupported type %s", typ)
+	}
+}
+
+// ToArrow returns all rows of a dataframe as a single record batch. The
+// caller must release the record. ToArrow is not a Dataframe method because
+// the core package must not depend on Arrow.
+func ToArrow(t *blockwatch.Dataframe) (arrow.RecordBatch, error) {
+	schema, err := Schema(t.Columns)
+	if err != nil {
+		return nil, err
+	}
+	return NewRecord(memory.DefaultAllocator, schema, t)
+}
+
+// NewRecord copies all rows of a dataframe into a record batch with schema
+// allocated from mem. The schema must be created from the dataframe columns
+// with Schema. The caller must release the record.
+func NewRecord(mem memory.Allocator, schema *arrow.Schema, t *blockwatch.Dataframe) (arrow.RecordBatch, error) {
+	if schema.NumFields() != len(t.Columns) {
+		return nil, fmt.Errorf("arrow: schema has %d fields for %d columns", schema.NumFields(), len(t.Columns))
+	}
+	b := array.NewRecordBuilder(mem, schema)
+	defer b.Release()
+	for col := range t.Columns {
+		fb := b.Field(col)
+		fb.Reserve(len(t.Data))
+		for row := range t.Data {
+			if t.IsNullAt(col, row) {
+				fb.AppendNull()
+				continue
+			}
+			v, err := t.FieldAt(col, row)
+			if err != nil {
+				return nil, err
+			}
+			switch fb := fb.(type) {
+			case *array.StringBuilder:
+				fb.Append(v.(string))
+			case *array.BinaryBuilder:
+				fb.Append(v.([]byte))
+			case *array.Date32Builder:
+				fb.Append(arrow.Date32FromTime(v.(time.Time)))
+			case *array.TimestampBuilder:
+				fb.Append(arrow.Timestamp(v.(time.Time).UnixMilli()))
+			case *array.BooleanBuilder:
+				fb.Append(v.(bool))
+			case *array.Float64Builder:
+				fb.Append(v.(float64))
+			case *array.Int64Builder:
+				fb.Append(v.(int64))
+			case *array.Uint64Builder:
+				fb.Append(v.(uint64))
+			default:
+				return nil, fmt.Errorf("arrow: unsupported builder %T for column '%s'",
+					fb, t.Columns[col].Code)
+			}
+		}
+	}
+	return b.NewRecordBatch(), nil
+}
+
+// RecordReader emits one record batch per page of a frame iterator, e.g. a
+// TableIterator or SeriesIterator. It implements array.RecordReader. Pages
+// are fetched as the reader advances, so only the current page and record
+// are held in memory.
+type RecordReader struct {
+	refs   int64
+	it     blockwatch.FrameIterator
+	mem    memory.Allocator
+	schema *arrow.Schema
+	cols   []blockwatch.Datafield
+	next   *blockwatch.Dataframe
+	rec    arrow.RecordBatch
+	err    error
+}
+
+var _ array.RecordReader = (*RecordReader)(nil)
+
+// NewRecordReader creates a record reader on it. The first page is fetched
+// to determine the schema. All further pages must have the same columns.
+func NewRecordReader(it blockwatch.FrameIterator) (*RecordReader, error) {
+	if !it.Next() {
+		if err := it.Err(); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("arrow: iterator has no data")
+	}
+	t := it.Dataframe()
+	schema, err := Schema(t.Columns)
+	if err != nil {
+		return nil, err
+	}
+	return &RecordReader{
+		refs:   1,
+		it:     it,
+		mem:    memory.DefaultAllocator,
+		schema: schema,
+		cols:   append([]blockwatch.Datafield(nil), t.Columns...),
+		next:   t,
+	}, nil
+}
+
+// Retain increases the reference count by 1.
+func (r *RecordReader) Retain() {
+	atomic.AddInt64(&r.refs, 1)
+}
+
+// Release decreases the reference count by 1 and releases the current record
+// when the count drops to zero.
+func (r *RecordReader) Release() {
+	if atomic.AddInt64(&r.refs, -1) == 0 && r.rec != nil {
+		r.rec.Release()
+		r.rec = nil
+	}
+}
+
+// Schema returns the schema of all records.
+func (r *RecordReader) Schema() *arrow.Schema {
+	return r.schema
+}
+
+// Next advances to the next page and converts it into a record. It returns
+// false at the end of the iterator or on error.
+func (r *RecordReader) Next() bool {
+	if r.rec != nil {
+		r.rec.Release()
+		r.rec = nil
+	}
+	if r.err != nil {
+		return false
+	}
+	t := r.next
+	r.next = nil
+	if t == nil {
+		if !r.it.Next() {
+			r.err = r.it.Err()
+			return false
+		}
+		t = r.it.Dataframe()
+		if err := checkColumns(r.cols, t.Columns); err != nil {
+			r.err = err
+			return false
+		}
+	}
+	r.rec, r.err = NewRecord(r.mem, r.schema, t)
+	return r.err == nil
+}
+
+// RecordBatch returns the current record. It is valid until the next call to
+// Next, use Retain to keep it longer.
+func (r *RecordReader) RecordBatch() arrow.RecordBatch {
+	return r.rec
+}
+
+// Record returns the current record.
+//
+// Deprecated: Use RecordBatch instead.
+func (r *RecordReader) Record() arrow.RecordBatch {
+	return r.rec
+}
+
+// Err returns the first error that occured while reading pages.
+func (r *RecordReader) Err() error {
+	return r.err
+}
+
+func checkColumns(want, have []blockwatch.Datafield) error {
+	if len(have) != len(want) {
+		return fmt.Errorf("arrow: column count mismatch %d != %d", len(have), len(want))
+	}
+	for i, c := range have {
+		if c.Code != want[i].Code || c.Type != want[i].Type {
+			return fmt.Errorf("arrow: column %d mismatch %s(%s) != %s(%s)",
+				i, c.Code, c.Type, want[i].Code, want[i].Type)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,261 @@
+// Copyright (c) 2020 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package arrow
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/bitutil"
+
+	"blockwatch.cc/blockwatch-go"
+)
+
+// pages is a frame iterator over a fixed list of dataframes.
+type pages struct {
+	list []*blockwatch.Dataframe
+	n    int
+	err  error
+}
+
+func (p *pages) Next() bool {
+	if p.n >= len(p.list) {
+		return false
+	}
+	p.n++
+	return true
+}
+
+func (p *pages) Dataframe() *blockwatch.Dataframe {
+	return p.list[p.n-1]
+}
+
+func (p *pages) Err() error {
+	if p.n >= len(p.list) {
+		return p.err
+	}
+	return nil
+}
+
+var testColumns = []blockwatch.Datafield{
+	{Name: "Time", Code: "time", Type: blockwatch.FieldTypeDatetime},
+	{Name: "Day", Code: "day", Type: blockwatch.FieldTypeDate},
+	{Name: "Hash", Code: "hash", Type: blockwatch.FieldTypeBytes},
+	{Name: "Note", Code: "note", Type: blockwatch.FieldTypeString},
+	{Name: "Value", Code: "value", Type: blockwatch.FieldTypeFloat64},
+	{Name: "Count", Code: "count", Type: blockwatch.FieldTypeUint64},
+	{Name: "Delta", Code: "delta", Type: blockwatch.FieldTypeInt64},
+	{Name: "Flag", Code: "flag", Type: blockwatch.FieldTypeBoolean},
+}
+
+var testTime = time.Date(2020, 1, 2, 3, 4, 5, 6000000, time.UTC)
+
+// testPage returns a page of n rows starting at row offset. Every third row
+// is null in all columns except time.
+func testPage(t *testing.T, offset, n int) *blockwatch.Dataframe {
+	df := blockwatch.NewDataframe(testColumns...)
+	for i := offset; i < offset+n; i++ {
+		ts := testTime.Add(time.Duration(i) * time.Hour)
+		var err error
+		if i%3 == 2 {
+			err = df.Append(ts, nil, nil, nil, nil, nil, nil, nil)
+		} else {
+			err = df.Append(
+				ts,
+				ts.Truncate(24*time.Hour),
+				[]byte{byte(i), 0xab},
+				"note,"+string(rune('a'+i%26)),
+				float64(i)+0.5,
+				1<<63+uint64(i),
+				int64(-i),
+				i%2 == 0,
+			)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return df
+}
+
+// checkRecord compares a record with the dataframe it was created from.
+func checkRecord(t *testing.T, rec arrow.RecordBatch, want *blockwatch.Dataframe) {
+	t.Helper()
+	if rec.NumRows() != int64(len(want.Data)) || rec.NumCols() != int64(len(want.Columns)) {
+		t.Fatalf("got %d rows and %d columns, want %d and %d", rec.NumRows(), rec.NumCols(), len(want.Data), len(want.Columns))
+	}
+	for col, c := range want.Columns {
+		f := rec.Schema().Field(col)
+		if v, _ := f.Metadata.GetValue("name"); f.Name != c.Code || v != c.Name || !f.Nullable {
+			t.Errorf("column %d: got field %s name %q, want %s %q", col, f.Name, v, c.Code, c.Name)
+		}
+		arr := rec.Column(col)
+		var nulls int
+		for row := range want.Data {
+			if want.IsNullAt(col, row) {
+				nulls++
+			}
+		}
+		if arr.NullN() != nulls {
+			t.Errorf("column %d: got %d nulls, want %d", col, arr.NullN(), nulls)
+		}
+		// all valid arrays may omit the bitmap
+		bm := arr.NullBitmapBytes()
+		if nulls > 0 && bm == nil {
+			t.Errorf("column %d: missing validity bitmap", col)
+			continue
+		}
+		for row := range want.Data {
+			if bm != nil && bitutil.BitIsSet(bm, arr.Data().Offset()+row) == want.IsNullAt(col, row) {
+				t.Errorf("row %d column %d: wrong validity bit", row, col)
+			}
+			checkValue(t, arr, row, want, col)
+		}
+	}
+}
+
+func checkValue(t *testing.T, arr arrow.Array, row int, want *blockwatch.Dataframe, col int) {
+	t.Helper()
+	if want.IsNullAt(col, row) {
+		if !arr.IsNull(row) {
+			t.Errorf("row %d column %d: got %s, want null", row, col, arr.ValueStr(row))
+		}
+		return
+	}
+	if arr.IsNull(row) {
+		t.Errorf("row %d column %d: got null", row, col)
+		return
+	}
+	v, err := want.FieldAt(col, row)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ok bool
+	switch a := arr.(type) {
+	case *array.Timestamp:
+		ok = a.Value(row).ToTime(arrow.Millisecond).Equal(v.(time.Time))
+	case *array.Date32:
+		ok = a.Value(row).ToTime().Equal(v.(time.Time))
+	case *array.Binary:
+		ok = bytes.Equal(a.Value(row), v.([]byte))
+	case *array.String:
+		ok = a.Value(row) == v.(string)
+	case *array.Float64:
+		ok = a.Value(row) == v.(float64)
+	case *array.Uint64:
+		ok = a.Value(row) == v.(uint64)
+	case *array.Int64:
+		ok = a.Value(row) == v.(int64)
+	case *array.Boolean:
+		ok = a.Value(row) == v.(bool)
+	default:
+		t.Fatalf("column %d: unexpected array type %T", col, arr)
+	}
+	if !ok {
+		t.Errorf("row %d column %d: got %s, want %v", row, col, arr.ValueStr(row), v)
+	}
+}
+
+func TestSchema(t *testing.T) {
+	schema, err := Schema(testColumns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []arrow.DataType{
+		&arrow.TimestampType{Unit: arrow.Millisecond, TimeZone: "UTC"},
+		arrow.FixedWidthTypes.Date32,
+		arrow.BinaryTypes.Binary,
+		arrow.BinaryTypes.String,
+		arrow.PrimitiveTypes.Float64,
+		arrow.PrimitiveTypes.Uint64,
+		arrow.PrimitiveTypes.Int64,
+		arrow.FixedWidthTypes.Boolean,
+	}
+	for i, typ := range want {
+		if f := schema.Field(i); !arrow.TypeEqual(f.Type, typ) {
+			t.Errorf("column %d: got type %s, want %s", i, f.Type, typ)
+		}
+	}
+	if _, err := Schema([]blockwatch.Datafield{{Code: "x"}}); err == nil {
+		t.Error("expected unsupported type error")
+	}
+}
+
+func TestToArrow(t *testing.T) {
+	for _, n := range []int{0, 1, 9} {
+		df := testPage(t, 0, n)
+		rec, err := ToArrow(df)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkRecord(t, rec, df)
+		rec.Release()
+	}
+}
+
+func TestRecordReader(t *testing.T) {
+	list := []*blockwatch.Dataframe{
+		testPage(t, 0, 7),
+		testPage(t, 7, 0),
+		testPage(t, 7, 7),
+		testPage(t, 14, 3),
+	}
+	r, err := NewRecordReader(&pages{list: list})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Release()
+	// one record per page, including empty pages
+	var n int
+	for r.Next() {
+		if n >= len(list) {
+			t.Fatalf("got more than %d records", len(list))
+		}
+		if !r.RecordBatch().Schema().Equal(r.Schema()) {
+			t.Errorf("record %d: schema mismatch", n)
+		}
+		checkRecord(t, r.RecordBatch(), list[n])
+		n++
+	}
+	if err := r.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if n != len(list) {
+		t.Errorf("got %d records, want %d", n, len(list))
+	}
+
+	// page errors stop the reader
+	sel, err := testPage(t, 2, 2).Select("time")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err = NewRecordReader(&pages{list: []*blockwatch.Dataframe{testPage(t, 0, 2), sel}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Release()
+	if !r.Next() || r.Next() || r.Err() == nil {
+		t.Errorf("got error %v, want column mismatch", r.Err())
+	}
+	fail := errors.New("fail")
+	r, err = NewRecordReader(&pages{list: []*blockwatch.Dataframe{testPage(t, 0, 2)}, err: fail})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Release()
+	if !r.Next() || r.Next() || r.Err() != fail {
+		t.Errorf("got error %v, want %v", r.Err(), fail)
+	}
+
+	if _, err := NewRecordReader(&pages{}); err == nil {
+		t.Error("expected error without pages")
+	}
+	if _, err := NewRecordReader(&pages{err: fail}); err != fail {
+		t.Errorf("got error %v, want %v", err, fail)
+	}
+}
@@ -0,0 +1,159 @@
+// Copyright (c) 2020 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package arrow
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/ipc"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+
+	"blockwatch.cc/blockwatch-go"
+)
+
+// Format selects the Arrow IPC format.
+type Format int
+
+const (
+	FormatStream Format = iota // IPC streaming format
+	FormatFile                 // IPC file format with footer for random access
+)
+
+func (f Format) String() string {
+	switch f {
+	case FormatStream:
+		return "stream"
+	case FormatFile:
+		return "file"
+	default:
+		return "invalid"
+	}
+}
+
+// ErrNoData is returned when a writer is closed before any dataframe was
+// written, e.g. for an iterator without pages. The schema is unknown in this
+// case, so nothing is written.
+var ErrNoData = errors.New("arrow: no data to write")
+
+// ipcWriter is implemented by ipc.Writer and ipc.FileWriter.
+type ipcWriter interface {
+	Write(rec arrow.RecordBatch) error
+	Close() error
+}
+
+// Writer writes dataframes as record batches in Arrow IPC format. The schema
+// is taken from the first dataframe, all further dataframes must have the
+// same columns, e.g. pages of the same query. Each dataframe is written as
+// one record batch. Close must be called to finish the stream or file.
+type Writer struct {
+	w      io.Writer
+	format Format
+	iw     ipcWriter
+	schema *arrow.Schema
+	cols   []blockwatch.Datafield
+	rows   int
+	mem    memory.Allocator
+}
+
+// NewWriter creates an Arrow IPC writer on w. The writer does not close w.
+func NewWriter(w io.Writer, format Format) *Writer {
+	return &Writer{
+		w:      w,
+		format: format,
+		mem:    memory.DefaultAllocator,
+	}
+}
+
+// Rows returns the number of data rows written so far.
+func (w *Writer) Rows() int {
+	return w.rows
+}
+
+// Write writes all rows of a dataframe as one record batch and writes the
+// schema on first use.
+func (w *Writer) Write(t *blockwatch.Dataframe) error {
+	if w.iw == nil {
+		if err := w.open(t.Columns); err != nil {
+			return err
+		}
+	} else if err := checkColumns(w.cols, t.Columns); err != nil {
+		return err
+	}
+	rec, err := NewRecord(w.mem, w.schema, t)
+	if err != nil {
+		return err
+	}
+	defer rec.Release()
+	if err := w.iw.Write(rec); err != nil {
+		return fmt.Errorf("arrow: %v", err)
+	}
+	w.rows += len(t.Data)
+	return nil
+}
+
+// Close writes the end of stream marker or the file footer. It returns
+// ErrNoData when nothing was written.
+func (w *Writer) Close() error {
+	if w.iw == nil {
+		return ErrNoData
+	}
+	if err := w.iw.Close(); err != nil {
+		return fmt.Errorf("arrow: %v", err)
+	}
+	return nil
+}
+
+func (w *Writer) open(cols []blockwatch.Datafield) error {
+	schema, err := Schema(cols)
+	if err != nil {
+		return err
+	}
+	opts := []ipc.Option{ipc.WithSchema(schema), ipc.WithAllocator(w.mem)}
+	switch w.format {
+	case FormatStream:
+		w.iw = ipc.NewWriter(w.w, opts...)
+	case FormatFile:
+		fw, err := ipc.NewFileWriter(w.w, opts...)
+		if err != nil {
+			return fmt.Errorf("arrow: %v", err)
+		}
+		w.iw = fw
+	default:
+		return fmt.Errorf("arrow: invalid format %d", w.format)
+	}
+	w.schema = schema
+	w.cols = append([]blockwatch.Datafield(nil), cols...)
+	return nil
+}
+
+// Write writes the dataframe as a single record batch in Arrow IPC format
+// to w.
+func Write(w io.Writer, t *blockwatch.Dataframe, format Format) error {
+	aw := NewWriter(w, format)
+	if err := aw.Write(t); err != nil {
+		return err
+	}
+	return aw.Close()
+}
+
+// WriteStream writes all pages of an iterator in Arrow IPC format to w, one
+// record batch per page, and returns the number of rows written. Only the
+// current page is held in memory. Pages with a different column layout than
+// the first page are rejected. When the iterator has no pages, nothing is
+// written and ErrNoData is returned.
+func WriteStream(w io.Writer, it blockwatch.FrameIterator, format Format) (int, error) {
+	aw := NewWriter(w, format)
+	for it.Next() {
+		if err := aw.Write(it.Dataframe()); err != nil {
+			return aw.Rows(), err
+		}
+	}
+	if err := it.Err(); err != nil {
+		return aw.Rows(), err
+	}
+	return aw.Rows(), aw.Close()
+}
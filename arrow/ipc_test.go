@@ -0,0 +1,135 @@
+// Copyright (c) 2020 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package arrow
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/apache/arrow-go/v18/arrow/ipc"
+
+	"blockwatch.cc/blockwatch-go"
+)
+
+// readBatches reads all record batches of an IPC stream or file and compares
+// them with the pages they were written from.
+func readBatches(t *testing.T, data []byte, format Format, want []*blockwatch.Dataframe) {
+	t.Helper()
+	switch format {
+	case FormatStream:
+		r, err := ipc.NewReader(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Release()
+		var n int
+		for r.Next() {
+			if n >= len(want) {
+				t.Fatalf("got more than %d batches", len(want))
+			}
+			checkRecord(t, r.RecordBatch(), want[n])
+			n++
+		}
+		if err := r.Err(); err != nil {
+			t.Fatal(err)
+		}
+		if n != len(want) {
+			t.Errorf("got %d batches, want %d", n, len(want))
+		}
+	case FormatFile:
+		r, err := ipc.NewFileReader(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Close()
+		if r.NumRecords() != len(want) {
+			t.Fatalf("got %d batches, want %d", r.NumRecords(), len(want))
+		}
+		// batches can be read in any order
+		for i := len(want) - 1; i >= 0; i-- {
+			rec, err := r.RecordBatch(i)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkRecord(t, rec, want[i])
+		}
+	}
+}
+
+func TestWriteStream(t *testing.T) {
+	for _, format := range []Format{FormatStream, FormatFile} {
+		t.Run(format.String(), func(t *testing.T) {
+			list := []*blockwatch.Dataframe{
+				testPage(t, 0, 7),
+				testPage(t, 7, 0),
+				testPage(t, 7, 7),
+				testPage(t, 14, 3),
+			}
+			var buf bytes.Buffer
+			n, err := WriteStream(&buf, &pages{list: list}, format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != 17 {
+				t.Fatalf("wrote %d rows, want 17", n)
+			}
+			readBatches(t, buf.Bytes(), format, list)
+
+			buf.Reset()
+			df := testPage(t, 0, 5)
+			if err := Write(&buf, df, format); err != nil {
+				t.Fatal(err)
+			}
+			readBatches(t, buf.Bytes(), format, []*blockwatch.Dataframe{df})
+		})
+	}
+}
+
+func TestWriteEmpty(t *testing.T) {
+	// an iterator without pages has no schema
+	for _, format := range []Format{FormatStream, FormatFile} {
+		var buf bytes.Buffer
+		if n, err := WriteStream(&buf, &pages{}, format); err != ErrNoData || n != 0 {
+			t.Errorf("%s: got %d, %v, want ErrNoData", format, n, err)
+		}
+		if buf.Len() != 0 {
+			t.Errorf("%s: wrote %d bytes without data", format, buf.Len())
+		}
+	}
+	if err := NewWriter(&bytes.Buffer{}, FormatFile).Close(); err != ErrNoData {
+		t.Errorf("got error %v, want ErrNoData", err)
+	}
+}
+
+func TestWriteErrors(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf, FormatStream)
+	if err := w.Write(testPage(t, 0, 2)); err != nil {
+		t.Fatal(err)
+	}
+	sel, err := testPage(t, 0, 2).Select("time")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Write(sel); err == nil {
+		t.Error("expected column mismatch error")
+	}
+	if w.Rows() != 2 {
+		t.Errorf("got %d rows, want 2", w.Rows())
+	}
+	if err := Write(&buf, blockwatch.NewDataframe(blockwatch.Datafield{Code: "x"}), FormatStream); err == nil {
+		t.Error("expected unsupported type error")
+	}
+	if err := Write(&buf, testPage(t, 0, 1), Format(-1)); err == nil {
+		t.Error("expected invalid format error")
+	}
+
+	// iterator errors are returned with the rows written so far
+	fail := errors.New("fail")
+	n, err := WriteStream(&buf, &pages{list: []*blockwatch.Dataframe{testPage(t, 0, 3)}, err: fail}, FormatStream)
+	if err != fail || n != 3 {
+		t.Errorf("got %d, %v, want 3, %v", n, err, fail)
+	}
+}
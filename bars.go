@@ -0,0 +1,441 @@
+// Copyright (c) 2020 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package blockwatch
+
+import (
+	"math"
+	"time"
+)
+
+// BarFillMode defines how a BarBuilder handles intervals without trades.
+type BarFillMode int
+
+const (
+	BarFillNone     BarFillMode = iota // skip empty intervals
+	BarFillPrevious                    // emit zero-volume bars at the previous close
+	BarFillEmpty                       // emit bars with timestamp only and all values zero
+)
+
+// BarBuilder aggregates a stream of trades into OHLCV time bars. Bar
+// timestamps are set to the interval start, StartTime and EndTime hold the
+// times of the first and last trade. Trades must be added in time order.
+// Trades older than the current bar are merged into the current bar because
+// completed bars are never reopened.
+type BarBuilder struct {
+	window Window
+	loc    *time.Location
+	fill   BarFillMode
+
+	acc   barAccumulator
+	start time.Time // current bar start
+	end   time.Time // current bar end (exclusive)
+	last  float64   // last close price
+	init  bool      // at least one bar has been started
+}
+
+// NewBarBuilder returns a builder for time bars with buckets defined by w
+// (e.g. Interval(10*time.Second) or CollapseOneHour) in time zone loc.
+func NewBarBuilder(w Window, loc *time.Location, fill BarFillMode) *BarBuilder {
+	if loc == nil {
+		loc = time.UTC
+	}
+	return &BarBuilder{
+		window: w,
+		loc:    loc,
+		fill:   fill,
+	}
+}
+
+// Add adds a trade and returns all bars that were completed by it, including
+// filled empty bars.
+func (b *BarBuilder) Add(t Trade) []Ohlcv {
+	var bars []Ohlcv
+	if !b.init || !t.Timestamp.Before(b.end) {
+		bars = b.AdvanceTo(t.Timestamp)
+	}
+	b.acc.add(t)
+	b.last = t.Price
+	return bars
+}
+
+// AddMany adds multiple trades and returns all completed bars.
+func (b *BarBuilder) AddMany(trades []Trade) []Ohlcv {
+	bars := make([]Ohlcv, 0)
+	for _, t := range trades {
+		bars = append(bars, b.Add(t)...)
+	}
+	return bars
+}
+
+// AdvanceTo completes the current bar and all empty bars before now. Call it
+// from a clock when tailing a live trade stream to close bars in intervals
+// without trades.
+func (b *BarBuilder) AdvanceTo(now time.Time) []Ohlcv {
+	if !b.init {
+		b.open(now)
+		return nil
+	}
+	if now.Before(b.end) {
+		return nil
+	}
+	bars := make([]Ohlcv, 0, 1)
+	if bar, ok := b.finish(); ok {
+		bars = append(bars, bar)
+	}
+	if b.fill == BarFillNone {
+		b.open(now)
+		return bars
+	}
+	for {
+		b.open(b.end)
+		if now.Before(b.end) {
+			break
+		}
+		// the opened bar is empty and already complete
+		if bar, ok := b.finish(); ok {
+			bars = append(bars, bar)
+		}
+	}
+	return bars
+}
+
+// Current returns the incomplete bar that contains the most recent trades.
+// It returns false when the current bar has no trades.
+func (b *BarBuilder) Current() (Ohlcv, bool) {
+	if b.acc.n == 0 {
+		return Ohlcv{}, false
+	}
+	return b.acc.bar(b.start), true
+}
+
+// Flush completes and returns the current bar. It returns false when the
+// current bar has no trades and no fill is configured.
+func (b *BarBuilder) Flush() (Ohlcv, bool) {
+	if !b.init {
+		return Ohlcv{}, false
+	}
+	bar, ok := b.finish()
+	b.open(b.end)
+	return bar, ok
+}
+
+func (b *BarBuilder) open(t time.Time) {
+	b.start = b.window.Truncate(t, b.loc)
+	b.end = b.window.Next(b.start)
+	b.acc.reset()
+	b.init = true
+}
+
+// finish returns the current bar or a filled bar when it is empty.
+func (b *BarBuilder) finish() (Ohlcv, bool) {
+	if b.acc.n > 0 {
+		return b.acc.bar(b.start), true
+	}
+	switch b.fill {
+	case BarFillPrevious:
+		if b.last == 0 {
+			return Ohlcv{}, false
+		}
+		return Ohlcv{
+			Timestamp: b.start,
+			Open:      b.last,
+			High:      b.last,
+			Low:       b.last,
+			Close:     b.last,
+			Vwap:      b.last,
+			Mean:      b.last,
+		}, true
+	case BarFillEmpty:
+		return Ohlcv{Timestamp: b.start}, true
+	default:
+		return Ohlcv{}, false
+	}
+}
+
+// BuildBars aggregates time ordered trades into time bars. The last bar is
+// included even if its interval is not yet complete.
+func BuildBars(trades []Trade, w Window, loc *time.Location, fill BarFillMode) []Ohlcv {
+	b := NewBarBuilder(w, loc, fill)
+	bars := b.AddMany(trades)
+	if bar, ok := b.Flush(); ok {
+		bars = append(bars, bar)
+	}
+	return bars
+}
+
+// AddFrame decodes all rows of a trade table page into Trade and adds them.
+func (b *BarBuilder) AddFrame(t *Dataframe) ([]Ohlcv, error) {
+	return addTradeFrame(b, t)
+}
+
+// StreamBars consumes all pages from a trade table iterator and calls fn for
+// each completed bar. The last incomplete bar is flushed at the end.
+func (b *BarBuilder) StreamBars(it FrameIterator, fn func(Ohlcv) error) error {
+	return streamBars(b, it, fn)
+}
+
+// BarMeasure defines what a ThresholdBarBuilder counts towards its threshold.
+type BarMeasure int
+
+const (
+	BarMeasureTicks  BarMeasure = iota // number of trades
+	BarMeasureVolume                   // traded base volume
+	BarMeasureDollar                   // traded quote volume
+)
+
+func (m BarMeasure) String() string {
+	switch m {
+	case BarMeasureTicks:
+		return "ticks"
+	case BarMeasureVolume:
+		return "volume"
+	case BarMeasureDollar:
+		return "dollar"
+	default:
+		return "invalid"
+	}
+}
+
+func (m BarMeasure) of(t Trade) float64 {
+	switch m {
+	case BarMeasureVolume:
+		return t.Amount
+	case BarMeasureDollar:
+		return t.Price * t.Amount
+	default:
+		return 1
+	}
+}
+
+// ThresholdBarBuilder aggregates a stream of trades into bars that close once
+// a measure of trading activity reaches a threshold. Trades are never split,
+// so the trade that crosses the threshold is part of the closing bar.
+//
+// Regular bars sum the measure over all trades. Imbalance bars sum the
+// measure signed by trade side (buys positive, sells negative) and close when
+// the absolute imbalance reaches the threshold.
+//
+// Bar timestamps and StartTime are set to the time of the first trade,
+// EndTime is set to the time of the last trade.
+type ThresholdBarBuilder struct {
+	measure   BarMeasure
+	threshold float64
+	imbalance bool
+
+	acc barAccumulator
+	sum float64
+}
+
+// NewTickBarBuilder returns a builder for bars of n trades each.
+func NewTickBarBuilder(n int) *ThresholdBarBuilder {
+	return &ThresholdBarBuilder{measure: BarMeasureTicks, threshold: float64(n)}
+}
+
+// NewVolumeBarBuilder returns a builder for bars that close after vol base
+// units were traded.
+func NewVolumeBarBuilder(vol float64) *ThresholdBarBuilder {
+	return &ThresholdBarBuilder{measure: BarMeasureVolume, threshold: vol}
+}
+
+// NewDollarBarBuilder returns a builder for bars that close after vol quote
+// units were traded.
+func NewDollarBarBuilder(vol float64) *ThresholdBarBuilder {
+	return &ThresholdBarBuilder{measure: BarMeasureDollar, threshold: vol}
+}
+
+// NewImbalanceBarBuilder returns a builder for bars that close when the
+// absolute difference between buy and sell activity reaches threshold.
+func NewImbalanceBarBuilder(m BarMeasure, threshold float64) *ThresholdBarBuilder {
+	return &ThresholdBarBuilder{measure: m, threshold: threshold, imbalance: true}
+}
+
+// Add adds a trade and returns the bar that was completed by it, if any.
+func (b *ThresholdBarBuilder) Add(t Trade) []Ohlcv {
+	b.acc.add(t)
+	v := b.measure.of(t)
+	if b.imbalance && t.IsSell {
+		v = -v
+	}
+	b.sum += v
+	if math.Abs(b.sum) < b.threshold {
+		return nil
+	}
+	bar := b.acc.bar(b.acc.first)
+	b.acc.reset()
+	b.sum = 0
+	return []Ohlcv{bar}
+}
+
+// AddMany adds multiple trades and returns all completed bars.
+func (b *ThresholdBarBuilder) AddMany(trades []Trade) []Ohlcv {
+	bars := make([]Ohlcv, 0)
+	for _, t := range trades {
+		bars = append(bars, b.Add(t)...)
+	}
+	return bars
+}
+
+// Current returns the incomplete bar that contains the most recent trades.
+// It returns false when the current bar has no trades.
+func (b *ThresholdBarBuilder) Current() (Ohlcv, bool) {
+	if b.acc.n == 0 {
+		return Ohlcv{}, false
+	}
+	return b.acc.bar(b.acc.first), true
+}
+
+// Progress returns the accumulated measure of the current bar. For imbalance
+// bars the result is signed.
+func (b *ThresholdBarBuilder) Progress() float64 {
+	return b.sum
+}
+
+// Flush completes and returns the current bar even if it has not reached the
+// threshold. It returns false when the current bar has no trades.
+func (b *ThresholdBarBuilder) Flush() (Ohlcv, bool) {
+	bar, ok := b.Current()
+	b.acc.reset()
+	b.sum = 0
+	return bar, ok
+}
+
+// AddFrame decodes all rows of a trade table page into Trade and adds them.
+func (b *ThresholdBarBuilder) AddFrame(t *Dataframe) ([]Ohlcv, error) {
+	return addTradeFrame(b, t)
+}
+
+// StreamBars consumes all pages from a trade table iterator and calls fn for
+// each completed bar. The last incomplete bar is flushed at the end.
+func (b *ThresholdBarBuilder) StreamBars(it FrameIterator, fn func(Ohlcv) error) error {
+	return streamBars(b, it, fn)
+}
+
+// tradeAggregator is implemented by all bar builders.
+type tradeAggregator interface {
+	Add(Trade) []Ohlcv
+	Flush() (Ohlcv, bool)
+}
+
+func addTradeFrame(b tradeAggregator, t *Dataframe) ([]Ohlcv, error) {
+	bars := make([]Ohlcv, 0)
+	var trade Trade
+	err := t.ForEach(func(r Row) error {
+		trade = Trade{}
+		if err := r.Decode(&trade); err != nil {
+			return err
+		}
+		bars = append(bars, b.Add(trade)...)
+		return nil
+	})
+	return bars, err
+}
+
+func streamBars(b tradeAggregator, it FrameIterator, fn func(Ohlcv) error) error {
+	for it.Next() {
+		bars, err := addTradeFrame(b, it.Dataframe())
+		if err != nil {
+			return err
+		}
+		for _, v := range bars {
+			if err := fn(v); err != nil {
+				return err
+			}
+		}
+	}
+	if err := it.Err(); err != nil {
+		return err
+	}
+	if bar, ok := b.Flush(); ok {
+		return fn(bar)
+	}
+	return nil
+}
+
+// barAccumulator keeps running statistics for a single bar.
+type barAccumulator struct {
+	n         int64
+	open      float64
+	high      float64
+	low       float64
+	close     float64
+	sumPrice  float64
+	sumPrice2 float64
+	nBuy      int64
+	nSell     int64
+	volBase   float64
+	volQuote  float64
+	buyBase   float64
+	buyQuote  float64
+	sellBase  float64
+	sellQuote float64
+	first     time.Time
+	last      time.Time
+}
+
+func (a *barAccumulator) reset() {
+	*a = barAccumulator{}
+}
+
+func (a *barAccumulator) add(t Trade) {
+	if a.n == 0 {
+		a.open, a.high, a.low = t.Price, t.Price, t.Price
+		a.first = t.Timestamp
+	}
+	a.n++
+	a.close = t.Price
+	if t.Timestamp.After(a.last) {
+		a.last = t.Timestamp
+	}
+	a.high = math.Max(a.high, t.Price)
+	a.low = math.Min(a.low, t.Price)
+	a.sumPrice += t.Price
+	a.sumPrice2 += t.Price * t.Price
+	quote := t.Price * t.Amount
+	a.volBase += t.Amount
+	a.volQuote += quote
+	if t.IsSell {
+		a.nSell++
+		a.sellBase += t.Amount
+		a.sellQuote += quote
+	} else {
+		a.nBuy++
+		a.buyBase += t.Amount
+		a.buyQuote += quote
+	}
+}
+
+func (a *barAccumulator) bar(ts time.Time) Ohlcv {
+	bar := Ohlcv{
+		Timestamp:       ts,
+		Open:            a.open,
+		High:            a.high,
+		Low:             a.low,
+		Close:           a.close,
+		TradeCount:      a.n,
+		BuyCount:        a.nBuy,
+		SellCount:       a.nSell,
+		BaseVolume:      a.volBase,
+		QuoteVolume:     a.volQuote,
+		BaseVolumeBuy:   a.buyBase,
+		QuoteVolumeBuy:  a.buyQuote,
+		BaseVolumeSell:  a.sellBase,
+		QuoteVolumeSell: a.sellQuote,
+		StartTime:       a.first,
+		EndTime:         a.last,
+	}
+	if a.n > 0 {
+		n := float64(a.n)
+		bar.Mean = a.sumPrice / n
+		// sample standard deviation like AggStd, undefined for one trade
+		bar.Std = math.NaN()
+		if a.n > 1 {
+			bar.Std = math.Sqrt(math.Max(0, (a.sumPrice2-n*bar.Mean*bar.Mean)/(n-1)))
+		}
+		bar.Vwap = bar.Mean
+		if a.volBase != 0 {
+			bar.Vwap = a.volQuote / a.volBase
+		}
+	}
+	return bar
+}
@@ -0,0 +1,147 @@
+// Copyright (c) 2020 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package blockwatch
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func randTrades(n int) []Trade {
+	r := rand.New(rand.NewSource(1))
+	trades := make([]Trade, n)
+	ts := resampleTime
+	price := 100.0
+	for i := range trades {
+		ts = ts.Add(time.Duration(r.Intn(3000)) * time.Millisecond)
+		price += r.Float64() - 0.5
+		trades[i] = Trade{
+			ID:        int64(i),
+			Timestamp: ts,
+			Price:     price,
+			Amount:    r.Float64() * 2,
+			IsSell:    r.Intn(2) == 0,
+		}
+	}
+	return trades
+}
+
+// barFrame returns bars as OHLCV series with the API's column codes.
+func barFrame(t *testing.T, bars []Ohlcv) *Series {
+	t.Helper()
+	f := func(code string) Datafield { return Datafield{Code: code, Type: FieldTypeFloat64} }
+	i := func(code string) Datafield { return Datafield{Code: code, Type: FieldTypeInt64} }
+	df := NewDataframe(
+		Datafield{Code: "time", Type: FieldTypeDatetime},
+		f("open"), f("high"), f("low"), f("close"), f("vwap"), f("stddev"), f("mean"),
+		i("n_trades"), i("n_buy"), i("n_sell"),
+		f("vol_base"), f("vol_quote"), f("vol_buy_base"), f("vol_buy_quote"), f("vol_sell_base"), f("vol_sell_quote"),
+	)
+	for _, b := range bars {
+		err := df.Append(b.Timestamp, b.Open, b.High, b.Low, b.Close, b.Vwap, b.Std, b.Mean,
+			b.TradeCount, b.BuyCount, b.SellCount,
+			b.BaseVolume, b.QuoteVolume, b.BaseVolumeBuy, b.QuoteVolumeBuy, b.BaseVolumeSell, b.QuoteVolumeSell)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return &Series{Dataframe: *df, Order: OrderAsc}
+}
+
+func checkBar(t *testing.T, got, want Ohlcv) {
+	t.Helper()
+	near := func(a, b float64) bool {
+		return math.IsNaN(a) && math.IsNaN(b) || math.Abs(a-b) <= 1e-9*math.Max(1, math.Abs(b))
+	}
+	if !got.Timestamp.Equal(want.Timestamp) ||
+		!near(got.Open, want.Open) || !near(got.High, want.High) || !near(got.Low, want.Low) ||
+		!near(got.Close, want.Close) || !near(got.Vwap, want.Vwap) || !near(got.Mean, want.Mean) ||
+		!near(got.Std, want.Std) || got.TradeCount != want.TradeCount ||
+		got.BuyCount != want.BuyCount || got.SellCount != want.SellCount ||
+		!near(got.BaseVolume, want.BaseVolume) || !near(got.QuoteVolume, want.QuoteVolume) ||
+		!near(got.BaseVolumeBuy, want.BaseVolumeBuy) || !near(got.QuoteVolumeBuy, want.QuoteVolumeBuy) ||
+		!near(got.BaseVolumeSell, want.BaseVolumeSell) || !near(got.QuoteVolumeSell, want.QuoteVolumeSell) {
+		t.Errorf("got  %+v\nwant %+v", got, want)
+	}
+}
+
+func TestBarStd(t *testing.T) {
+	trades := []Trade{
+		{Timestamp: resampleTime, Price: 1, Amount: 1},
+		{Timestamp: resampleTime.Add(time.Second), Price: 2, Amount: 1},
+		{Timestamp: resampleTime.Add(2 * time.Second), Price: 4, Amount: 2, IsSell: true},
+		{Timestamp: resampleTime.Add(time.Minute), Price: 5, Amount: 1},
+	}
+	bars := BuildBars(trades, CollapseOneMinute, nil, BarFillNone)
+	if len(bars) != 2 {
+		t.Fatalf("got %d bars, want 2", len(bars))
+	}
+	checkBar(t, bars[0], Ohlcv{
+		Timestamp: resampleTime, Open: 1, High: 4, Low: 1, Close: 4,
+		Vwap: 11.0 / 4, Mean: 7.0 / 3, Std: math.Sqrt(7.0 / 3),
+		TradeCount: 3, BuyCount: 2, SellCount: 1,
+		BaseVolume: 4, QuoteVolume: 11, BaseVolumeBuy: 2, QuoteVolumeBuy: 3, BaseVolumeSell: 2, QuoteVolumeSell: 8,
+	})
+	if !math.IsNaN(bars[1].Std) {
+		t.Errorf("single trade bar: got std %v, want NaN", bars[1].Std)
+	}
+}
+
+func TestBarsMatchResample(t *testing.T) {
+	trades := randTrades(500)
+	want := BuildBars(trades, CollapseOneMinute, nil, BarFillNone)
+
+	// one second bars resampled to one minute give the same bars
+	fine := BuildBars(trades, Interval(time.Second), nil, BarFillNone)
+	res, err := barFrame(t, fine).Resample(CollapseOneMinute, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Data) != len(want) {
+		t.Fatalf("got %d resampled bars, want %d", len(res.Data), len(want))
+	}
+	for i := range want {
+		var got Ohlcv
+		if err := res.DecodeAt(i, &got); err != nil {
+			t.Fatal(err)
+		}
+		checkBar(t, got, Ohlcv{
+			Timestamp:       want[i].Timestamp,
+			Open:            want[i].Open,
+			High:            want[i].High,
+			Low:             want[i].Low,
+			Close:           want[i].Close,
+			Vwap:            want[i].Vwap,
+			Std:             want[i].Std,
+			Mean:            want[i].Mean,
+			TradeCount:      want[i].TradeCount,
+			BuyCount:        want[i].BuyCount,
+			SellCount:       want[i].SellCount,
+			BaseVolume:      want[i].BaseVolume,
+			QuoteVolume:     want[i].QuoteVolume,
+			BaseVolumeBuy:   want[i].BaseVolumeBuy,
+			QuoteVolumeBuy:  want[i].QuoteVolumeBuy,
+			BaseVolumeSell:  want[i].BaseVolumeSell,
+			QuoteVolumeSell: want[i].QuoteVolumeSell,
+		})
+	}
+
+	// streaming trades one at a time gives the same bars
+	b := NewBarBuilder(CollapseOneMinute, nil, BarFillNone)
+	var streamed []Ohlcv
+	for _, tr := range trades {
+		streamed = append(streamed, b.Add(tr)...)
+	}
+	if bar, ok := b.Flush(); ok {
+		streamed = append(streamed, bar)
+	}
+	if len(streamed) != len(want) {
+		t.Fatalf("streamed %d bars, want %d", len(streamed), len(want))
+	}
+	for i := range want {
+		checkBar(t, streamed[i], want[i])
+	}
+}
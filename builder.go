@@ -0,0 +1,315 @@
+// Copyright (c) 2020 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package blockwatch
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// NewDataframe creates an empty dataframe with the given column layout.
+// Rows are added with Append and stored in the same raw JSON format the API
+// uses, so all access functions work as on downloaded data.
+func NewDataframe(columns ...Datafield) *Dataframe {
+	cols := make([]Datafield, len(columns))
+	copy(cols, columns)
+	return &Dataframe{
+		Columns: cols,
+		Data:    make([]json.RawMessage, 0),
+	}
+}
+
+// Append encodes and adds a row. The number of values must match the number
+// of columns. Nil values and NaN or infinite floats are stored as null.
+func (t *Dataframe) Append(vals ...interface{}) error {
+	if len(vals) != len(t.Columns) {
+		return fmt.Errorf("blockwatch: append got %d values for %d columns", len(vals), len(t.Columns))
+	}
+	buf := make([]byte, 0, 16*len(vals))
+	buf = append(buf, '[')
+	var err error
+	for i, v := range vals {
+		if i > 0 {
+			buf = append(buf, ',')
+		}
+		buf, err = appendFieldValue(buf, t.Columns[i].Type, v)
+		if err != nil {
+			return makeColumnError(t.Columns[i].Code, i, len(t.Data), err)
+		}
+	}
+	buf = append(buf, ']')
+	t.Data = append(t.Data, json.RawMessage(buf))
+	return nil
+}
+
+// RowValues returns all values of a row as returned from FieldAt with nil
+// for null values.
+func (t *Dataframe) RowValues(row int) ([]interface{}, error) {
+	vals := make([]interface{}, len(t.Columns))
+	for i := range t.Columns {
+		if t.IsNullAt(i, row) {
+			continue
+		}
+		v, err := t.FieldAt(i, row)
+		if err != nil {
+			return nil, err
+		}
+		vals[i] = v
+	}
+	return vals, nil
+}
+
+// ColumnValues returns all values of a column as returned from FieldAt with
+// nil for null values.
+func (t *Dataframe) ColumnValues(name string) ([]interface{}, error) {
+	if err := t.initType(nil); err != nil {
+		return nil, err
+	}
+	col := t.columnIndex(name)
+	if col < 0 {
+		return nil, fmt.Errorf("blockwatch: missing column '%s'", name)
+	}
+	return t.columnValues(col)
+}
+
+func (t *Dataframe) columnValues(col int) ([]interface{}, error) {
+	vals := make([]interface{}, len(t.Data))
+	for i := range t.Data {
+		if t.IsNullAt(col, i) {
+			continue
+		}
+		v, err := t.FieldAt(col, i)
+		if err != nil {
+			return nil, err
+		}
+		vals[i] = v
+	}
+	return vals, nil
+}
+
+// AddColumn adds a new column or replaces an existing column with the same
+// code. vals must be a slice with one value per row, e.g. []float64 or
+// []interface{}. Rows are copied, so views that share row data with this
+// dataframe are not modified. On error the dataframe is left unchanged.
+func (t *Dataframe) AddColumn(field Datafield, vals interface{}) error {
+	if err := t.initType(nil); err != nil {
+		return err
+	}
+	rv := reflect.ValueOf(vals)
+	if rv.Kind() != reflect.Slice {
+		return fmt.Errorf("blockwatch: add column '%s': values must be a slice, got %T", field.Code, vals)
+	}
+	if rv.Len() != len(t.Data) {
+		return fmt.Errorf("blockwatch: add column '%s': got %d values for %d rows", field.Code, rv.Len(), len(t.Data))
+	}
+	col := t.columnIndex(field.Code)
+	pos := col
+	if pos < 0 {
+		pos = len(t.Columns)
+	}
+	data := make([]json.RawMessage, len(t.Data))
+	for i, row := range t.Data {
+		var cols [][]byte
+		if len(t.Columns) > 0 {
+			cols = splitColumns(row[1:len(row)-1], ',')
+		}
+		n := len(cols)
+		if col < 0 {
+			n++
+		}
+		buf := make([]byte, 0, len(row)+16)
+		buf = append(buf, '[')
+		for j := 0; j < n; j++ {
+			if j > 0 {
+				buf = append(buf, ',')
+			}
+			if j != pos {
+				buf = append(buf, bytes.TrimSpace(cols[j])...)
+				continue
+			}
+			var err error
+			buf, err = appendFieldValue(buf, field.Type, rv.Index(i).Interface())
+			if err != nil {
+				return makeColumnError(field.Code, pos, i, err)
+			}
+		}
+		buf = append(buf, ']')
+		data[i] = json.RawMessage(buf)
+	}
+	t.Data = data
+	if col >= 0 {
+		cols := make([]Datafield, len(t.Columns))
+		copy(cols, t.Columns)
+		cols[col] = field
+		t.Columns = cols
+	} else {
+		t.Columns = append(t.Columns[:len(t.Columns):len(t.Columns)], field)
+	}
+	t.ResetType()
+	return nil
+}
+
+func appendFieldValue(buf []byte, typ FieldType, v interface{}) ([]byte, error) {
+	if v == nil {
+		return append(buf, "null"...), nil
+	}
+	switch typ {
+	case FieldTypeString:
+		s, ok := v.(string)
+		if !ok {
+			if sv, ok := v.(fmt.Stringer); ok {
+				s = sv.String()
+			} else {
+				return nil, fmt.Errorf("cannot encode %T as %s", v, typ)
+			}
+		}
+		b, err := json.Marshal(s)
+		if err != nil {
+			return nil, err
+		}
+		return append(buf, b...), nil
+	case FieldTypeBytes:
+		b, ok := v.([]byte)
+		if !ok {
+			return nil, fmt.Errorf("cannot encode %T as %s", v, typ)
+		}
+		if b == nil {
+			return append(buf, "null"...), nil
+		}
+		buf = append(buf, '"')
+		buf = append(buf, hex.EncodeToString(b)...)
+		return append(buf, '"'), nil
+	case FieldTypeDate, FieldTypeDatetime:
+		tm, ok := v.(time.Time)
+		if !ok {
+			return nil, fmt.Errorf("cannot encode %T as %s", v, typ)
+		}
+		if tm.IsZero() {
+			return append(buf, "null"...), nil
+		}
+		return strconv.AppendInt(buf, tm.UnixNano()/1000000, 10), nil
+	case FieldTypeBoolean:
+		b, ok := v.(bool)
+		if !ok {
+			return nil, fmt.Errorf("cannot encode %T as %s", v, typ)
+		}
+		return strconv.AppendBool(buf, b), nil
+	case FieldTypeFloat64:
+		f, ok := toFloat64(v)
+		if !ok {
+			return nil, fmt.Errorf("cannot encode %T as %s", v, typ)
+		}
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return append(buf, "null"...), nil
+		}
+		return strconv.AppendFloat(buf, f, 'g', -1, 64), nil
+	case FieldTypeInt64:
+		i, ok := toInt64(v)
+		if !ok {
+			return nil, fmt.Errorf("cannot encode %T as %s", v, typ)
+		}
+		return strconv.AppendInt(buf, i, 10), nil
+	case FieldTypeUint64:
+		u, ok := toUint64(v)
+		if !ok {
+			return nil, fmt.Errorf("cannot encode %T as %s", v, typ)
+		}
+		return strconv.AppendUint(buf, u, 10), nil
+	default:
+		return nil, fmt.Errorf("unsupported column type %s", typ)
+	}
+}
+
+// toFloat64 converts any Go numeric value to float64.
+func toFloat64(v interface{}) (float64, bool) {
+	switch x := v.(type) {
+	case float64:
+		return x, true
+	case float32:
+		return float64(x), true
+	case int:
+		return float64(x), true
+	case int8:
+		return float64(x), true
+	case int16:
+		return float64(x), true
+	case int32:
+		return float64(x), true
+	case int64:
+		return float64(x), true
+	case uint:
+		return float64(x), true
+	case uint8:
+		return float64(x), true
+	case uint16:
+		return float64(x), true
+	case uint32:
+		return float64(x), true
+	case uint64:
+		return float64(x), true
+	default:
+		return 0, false
+	}
+}
+
+// toInt64 converts Go integer values and integral floats to int64.
+func toInt64(v interface{}) (int64, bool) {
+	switch x := v.(type) {
+	case int:
+		return int64(x), true
+	case int8:
+		return int64(x), true
+	case int16:
+		return int64(x), true
+	case int32:
+		return int64(x), true
+	case int64:
+		return x, true
+	case uint:
+		return int64(x), uint64(x) <= math.MaxInt64
+	case uint8:
+		return int64(x), true
+	case uint16:
+		return int64(x), true
+	case uint32:
+		return int64(x), true
+	case uint64:
+		return int64(x), x <= math.MaxInt64
+	case float32:
+		return int64(x), float32(int64(x)) == x
+	case float64:
+		return int64(x), float64(int64(x)) == x
+	default:
+		return 0, false
+	}
+}
+
+// toUint64 converts non-negative Go integer values and integral floats to
+// uint64.
+func toUint64(v interface{}) (uint64, bool) {
+	switch x := v.(type) {
+	case uint:
+		return uint64(x), true
+	case uint8:
+		return uint64(x), true
+	case uint16:
+		return uint64(x), true
+	case uint32:
+		return uint64(x), true
+	case uint64:
+		return x, true
+	case float32, float64:
+		f, _ := toFloat64(x)
+		return uint64(f), f >= 0 && float64(uint64(f)) == f
+	default:
+		i, ok := toInt64(x)
+		return uint64(i), ok && i >= 0
+	}
+}
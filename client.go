@@ -19,6 +19,7 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -102,6 +103,11 @@ type Client struct {
 	apikey     string
 	userAgent  string
 	httpClient *http.Client
+
+	// optional pre-flight validation against cached dataset metadata
+	validate bool
+	metaLock sync.RWMutex
+	meta     map[string]*Dataset
 }
 
 // NewClient creates a new API client based on the provided connection configuration.
@@ -129,6 +135,7 @@ func NewClient(apikey string, config *ConnConfig) (*Client, error) {
 		httpClient: httpClient,
 		apikey:     apikey,
 		userAgent:  UserAgent,
+		meta:       make(map[string]*Dataset),
 	}
 	return c, nil
 }
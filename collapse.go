@@ -73,37 +73,57 @@ func ParseCollapseMode(s string) (CollapseMode, error) {
 	}
 }
 
+// collapseSpans lists collapse modes with step from finest to coarsest with
+// the longest bucket they have in any calendar and time zone. Days and weeks
+// gain an hour across DST changes, months have up to 31 days, quarters up to
+// 92 days and years up to 366 days.
+var collapseSpans = []struct {
+	mode CollapseMode
+	max  time.Duration
+}{
+	{CollapseOneMinute, time.Minute},
+	{CollapseFiveMinutes, 5 * time.Minute},
+	{CollapseFifteenMinutes, 15 * time.Minute},
+	{CollapseThirtyMinutes, 30 * time.Minute},
+	{CollapseOneHour, time.Hour},
+	{CollapseThreeHours, 3 * time.Hour},
+	{CollapseSixHours, 6 * time.Hour},
+	{CollapseTwelveHours, 12 * time.Hour},
+	{CollapseDaily, 25 * time.Hour},
+	{CollapseWeekly, 7*24*time.Hour + time.Hour},
+	{CollapseMonthly, 31*24*time.Hour + time.Hour},
+	{CollapseQuarterly, 92*24*time.Hour + time.Hour},
+	{CollapseAnnual, 366*24*time.Hour + time.Hour},
+}
+
+// NewCollapseMode returns the finest collapse mode whose calendar buckets
+// can span d, e.g. daily for 25 hour days across DST changes and monthly for
+// any duration up to 31 days. Durations longer than a year map to annual.
+//
+// Note that durations above 24 and up to 25 hours used to map to weekly and
+// now map to daily, the same one hour allowance applies to weeks, months,
+// quarters and years.
 func NewCollapseMode(d time.Duration) CollapseMode {
-	switch true {
-	case d == 0:
+	if d == 0 {
 		return CollapseNone
-	case d <= time.Minute:
-		return CollapseOneMinute
-	case d <= 5*time.Minute:
-		return CollapseFiveMinutes
-	case d <= 15*time.Minute:
-		return CollapseFifteenMinutes
-	case d <= 30*time.Minute:
-		return CollapseThirtyMinutes
-	case d <= time.Hour:
-		return CollapseOneHour
-	case d <= 3*time.Hour:
-		return CollapseThreeHours
-	case d <= 6*time.Hour:
-		return CollapseSixHours
-	case d <= 12*time.Hour:
-		return CollapseTwelveHours
-	case d <= 24*time.Hour:
-		return CollapseDaily
-	case d <= 7*24*time.Hour:
-		return CollapseWeekly
-	case d <= 31*24*time.Hour: // approx, month is avg 30.41 days
-		return CollapseMonthly
-	case d <= 92*24*time.Hour: // approx, quarter is avg 91.25 days
-		return CollapseQuarterly
-	default:
-		return CollapseAnnual
 	}
+	for _, v := range collapseSpans {
+		if d <= v.max {
+			return v.mode
+		}
+	}
+	return CollapseAnnual
+}
+
+// rank orders collapse modes from finest to coarsest. Modes without step
+// have rank zero.
+func (m CollapseMode) rank() int {
+	for i, v := range collapseSpans {
+		if v.mode == m {
+			return i + 1
+		}
+	}
+	return 0
 }
 
 func (m CollapseMode) IsValid() bool {
@@ -124,6 +144,10 @@ func (m *CollapseMode) UnmarshalText(data []byte) error {
 	return nil
 }
 
+// Duration returns the nominal bucket size of a collapse mode. Months,
+// quarters and years return their average length in the Gregorian calendar
+// (30.44, 91.31 and 365.2425 days), earlier versions returned 30, 90 and 365
+// days. Use Truncate, Next and Steps for calendar correct bucket boundaries.
 func (m CollapseMode) Duration() time.Duration {
 	switch m {
 	case CollapseOneMinute:
@@ -147,12 +171,175 @@ func (m CollapseMode) Duration() time.Duration {
 	case CollapseWeekly:
 		return 24 * 7 * time.Hour // "1w"
 	case CollapseMonthly:
-		return 30 * 24 * time.Hour // "1M" // approx, month is avg 30.41 days
+		return 2629746 * time.Second // "1M", 365.2425 / 12 days
 	case CollapseQuarterly:
-		return 90 * 24 * time.Hour // "3M" // approx, quarter is avg 91.25 days
+		return 7889238 * time.Second // "3M", 365.2425 / 4 days
 	case CollapseAnnual:
-		return 365 * 24 * time.Hour // "1y"
+		return 31556952 * time.Second // "1y", 365.2425 days
 	default:
 		return time.Minute // default
 	}
 }
+
+// IsCalendar returns true for collapse modes with calendar aware steps
+// whose duration varies (days with DST changes, weeks, months, quarters
+// and years).
+func (m CollapseMode) IsCalendar() bool {
+	switch m {
+	case CollapseDaily, CollapseWeekly, CollapseMonthly, CollapseQuarterly, CollapseAnnual:
+		return true
+	default:
+		return false
+	}
+}
+
+// HasStep returns true when the collapse mode defines a fixed bucket step.
+func (m CollapseMode) HasStep() bool {
+	return m.IsValid() && m != CollapseNone
+}
+
+// Truncate returns the start of the collapse bucket that contains t in
+// time zone loc. Minute and hour buckets are aligned to the start of the day,
+// weeks start on Monday (ISO 8601), quarters start in January, April, July and
+// October. A nil loc defaults to UTC. Modes without step return t unchanged.
+func (m CollapseMode) Truncate(t time.Time, loc *time.Location) time.Time {
+	if loc == nil {
+		loc = time.UTC
+	}
+	t = t.In(loc)
+	y, mo, d := t.Date()
+	switch m {
+	case CollapseOneMinute, CollapseFiveMinutes, CollapseFifteenMinutes, CollapseThirtyMinutes:
+		step := int(m.Duration() / time.Minute)
+		return time.Date(y, mo, d, t.Hour(), t.Minute()/step*step, 0, 0, loc)
+	case CollapseOneHour, CollapseThreeHours, CollapseSixHours, CollapseTwelveHours:
+		step := int(m.Duration() / time.Hour)
+		return time.Date(y, mo, d, t.Hour()/step*step, 0, 0, 0, loc)
+	case CollapseDaily:
+		return time.Date(y, mo, d, 0, 0, 0, 0, loc)
+	case CollapseWeekly:
+		// ISO weeks start on Monday
+		offset := (int(t.Weekday()) + 6) % 7
+		return time.Date(y, mo, d-offset, 0, 0, 0, 0, loc)
+	case CollapseMonthly:
+		return time.Date(y, mo, 1, 0, 0, 0, 0, loc)
+	case CollapseQuarterly:
+		return time.Date(y, (mo-1)/3*3+1, 1, 0, 0, 0, 0, loc)
+	case CollapseAnnual:
+		return time.Date(y, 1, 1, 0, 0, 0, 0, loc)
+	default:
+		return t
+	}
+}
+
+// Next returns the start of the collapse bucket following the bucket that
+// contains t. Buckets are computed in the time zone of t. Modes without step
+// return t unchanged.
+func (m CollapseMode) Next(t time.Time) time.Time {
+	loc := t.Location()
+	b := m.Truncate(t, loc)
+	y, mo, d := b.Date()
+	switch m {
+	case CollapseOneMinute, CollapseFiveMinutes, CollapseFifteenMinutes, CollapseThirtyMinutes,
+		CollapseOneHour, CollapseThreeHours, CollapseSixHours, CollapseTwelveHours:
+		// step in absolute time and re-align to the bucket grid of the day.
+		// Across DST changes a step can end in the same bucket when wall
+		// clock times repeat, so keep stepping until the bucket changes.
+		next := b
+		for {
+			next = next.Add(m.Duration())
+			if n := m.Truncate(next, loc); n.After(t) {
+				return n
+			}
+		}
+	case CollapseDaily:
+		return time.Date(y, mo, d+1, 0, 0, 0, 0, loc)
+	case CollapseWeekly:
+		return time.Date(y, mo, d+7, 0, 0, 0, 0, loc)
+	case CollapseMonthly:
+		return time.Date(y, mo+1, 1, 0, 0, 0, 0, loc)
+	case CollapseQuarterly:
+		return time.Date(y, mo+3, 1, 0, 0, 0, 0, loc)
+	case CollapseAnnual:
+		return time.Date(y+1, 1, 1, 0, 0, 0, 0, loc)
+	default:
+		return t
+	}
+}
+
+// Prev returns the start of the collapse bucket preceding the bucket that
+// contains t.
+func (m CollapseMode) Prev(t time.Time) time.Time {
+	if !m.HasStep() {
+		return t
+	}
+	loc := t.Location()
+	b := m.Truncate(t, loc)
+	y, mo, d := b.Date()
+	switch m {
+	case CollapseDaily:
+		return time.Date(y, mo, d-1, 0, 0, 0, 0, loc)
+	case CollapseWeekly:
+		return time.Date(y, mo, d-7, 0, 0, 0, 0, loc)
+	case CollapseMonthly:
+		return time.Date(y, mo-1, 1, 0, 0, 0, 0, loc)
+	case CollapseQuarterly:
+		return time.Date(y, mo-3, 1, 0, 0, 0, 0, loc)
+	case CollapseAnnual:
+		return time.Date(y-1, 1, 1, 0, 0, 0, 0, loc)
+	default:
+		return m.Truncate(b.Add(-time.Nanosecond), loc)
+	}
+}
+
+// Range returns the start times of all collapse buckets that overlap the
+// half-open interval [start, end). Buckets are computed in the time zone of
+// start. Modes without step return nil.
+func (m CollapseMode) Range(start, end time.Time) []time.Time {
+	if !m.HasStep() || !start.Before(end) {
+		return nil
+	}
+	r := make([]time.Time, 0)
+	for t := m.Truncate(start, start.Location()); t.Before(end); t = m.Next(t) {
+		r = append(r, t)
+	}
+	return r
+}
+
+// Count returns the number of collapse buckets that overlap the half-open
+// interval [start, end).
+func (m CollapseMode) Count(start, end time.Time) int {
+	if !m.HasStep() || !start.Before(end) {
+		return 0
+	}
+	var n int
+	for t := m.Truncate(start, start.Location()); t.Before(end); t = m.Next(t) {
+		n++
+	}
+	return n
+}
+
+// Steps returns the number of collapse buckets from the bucket that contains
+// from to the bucket that contains to in time zone loc, e.g. 1 for adjacent
+// buckets. It is negative when to is before from. Modes without step return
+// zero.
+func (m CollapseMode) Steps(from, to time.Time, loc *time.Location) int {
+	if !m.HasStep() {
+		return 0
+	}
+	a, b := m.Truncate(from, loc), m.Truncate(to, loc)
+	if b.Before(a) {
+		return -m.Steps(to, from, loc)
+	}
+	if !m.IsCalendar() {
+		// buckets are aligned to the wall clock, so DST changes can make
+		// the distance an hour shorter or longer than the step count
+		d := m.Duration()
+		return int((b.Sub(a) + d/2) / d)
+	}
+	var n int
+	for t := a; t.Before(b); t = m.Next(t) {
+		n++
+	}
+	return n
+}
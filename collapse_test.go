@@ -0,0 +1,247 @@
+// Copyright (c) 2020 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package blockwatch
+
+import (
+	"testing"
+	"time"
+)
+
+func loadLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Skipf("time zone %s: %v", name, err)
+	}
+	return loc
+}
+
+func TestCollapseTruncate(t *testing.T) {
+	ny := loadLocation(t, "America/New_York")
+	utc := func(y int, mo time.Month, d, h, mi int) time.Time {
+		return time.Date(y, mo, d, h, mi, 0, 0, time.UTC)
+	}
+	local := func(y int, mo time.Month, d, h, mi int) time.Time {
+		return time.Date(y, mo, d, h, mi, 0, 0, ny)
+	}
+	var tests = []struct {
+		mode CollapseMode
+		in   time.Time
+		loc  *time.Location
+		want time.Time
+	}{
+		{CollapseFiveMinutes, utc(2020, 1, 2, 10, 7).Add(30 * time.Second), nil, utc(2020, 1, 2, 10, 5)},
+		{CollapseThreeHours, utc(2020, 1, 2, 10, 59), nil, utc(2020, 1, 2, 9, 0)},
+		{CollapseDaily, utc(2020, 1, 2, 3, 0), ny, local(2020, 1, 1, 0, 0)},
+		// DST in New York starts on 2021-03-14 02:00 and ends on 2021-11-07 02:00
+		{CollapseTwelveHours, local(2021, 3, 14, 15, 0), ny, local(2021, 3, 14, 12, 0)},
+		{CollapseThreeHours, local(2021, 3, 14, 3, 30), ny, local(2021, 3, 14, 3, 0)},
+		{CollapseDaily, local(2021, 11, 7, 23, 59), ny, local(2021, 11, 7, 0, 0)},
+		// ISO weeks start on Monday, 2020 has 53 weeks
+		{CollapseWeekly, utc(2020, 12, 31, 12, 0), nil, utc(2020, 12, 28, 0, 0)},
+		{CollapseWeekly, utc(2021, 1, 3, 23, 59), nil, utc(2020, 12, 28, 0, 0)},
+		{CollapseWeekly, utc(2021, 1, 4, 0, 0), nil, utc(2021, 1, 4, 0, 0)},
+		{CollapseMonthly, utc(2020, 2, 29, 23, 59), nil, utc(2020, 2, 1, 0, 0)},
+		{CollapseMonthly, utc(2020, 3, 1, 0, 0), nil, utc(2020, 3, 1, 0, 0)},
+		{CollapseQuarterly, utc(2020, 3, 31, 23, 59), nil, utc(2020, 1, 1, 0, 0)},
+		{CollapseQuarterly, utc(2020, 4, 1, 0, 0), nil, utc(2020, 4, 1, 0, 0)},
+		{CollapseQuarterly, utc(2020, 12, 31, 0, 0), nil, utc(2020, 10, 1, 0, 0)},
+		{CollapseAnnual, utc(2020, 12, 31, 23, 59), nil, utc(2020, 1, 1, 0, 0)},
+		{CollapseAnnual, utc(2021, 1, 1, 4, 0), ny, local(2020, 1, 1, 0, 0)},
+		{CollapseNone, utc(2020, 1, 2, 10, 7), nil, utc(2020, 1, 2, 10, 7)},
+	}
+	for _, test := range tests {
+		got := test.mode.Truncate(test.in, test.loc)
+		if !got.Equal(test.want) {
+			t.Errorf("%s %s: got %s, want %s", test.mode, test.in, got, test.want)
+		}
+	}
+}
+
+func TestCollapseNextPrev(t *testing.T) {
+	ny := loadLocation(t, "America/New_York")
+	local := func(y int, mo time.Month, d, h, mi int) time.Time {
+		return time.Date(y, mo, d, h, mi, 0, 0, ny)
+	}
+	utc := func(y int, mo time.Month, d int) time.Time {
+		return time.Date(y, mo, d, 0, 0, 0, 0, time.UTC)
+	}
+	// the repeated hour after the fall back change belongs to the 01:00 bucket
+	fallBack := local(2021, 11, 7, 1, 30)
+	var tests = []struct {
+		mode       CollapseMode
+		in         time.Time
+		prev, next time.Time
+		span       time.Duration // absolute length of the bucket containing in
+	}{
+		{CollapseOneHour, local(2021, 3, 14, 1, 30), local(2021, 3, 14, 0, 0), local(2021, 3, 14, 3, 0), time.Hour},
+		{CollapseOneHour, local(2021, 3, 14, 3, 30), local(2021, 3, 14, 1, 0), local(2021, 3, 14, 4, 0), time.Hour},
+		{CollapseOneHour, fallBack, local(2021, 11, 7, 0, 0), fallBack.Add(90 * time.Minute), 2 * time.Hour},
+		{CollapseSixHours, local(2021, 3, 14, 1, 0), local(2021, 3, 13, 18, 0), local(2021, 3, 14, 6, 0), 5 * time.Hour},
+		{CollapseDaily, local(2021, 3, 14, 12, 0), local(2021, 3, 13, 0, 0), local(2021, 3, 15, 0, 0), 23 * time.Hour},
+		{CollapseDaily, local(2021, 11, 7, 12, 0), local(2021, 11, 6, 0, 0), local(2021, 11, 8, 0, 0), 25 * time.Hour},
+		{CollapseWeekly, local(2021, 3, 10, 0, 0), local(2021, 3, 1, 0, 0), local(2021, 3, 15, 0, 0), 7*24*time.Hour - time.Hour},
+		{CollapseWeekly, utc(2020, 12, 31), utc(2020, 12, 21), utc(2021, 1, 4), 7 * 24 * time.Hour},
+		{CollapseMonthly, utc(2020, 1, 31), utc(2019, 12, 1), utc(2020, 2, 1), 31 * 24 * time.Hour},
+		{CollapseMonthly, utc(2020, 2, 29), utc(2020, 1, 1), utc(2020, 3, 1), 29 * 24 * time.Hour},
+		{CollapseMonthly, utc(2021, 2, 28), utc(2021, 1, 1), utc(2021, 3, 1), 28 * 24 * time.Hour},
+		{CollapseQuarterly, utc(2020, 1, 15), utc(2019, 10, 1), utc(2020, 4, 1), 91 * 24 * time.Hour},
+		{CollapseQuarterly, utc(2020, 8, 31), utc(2020, 4, 1), utc(2020, 10, 1), 92 * 24 * time.Hour},
+		{CollapseQuarterly, utc(2020, 12, 31), utc(2020, 7, 1), utc(2021, 1, 1), 92 * 24 * time.Hour},
+		{CollapseAnnual, utc(2020, 6, 1), utc(2019, 1, 1), utc(2021, 1, 1), 366 * 24 * time.Hour},
+	}
+	for _, test := range tests {
+		if got := test.mode.Next(test.in); !got.Equal(test.next) {
+			t.Errorf("%s next %s: got %s, want %s", test.mode, test.in, got, test.next)
+		}
+		if got := test.mode.Prev(test.in); !got.Equal(test.prev) {
+			t.Errorf("%s prev %s: got %s, want %s", test.mode, test.in, got, test.prev)
+		}
+		start := test.mode.Truncate(test.in, test.in.Location())
+		if got := test.mode.Next(test.in).Sub(start); got != test.span {
+			t.Errorf("%s %s: bucket spans %s, want %s", test.mode, test.in, got, test.span)
+		}
+		// calendar buckets fit into the span that maps back to their mode
+		if m := NewCollapseMode(test.span); test.mode.IsCalendar() && m != test.mode {
+			t.Errorf("%s %s: bucket of %s maps to %s", test.mode, test.in, test.span, m)
+		}
+	}
+	for _, m := range []CollapseMode{CollapseNone, CollapseInvalid} {
+		ts := local(2021, 3, 14, 1, 30)
+		if !m.Next(ts).Equal(ts) || !m.Prev(ts).Equal(ts) {
+			t.Errorf("%q: expected unchanged time", m)
+		}
+	}
+}
+
+func TestCollapseRangeSteps(t *testing.T) {
+	ny := loadLocation(t, "America/New_York")
+	utc := func(y int, mo time.Month, d int) time.Time {
+		return time.Date(y, mo, d, 0, 0, 0, 0, time.UTC)
+	}
+	local := func(y int, mo time.Month, d, h int) time.Time {
+		return time.Date(y, mo, d, h, 0, 0, 0, ny)
+	}
+	var tests = []struct {
+		mode       CollapseMode
+		start, end time.Time
+		want       []time.Time
+	}{
+		{CollapseMonthly, utc(2020, 1, 31), utc(2020, 5, 1), []time.Time{
+			utc(2020, 1, 1), utc(2020, 2, 1), utc(2020, 3, 1), utc(2020, 4, 1),
+		}},
+		{CollapseWeekly, utc(2020, 12, 20), utc(2021, 1, 11), []time.Time{
+			utc(2020, 12, 14), utc(2020, 12, 21), utc(2020, 12, 28), utc(2021, 1, 4),
+		}},
+		{CollapseQuarterly, utc(2019, 12, 31), utc(2020, 4, 2), []time.Time{
+			utc(2019, 10, 1), utc(2020, 1, 1), utc(2020, 4, 1),
+		}},
+		{CollapseDaily, local(2021, 3, 13, 12), local(2021, 3, 15, 1), []time.Time{
+			local(2021, 3, 13, 0), local(2021, 3, 14, 0), local(2021, 3, 15, 0),
+		}},
+		{CollapseOneHour, local(2021, 3, 14, 0), local(2021, 3, 14, 4), []time.Time{
+			local(2021, 3, 14, 0), local(2021, 3, 14, 1), local(2021, 3, 14, 3),
+		}},
+		{CollapseMonthly, utc(2020, 5, 1), utc(2020, 5, 1), nil},
+		{CollapseNone, utc(2020, 1, 1), utc(2020, 5, 1), nil},
+	}
+	for _, test := range tests {
+		got := test.mode.Range(test.start, test.end)
+		if len(got) != len(test.want) {
+			t.Errorf("%s range %s..%s: got %v, want %v", test.mode, test.start, test.end, got, test.want)
+			continue
+		}
+		for i := range got {
+			if !got[i].Equal(test.want[i]) {
+				t.Errorf("%s range %s..%s: got %v, want %v", test.mode, test.start, test.end, got, test.want)
+				break
+			}
+		}
+		if n := test.mode.Count(test.start, test.end); n != len(test.want) {
+			t.Errorf("%s count %s..%s: got %d, want %d", test.mode, test.start, test.end, n, len(test.want))
+		}
+		if len(got) > 0 {
+			if n := test.mode.Steps(test.start, got[len(got)-1], test.start.Location()); n != len(got)-1 {
+				t.Errorf("%s steps %s..%s: got %d, want %d", test.mode, test.start, got[len(got)-1], n, len(got)-1)
+			}
+		}
+	}
+
+	var steps = []struct {
+		mode     CollapseMode
+		from, to time.Time
+		loc      *time.Location
+		want     int
+	}{
+		{CollapseMonthly, utc(2020, 1, 31), utc(2020, 3, 1), nil, 2},
+		{CollapseMonthly, utc(2020, 3, 1), utc(2020, 1, 31), nil, -2},
+		{CollapseQuarterly, utc(2019, 12, 31), utc(2020, 4, 1), nil, 2},
+		{CollapseAnnual, utc(2021, 1, 1), utc(2020, 12, 31), nil, -1},
+		{CollapseWeekly, utc(2020, 12, 31), utc(2021, 1, 4), nil, 1},
+		{CollapseWeekly, utc(2020, 1, 1), utc(2021, 1, 4), nil, 53},
+		{CollapseDaily, local(2021, 3, 13, 12), local(2021, 3, 15, 12), ny, 2},
+		{CollapseDaily, local(2021, 11, 6, 12), local(2021, 11, 8, 12), ny, 2},
+		// the same instants are one day apart in UTC
+		{CollapseDaily, local(2021, 11, 6, 12), local(2021, 11, 7, 12), time.UTC, 1},
+		{CollapseOneHour, local(2021, 3, 14, 1), local(2021, 3, 14, 3), ny, 1},
+		{CollapseOneHour, local(2021, 3, 13, 12), local(2021, 3, 14, 12), ny, 23},
+		{CollapseOneHour, local(2021, 11, 6, 12), local(2021, 11, 7, 12), ny, 25},
+		{CollapseNone, utc(2020, 1, 1), utc(2021, 1, 1), nil, 0},
+	}
+	for _, test := range steps {
+		if got := test.mode.Steps(test.from, test.to, test.loc); got != test.want {
+			t.Errorf("%s steps %s..%s: got %d, want %d", test.mode, test.from, test.to, got, test.want)
+		}
+	}
+}
+
+func TestNewCollapseMode(t *testing.T) {
+	const day = 24 * time.Hour
+	var tests = []struct {
+		d    time.Duration
+		want CollapseMode
+	}{
+		{0, CollapseNone},
+		{time.Second, CollapseOneMinute},
+		{time.Minute, CollapseOneMinute},
+		{time.Minute + 1, CollapseFiveMinutes},
+		{time.Hour, CollapseOneHour},
+		{12 * time.Hour, CollapseTwelveHours},
+		{day, CollapseDaily},
+		// days across DST changes
+		{23 * time.Hour, CollapseDaily},
+		{25 * time.Hour, CollapseDaily},
+		{25*time.Hour + 1, CollapseWeekly},
+		{7*day + time.Hour, CollapseWeekly},
+		{28 * day, CollapseMonthly},
+		{31*day + time.Hour, CollapseMonthly},
+		{32 * day, CollapseQuarterly},
+		{92 * day, CollapseQuarterly},
+		{366 * day, CollapseAnnual},
+		{400 * day, CollapseAnnual},
+	}
+	for _, test := range tests {
+		if got := NewCollapseMode(test.d); got != test.want {
+			t.Errorf("%s: got %s, want %s", test.d, got, test.want)
+		}
+	}
+
+	// nominal durations map back to their own mode
+	for _, v := range collapseSpans {
+		if got := NewCollapseMode(v.mode.Duration()); got != v.mode {
+			t.Errorf("%s: duration %s maps to %s", v.mode, v.mode.Duration(), got)
+		}
+	}
+
+	// average calendar lengths
+	if m, y := CollapseMonthly.Duration(), CollapseAnnual.Duration(); 12*m != y {
+		t.Errorf("12 months %s != year %s", 12*m, y)
+	}
+	if q, y := CollapseQuarterly.Duration(), CollapseAnnual.Duration(); 4*q != y {
+		t.Errorf("4 quarters %s != year %s", 4*q, y)
+	}
+	if y := CollapseAnnual.Duration(); y != time.Duration(365.2425*float64(day)) {
+		t.Errorf("year %s", y)
+	}
+}
@@ -0,0 +1,191 @@
+// Copyright (c) 2020 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package blockwatch
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Concat appends the rows of multiple dataframes. All frames must have the
+// same column codes and types as the first frame. Rows of frames with a
+// different column order are reordered to match, all other rows are shared
+// with their source frames. Nil frames are skipped.
+func Concat(frames ...*Dataframe) (*Dataframe, error) {
+	var first *Dataframe
+	n := 0
+	for _, f := range frames {
+		if f == nil {
+			continue
+		}
+		if first == nil {
+			first = f
+		}
+		n += len(f.Data)
+	}
+	if first == nil {
+		return nil, fmt.Errorf("blockwatch: concat requires at least one dataframe")
+	}
+	if err := first.initType(nil); err != nil {
+		return nil, err
+	}
+	data := make([]json.RawMessage, 0, n)
+	for k, f := range frames {
+		if f == nil {
+			continue
+		}
+		order, err := concatOrder(first, f)
+		if err != nil {
+			return nil, fmt.Errorf("blockwatch: concat frame %d: %v", k, err)
+		}
+		if order == nil {
+			data = append(data, f.Data...)
+			continue
+		}
+		for i, row := range f.Data {
+			vals := splitColumns(row[1:len(row)-1], ',')
+			if len(vals) < len(order) {
+				return nil, makeColumnMissingError(f.Columns[len(vals)].Code, len(vals), i)
+			}
+			buf := make([]byte, 0, len(row))
+			buf = append(buf, '[')
+			for j, col := range order {
+				if j > 0 {
+					buf = append(buf, ',')
+				}
+				buf = append(buf, vals[col]...)
+			}
+			buf = append(buf, ']')
+			data = append(data, json.RawMessage(buf))
+		}
+	}
+	return first.view(data), nil
+}
+
+// concatOrder returns the positions of the columns of schema in f or nil
+// when f has the same column order.
+func concatOrder(schema, f *Dataframe) ([]int, error) {
+	if err := f.initType(nil); err != nil {
+		return nil, err
+	}
+	if len(f.Columns) != len(schema.Columns) {
+		return nil, fmt.Errorf("got %d columns, expected %d", len(f.Columns), len(schema.Columns))
+	}
+	order := make([]int, len(schema.Columns))
+	same := true
+	for i, c := range schema.Columns {
+		j := f.columnIndex(c.Code)
+		if j < 0 {
+			return nil, fmt.Errorf("missing column '%s'", c.Code)
+		}
+		if typ := f.Columns[j].Type; typ != c.Type {
+			return nil, fmt.Errorf("column '%s' has type %s, expected %s", c.Code, typ, c.Type)
+		}
+		order[i] = j
+		same = same && i == j
+	}
+	if same {
+		return nil, nil
+	}
+	return order, nil
+}
+
+// DedupKeep defines which row DedupBy keeps among rows with equal keys.
+type DedupKeep int
+
+const (
+	KeepFirst DedupKeep = iota
+	KeepLast
+)
+
+func (k DedupKeep) String() string {
+	switch k {
+	case KeepFirst:
+		return "first"
+	case KeepLast:
+		return "last"
+	default:
+		return "invalid"
+	}
+}
+
+// DedupBy returns a view without rows that have the same values in all key
+// columns as another row. Kept rows stay at their original position. Without
+// keys the time column is used. Rows with null keys are compared like
+// other values.
+func (t *Dataframe) DedupBy(keep DedupKeep, keys ...string) (*Dataframe, error) {
+	if err := t.initType(nil); err != nil {
+		return nil, err
+	}
+	cols := make([]int, 0, len(keys))
+	for _, name := range keys {
+		col := t.columnIndex(name)
+		if col < 0 {
+			return nil, fmt.Errorf("blockwatch: dedup: missing column '%s'", name)
+		}
+		cols = append(cols, col)
+	}
+	if len(cols) == 0 {
+		col := t.timeColumn()
+		if col < 0 {
+			return nil, fmt.Errorf("blockwatch: dedup requires key columns or a time column")
+		}
+		cols = append(cols, col)
+	}
+
+	// find the row to keep for each key
+	index := make(map[string]int, len(t.Data))
+	key := make([]interface{}, len(cols))
+	for i := range t.Data {
+		for j, c := range cols {
+			key[j] = nil
+			if t.IsNullAt(c, i) {
+				continue
+			}
+			v, err := t.FieldAt(c, i)
+			if err != nil {
+				return nil, err
+			}
+			key[j] = v
+		}
+		s := groupKeyString(key)
+		if _, ok := index[s]; ok && keep == KeepFirst {
+			continue
+		}
+		index[s] = i
+	}
+	kept := make([]bool, len(t.Data))
+	for _, i := range index {
+		kept[i] = true
+	}
+	data := make([]json.RawMessage, 0, len(index))
+	for i, v := range t.Data {
+		if kept[i] {
+			data = append(data, v)
+		}
+	}
+	return t.view(data), nil
+}
+
+// DedupKeys returns the columns that identify rows of the dataset, which is
+// the primary key or the time column for series without primary key.
+func (d *Dataset) DedupKeys() []string {
+	if len(d.PrimaryFields) > 0 {
+		return d.PrimaryFields
+	}
+	if d.Type == DatasetTypeSeries {
+		return []string{"time"}
+	}
+	return nil
+}
+
+// Dedup removes duplicate rows from a dataframe fetched from this dataset
+// using DedupKeys.
+func (d *Dataset) Dedup(t *Dataframe, keep DedupKeep) (*Dataframe, error) {
+	keys := d.DedupKeys()
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("blockwatch: dataset %s/%s has no primary key", d.Database, d.Dataset)
+	}
+	return t.DedupBy(keep, keys...)
+}
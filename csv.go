@@ -0,0 +1,502 @@
+// Copyright (c) 2020 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package blockwatch
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Response formats for TableParams.Format and SeriesParams.Format.
+const (
+	FormatJSON = "json"
+	FormatCSV  = "csv"
+)
+
+const (
+	// csvInferRows is the number of rows used to infer column types when
+	// no metadata is available.
+	csvInferRows = 1000
+
+	// csvStreamRows is the number of rows decoded at once when streaming.
+	csvStreamRows = 1000
+)
+
+// CSVHeader defines the header line written by CSV writers.
+type CSVHeader int
+
+const (
+	CSVHeaderCodes CSVHeader = iota // column codes
+	CSVHeaderNames                  // column names
+	CSVHeaderNone                   // no header line
+)
+
+func (h CSVHeader) String() string {
+	switch h {
+	case CSVHeaderCodes:
+		return "codes"
+	case CSVHeaderNames:
+		return "names"
+	case CSVHeaderNone:
+		return "none"
+	default:
+		return "invalid"
+	}
+}
+
+// BytesEncoding defines how bytes columns are written as text.
+type BytesEncoding int
+
+const (
+	BytesHex BytesEncoding = iota
+	BytesBase64
+)
+
+func (e BytesEncoding) String() string {
+	switch e {
+	case BytesHex:
+		return "hex"
+	case BytesBase64:
+		return "base64"
+	default:
+		return "invalid"
+	}
+}
+
+// TimeFormatUnixMilli is a CSVOptions.TimeFormat that writes times as UNIX
+// milliseconds like the API does.
+const TimeFormatUnixMilli = "unixms"
+
+// CSVOptions configures CSV output. The zero value writes comma separated
+// values with a header of column codes, RFC3339 times in UTC (dates as
+// 2006-01-02), hex encoded bytes and empty fields for null values.
+type CSVOptions struct {
+	Delimiter  rune           // field delimiter, defaults to ','
+	Header     CSVHeader      // header line
+	TimeFormat string         // time layout or TimeFormatUnixMilli, defaults to RFC3339
+	Location   *time.Location // time zone for formatted times, defaults to UTC
+	Bytes      BytesEncoding  // encoding of bytes columns
+	Null       string         // text written for null values
+}
+
+// CSVWriter writes dataframes as CSV. The header is written before the first
+// dataframe, all further dataframes must have the same columns, e.g. pages of
+// the same query.
+type CSVWriter struct {
+	w       *csv.Writer
+	opts    CSVOptions
+	columns []Datafield
+	rows    int
+}
+
+// NewCSVWriter creates a CSV writer on w.
+func NewCSVWriter(w io.Writer, opts CSVOptions) *CSVWriter {
+	cw := csv.NewWriter(w)
+	if opts.Delimiter != 0 {
+		cw.Comma = opts.Delimiter
+	}
+	if opts.Location == nil {
+		opts.Location = time.UTC
+	}
+	return &CSVWriter{w: cw, opts: opts}
+}
+
+// Rows returns the number of data rows written so far.
+func (c *CSVWriter) Rows() int {
+	return c.rows
+}
+
+// Write writes all rows of a dataframe and the header on first use.
+func (c *CSVWriter) Write(t *Dataframe) error {
+	if err := t.initType(nil); err != nil {
+		return err
+	}
+	if c.columns == nil {
+		c.columns = t.Columns
+		if err := c.writeHeader(); err != nil {
+			return err
+		}
+	} else if err := c.checkColumns(t.Columns); err != nil {
+		return err
+	}
+	rec := make([]string, len(t.Columns))
+	for i := range t.Data {
+		for j, f := range t.Columns {
+			if t.IsNullAt(j, i) {
+				rec[j] = c.opts.Null
+				continue
+			}
+			v, err := t.FieldAt(j, i)
+			if err != nil {
+				return err
+			}
+			rec[j] = c.format(f.Type, v)
+		}
+		if err := c.w.Write(rec); err != nil {
+			return err
+		}
+		c.rows++
+	}
+	return c.w.Error()
+}
+
+// Flush writes buffered data to the underlying writer.
+func (c *CSVWriter) Flush() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+func (c *CSVWriter) writeHeader() error {
+	if c.opts.Header == CSVHeaderNone {
+		return nil
+	}
+	rec := make([]string, len(c.columns))
+	for i, f := range c.columns {
+		rec[i] = f.Code
+		if c.opts.Header == CSVHeaderNames && f.Name != "" {
+			rec[i] = f.Name
+		}
+	}
+	return c.w.Write(rec)
+}
+
+func (c *CSVWriter) checkColumns(cols []Datafield) error {
+	if len(cols) != len(c.columns) {
+		return fmt.Errorf("blockwatch: csv: got %d columns, expected %d", len(cols), len(c.columns))
+	}
+	for i, f := range cols {
+		if f.Code != c.columns[i].Code || f.Type != c.columns[i].Type {
+			return fmt.Errorf("blockwatch: csv: column %d is '%s' %s, expected '%s' %s", i, f.Code, f.Type, c.columns[i].Code, c.columns[i].Type)
+		}
+	}
+	return nil
+}
+
+func (c *CSVWriter) format(typ FieldType, v interface{}) string {
+	switch x := v.(type) {
+	case string:
+		return x
+	case []byte:
+		if c.opts.Bytes == BytesBase64 {
+			return base64.StdEncoding.EncodeToString(x)
+		}
+		return hex.EncodeToString(x)
+	case time.Time:
+		switch c.opts.TimeFormat {
+		case TimeFormatUnixMilli:
+			return strconv.FormatInt(x.UnixMilli(), 10)
+		case "":
+			if typ == FieldTypeDate {
+				return x.In(c.opts.Location).Format("2006-01-02")
+			}
+			return x.In(c.opts.Location).Format(time.RFC3339)
+		default:
+			return x.In(c.opts.Location).Format(c.opts.TimeFormat)
+		}
+	case bool:
+		return strconv.FormatBool(x)
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64)
+	case int64:
+		return strconv.FormatInt(x, 10)
+	case uint64:
+		return strconv.FormatUint(x, 10)
+	default:
+		return fmt.Sprint(x)
+	}
+}
+
+// WriteCSV writes the dataframe as CSV to w.
+func (t *Dataframe) WriteCSV(w io.Writer, opts CSVOptions) error {
+	c := NewCSVWriter(w, opts)
+	if err := c.Write(t); err != nil {
+		return err
+	}
+	return c.Flush()
+}
+
+// WriteCSVStream writes all pages of an iterator as one CSV document to w
+// and returns the number of rows written. Only the current page is held in
+// memory. Pages with a different column layout than the first page are
+// rejected.
+func WriteCSVStream(w io.Writer, it FrameIterator, opts CSVOptions) (int, error) {
+	c := NewCSVWriter(w, opts)
+	for it.Next() {
+		if err := c.Write(it.Dataframe()); err != nil {
+			return c.Rows(), err
+		}
+		// hand each page to w so memory stays bounded by the page size
+		if err := c.Flush(); err != nil {
+			return c.Rows(), err
+		}
+	}
+	if err := it.Err(); err != nil {
+		return c.Rows(), err
+	}
+	return c.Rows(), c.Flush()
+}
+
+// CSVReader reads CSV data with a header line of column codes into
+// dataframes. Column types are taken from field metadata when available and
+// inferred from the first 1000 rows otherwise. Empty values are null, except
+// for string columns.
+type CSVReader struct {
+	r       *csv.Reader
+	fields  []Datafield
+	columns []Datafield
+	pending [][]string // rows read ahead for type inference
+	row     int
+}
+
+// NewCSVReader creates a CSV reader on r. fields provides metadata for
+// columns by code, e.g. Dataset.Columns.
+func NewCSVReader(r io.Reader, fields ...Datafield) *CSVReader {
+	return &CSVReader{r: csv.NewReader(r), fields: fields}
+}
+
+// Columns reads the header line and returns column metadata.
+func (r *CSVReader) Columns() ([]Datafield, error) {
+	if r.columns != nil {
+		return r.columns, nil
+	}
+	header, err := r.r.Read()
+	if err != nil {
+		if err == io.EOF {
+			return nil, fmt.Errorf("blockwatch: csv: missing header")
+		}
+		return nil, err
+	}
+	cols := make([]Datafield, len(header))
+	infer := make([]int, 0)
+	for i, code := range header {
+		code = strings.TrimSpace(code)
+		cols[i] = Datafield{Name: code, Code: code}
+		for _, f := range r.fields {
+			if f.Code == code {
+				cols[i] = f
+				break
+			}
+		}
+		if cols[i].Type == FieldTypeUndefined {
+			infer = append(infer, i)
+		}
+	}
+	if len(infer) > 0 {
+		for len(r.pending) < csvInferRows {
+			rec, err := r.r.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			r.pending = append(r.pending, rec)
+		}
+		vals := make([]string, len(r.pending))
+		for _, i := range infer {
+			for j, rec := range r.pending {
+				vals[j] = rec[i]
+			}
+			cols[i].Type = inferFieldType(cols[i].Code, vals)
+		}
+	}
+	r.columns = cols
+	return cols, nil
+}
+
+// Read reads up to n rows into a new dataframe, or all remaining rows when n
+// is zero or negative. It returns io.EOF when no rows are left.
+func (r *CSVReader) Read(n int) (*Dataframe, error) {
+	cols, err := r.Columns()
+	if err != nil {
+		return nil, err
+	}
+	t := NewDataframe(cols...)
+	vals := make([]interface{}, len(cols))
+	for n <= 0 || len(t.Data) < n {
+		var rec []string
+		if len(r.pending) > 0 {
+			rec, r.pending = r.pending[0], r.pending[1:]
+		} else if rec, err = r.r.Read(); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		for i, f := range cols {
+			vals[i], err = parseCSVValue(f.Type, rec[i])
+			if err != nil {
+				return nil, makeColumnError(f.Code, i, r.row, err)
+			}
+		}
+		if err := t.Append(vals...); err != nil {
+			return nil, err
+		}
+		r.row++
+	}
+	if len(t.Data) == 0 && n > 0 {
+		return nil, io.EOF
+	}
+	return t, nil
+}
+
+// ReadCSV reads all rows of CSV data with a header line into a dataframe,
+// see CSVReader.
+func ReadCSV(r io.Reader, fields ...Datafield) (*Dataframe, error) {
+	return NewCSVReader(r, fields...).Read(0)
+}
+
+func parseCSVValue(typ FieldType, s string) (interface{}, error) {
+	if typ == FieldTypeString {
+		return s, nil
+	}
+	if s == "" {
+		return nil, nil
+	}
+	if typ == FieldTypeBytes {
+		// accept 0x prefixed hex
+		s = strings.TrimPrefix(s, "0x")
+	}
+	return parseFieldValue(typ, s)
+}
+
+// inferFieldType returns the most specific type that all non-empty values
+// can be parsed as. Integer columns with code time are UNIX milliseconds.
+// Integer columns that fit neither int64 nor uint64 are kept as strings
+// instead of losing precision as float64.
+func inferFieldType(code string, vals []string) FieldType {
+	typ := FieldTypeUndefined
+	var neg bool
+	for _, v := range vals {
+		if v == "" {
+			continue
+		}
+		vt := valueFieldType(v)
+		if vt == FieldTypeInt64 && v[0] == '-' {
+			neg = true
+		}
+		typ = widenFieldType(typ, vt)
+		if typ == FieldTypeString {
+			break
+		}
+	}
+	if typ == FieldTypeUint64 && neg {
+		return FieldTypeString
+	}
+	switch typ {
+	case FieldTypeUndefined:
+		return FieldTypeString
+	case FieldTypeInt64, FieldTypeUint64:
+		if code == "time" {
+			return FieldTypeDatetime
+		}
+	}
+	return typ
+}
+
+// valueFieldType returns the most specific type of a single value.
+func valueFieldType(v string) FieldType {
+	if _, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return FieldTypeInt64
+	}
+	if _, err := strconv.ParseUint(v, 10, 64); err == nil {
+		return FieldTypeUint64
+	}
+	// NaN and Inf are text, null floats are written as empty values
+	if f, err := strconv.ParseFloat(v, 64); err == nil && !math.IsNaN(f) && !math.IsInf(f, 0) {
+		return FieldTypeFloat64
+	}
+	if v == "true" || v == "false" {
+		return FieldTypeBoolean
+	}
+	if _, err := time.Parse("2006-01-02", v); err == nil {
+		return FieldTypeDate
+	}
+	if _, err := parseTimeValue(v); err == nil {
+		return FieldTypeDatetime
+	}
+	return FieldTypeString
+}
+
+// widenFieldType returns a type that can hold values of both types.
+func widenFieldType(a, b FieldType) FieldType {
+	switch true {
+	case a == FieldTypeUndefined || a == b:
+		return b
+	case isIntegerType(a) && isIntegerType(b):
+		// uint64 values exceed int64, int64 values fit unless they are
+		// negative which inferFieldType tracks
+		return FieldTypeUint64
+	case isNumericType(a) && isNumericType(b):
+		return FieldTypeFloat64
+	case isTimeType(a) && isTimeType(b):
+		return FieldTypeDatetime
+	default:
+		return FieldTypeString
+	}
+}
+
+// formatHeaders returns request headers that select the response format.
+func formatHeaders(format string) http.Header {
+	if format != FormatCSV {
+		return nil
+	}
+	return http.Header{"Accept": []string{"text/csv"}}
+}
+
+// getCSV fetches a CSV response and parses it into a dataframe with column
+// types from cached dataset metadata.
+func (c *Client) getCSV(ctx context.Context, urlpath, dbcode, setcode string) (*Dataframe, error) {
+	set, err := c.CachedDataset(ctx, dbcode, setcode)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := c.Get(ctx, urlpath, formatHeaders(FormatCSV), &buf); err != nil {
+		return nil, err
+	}
+	return ReadCSV(&buf, set.Columns...)
+}
+
+// streamCSV fetches a CSV response and calls fn for each row while the
+// response is read. Rows are decoded in chunks of 1000 rows, so memory use
+// does not depend on the result size.
+func (c *Client) streamCSV(ctx context.Context, urlpath, dbcode, setcode string, fn func(r Row) error) error {
+	set, err := c.CachedDataset(ctx, dbcode, setcode)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	pr, pw := io.Pipe()
+	go func() {
+		// hide Close from handleResponse so that read errors reach the
+		// consumer instead of a clean EOF
+		err := c.Get(ctx, urlpath, formatHeaders(FormatCSV), struct{ io.Writer }{pw})
+		pw.CloseWithError(err)
+	}()
+	defer pr.Close()
+	r := NewCSVReader(pr, set.Columns...)
+	for {
+		t, err := r.Read(csvStreamRows)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := t.ForEach(fn); err != nil {
+			return err
+		}
+	}
+}
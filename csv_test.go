@@ -0,0 +1,343 @@
+// Copyright (c) 2020 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package blockwatch
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func csvTestFrame(t *testing.T) *Dataframe {
+	df := NewDataframe(
+		Datafield{Name: "Time", Code: "time", Type: FieldTypeDatetime},
+		Datafield{Code: "d", Type: FieldTypeDate},
+		Datafield{Code: "n", Type: FieldTypeInt64},
+		Datafield{Code: "u", Type: FieldTypeUint64},
+		Datafield{Code: "f", Type: FieldTypeFloat64},
+		Datafield{Code: "b", Type: FieldTypeBoolean},
+		Datafield{Name: "Label", Code: "s", Type: FieldTypeString},
+		Datafield{Code: "x", Type: FieldTypeBytes},
+	)
+	for _, r := range [][]interface{}{
+		{resampleTime.Add(1500 * time.Millisecond), resampleTime, int64(-1), uint64(2), 0.5, true, "a,b", []byte{0xde, 0xad}},
+		{resampleTime.Add(time.Hour), nil, nil, nil, nil, nil, nil, nil},
+	} {
+		if err := df.Append(r...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return df
+}
+
+func TestWriteCSV(t *testing.T) {
+	df := csvTestFrame(t)
+	var tests = []struct {
+		name string
+		opts CSVOptions
+		want string
+	}{
+		{"default", CSVOptions{}, "" +
+			"time,d,n,u,f,b,s,x\n" +
+			"2020-01-02T00:00:01Z,2020-01-02,-1,2,0.5,true,\"a,b\",dead\n" +
+			"2020-01-02T01:00:00Z,,,,,,,\n",
+		},
+		{"options", CSVOptions{
+			Delimiter:  ';',
+			Header:     CSVHeaderNames,
+			TimeFormat: TimeFormatUnixMilli,
+			Bytes:      BytesBase64,
+			Null:       "NA",
+		}, "" +
+			"Time;d;n;u;f;b;Label;x\n" +
+			"1577923201500;1577923200000;-1;2;0.5;true;a,b;3q0=\n" +
+			"1577926800000;NA;NA;NA;NA;NA;NA;NA\n",
+		},
+		// dates are formatted in the requested zone as well
+		{"layout", CSVOptions{
+			Header:     CSVHeaderNone,
+			TimeFormat: "2006-01-02 15:04:05.000 MST",
+			Location:   time.FixedZone("EST", -5*3600),
+		}, "" +
+			"2020-01-01 19:00:01.500 EST,2020-01-01 19:00:00.000 EST,-1,2,0.5,true,\"a,b\",dead\n" +
+			"2020-01-01 20:00:00.000 EST,,,,,,,\n",
+		},
+	}
+	for _, test := range tests {
+		var buf bytes.Buffer
+		if err := df.WriteCSV(&buf, test.opts); err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if buf.String() != test.want {
+			t.Errorf("%s: got\n%s\nwant\n%s", test.name, buf.String(), test.want)
+		}
+	}
+}
+
+func TestCSVWriterUnixMilli(t *testing.T) {
+	c := NewCSVWriter(nil, CSVOptions{TimeFormat: TimeFormatUnixMilli})
+	for _, test := range []struct {
+		t    time.Time
+		want string
+	}{
+		{time.Unix(0, 0), "0"},
+		{time.Unix(0, -1500000), "-2"},
+		{time.Date(3000, 1, 1, 0, 0, 0, 0, time.UTC), "32503680000000"},
+	} {
+		if got := c.format(FieldTypeDatetime, test.t); got != test.want {
+			t.Errorf("%s: got %s, want %s", test.t, got, test.want)
+		}
+	}
+}
+
+func TestCSVWriterColumns(t *testing.T) {
+	var buf bytes.Buffer
+	c := NewCSVWriter(&buf, CSVOptions{})
+	df := csvTestFrame(t)
+	if err := c.Write(df); err != nil {
+		t.Fatal(err)
+	}
+	// later dataframes append rows without a header
+	if err := c.Write(df); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if c.Rows() != 4 || strings.Count(buf.String(), "\n") != 5 {
+		t.Errorf("got %d rows\n%s", c.Rows(), buf.String())
+	}
+	other := NewDataframe(Datafield{Code: "time", Type: FieldTypeDatetime})
+	if err := c.Write(other); err == nil || !strings.Contains(err.Error(), "got 1 columns, expected 8") {
+		t.Errorf("got error %v", err)
+	}
+	other = NewDataframe(df.Columns...)
+	other.Columns[2].Type = FieldTypeFloat64
+	if err := c.Write(other); err == nil || !strings.Contains(err.Error(), "column 2 is 'n' float64, expected 'n' int64") {
+		t.Errorf("got error %v", err)
+	}
+}
+
+func TestCSVRoundTrip(t *testing.T) {
+	df := csvTestFrame(t)
+	for _, opts := range []CSVOptions{
+		{TimeFormat: TimeFormatUnixMilli},
+		{TimeFormat: time.RFC3339Nano, Location: time.FixedZone("EST", -5*3600)},
+	} {
+		var buf bytes.Buffer
+		if err := df.WriteCSV(&buf, opts); err != nil {
+			t.Fatal(err)
+		}
+		res, err := ReadCSV(&buf, df.Columns...)
+		if err != nil {
+			t.Fatalf("%s: %v", opts.TimeFormat, err)
+		}
+		for i, f := range df.Columns {
+			if res.Columns[i] != f {
+				t.Errorf("%s: column %d: got %+v, want %+v", opts.TimeFormat, i, res.Columns[i], f)
+			}
+		}
+		// empty strings cannot be told apart from null
+		checkRows(t, res, [][]interface{}{
+			{resampleTime.Add(1500 * time.Millisecond), resampleTime, int64(-1), uint64(2), 0.5, true, "a,b", []byte{0xde, 0xad}},
+			{resampleTime.Add(time.Hour), nil, nil, nil, nil, nil, "", nil},
+		})
+	}
+}
+
+func TestInferFieldType(t *testing.T) {
+	var tests = []struct {
+		code string
+		vals []string
+		want FieldType
+	}{
+		{"a", []string{"1", "", "-2"}, FieldTypeInt64},
+		{"a", []string{"1", "18446744073709551615"}, FieldTypeUint64},
+		{"a", []string{"18446744073709551615", "1"}, FieldTypeUint64},
+		// no integer type holds both values
+		{"a", []string{"-1", "18446744073709551615"}, FieldTypeString},
+		{"a", []string{"18446744073709551615", "-0"}, FieldTypeString},
+		{"a", []string{"1", "2.5"}, FieldTypeFloat64},
+		{"a", []string{"-1", "18446744073709551615", "0.5"}, FieldTypeFloat64},
+		{"a", []string{"1e400"}, FieldTypeString},
+		{"a", []string{"1.5", "NaN"}, FieldTypeString},
+		{"a", []string{"Inf"}, FieldTypeString},
+		{"a", []string{"-infinity"}, FieldTypeString},
+		{"a", []string{"true", "false"}, FieldTypeBoolean},
+		{"a", []string{"true", "1"}, FieldTypeString},
+		{"a", []string{"2020-01-02", "2020-01-03"}, FieldTypeDate},
+		{"a", []string{"2020-01-02", "2020-01-03T10:00:00Z"}, FieldTypeDatetime},
+		{"a", []string{"1", "x"}, FieldTypeString},
+		{"a", []string{"", ""}, FieldTypeString},
+		{"a", nil, FieldTypeString},
+		{"time", []string{"1577923200000"}, FieldTypeDatetime},
+		{"time", []string{"1.5"}, FieldTypeFloat64},
+	}
+	for _, test := range tests {
+		if got := inferFieldType(test.code, test.vals); got != test.want {
+			t.Errorf("%s %q: got %s, want %s", test.code, test.vals, got, test.want)
+		}
+	}
+}
+
+func TestReadCSVColumns(t *testing.T) {
+	data := "" +
+		" time ,height,price,name,big\n" +
+		"1577923200000,1,1.5,a,-1\n" +
+		"1577923260000,2,,,18446744073709551615\n"
+	// fields are matched by code, unknown fields are ignored
+	fields := []Datafield{
+		{Name: "Height", Code: "height", Type: FieldTypeFloat64},
+		{Name: "Time", Code: "time", Type: FieldTypeDatetime},
+		{Name: "Hash", Code: "hash", Type: FieldTypeBytes},
+	}
+	df, err := ReadCSV(strings.NewReader(data), fields...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Datafield{
+		{Name: "Time", Code: "time", Type: FieldTypeDatetime},
+		{Name: "Height", Code: "height", Type: FieldTypeFloat64},
+		{Name: "price", Code: "price", Type: FieldTypeFloat64},
+		{Name: "name", Code: "name", Type: FieldTypeString},
+		{Name: "big", Code: "big", Type: FieldTypeString},
+	}
+	if len(df.Columns) != len(want) {
+		t.Fatalf("got columns %+v", df.Columns)
+	}
+	for i, f := range want {
+		if df.Columns[i] != f {
+			t.Errorf("column %d: got %+v, want %+v", i, df.Columns[i], f)
+		}
+	}
+	checkRows(t, df, [][]interface{}{
+		{resampleTime, 1.0, 1.5, "a", "-1"},
+		{resampleTime.Add(time.Minute), 2.0, nil, "", "18446744073709551615"},
+	})
+
+	// values must match the metadata type
+	_, err = ReadCSV(strings.NewReader("time,height\n1,2\n2,x\n"), fields...)
+	if err == nil || !strings.Contains(err.Error(), "cannot decode column 'height' [1:1]") {
+		t.Errorf("got error %v", err)
+	}
+	if _, err := ReadCSV(strings.NewReader("")); err == nil || !strings.Contains(err.Error(), "missing header") {
+		t.Errorf("got error %v", err)
+	}
+}
+
+func TestCSVReaderPages(t *testing.T) {
+	var buf strings.Builder
+	buf.WriteString("n\n")
+	for i := 0; i < csvInferRows+500; i++ {
+		fmt.Fprintf(&buf, "%d\n", i)
+	}
+	// rows read ahead for inference are returned first
+	r := NewCSVReader(strings.NewReader(buf.String()))
+	var n int64
+	for _, size := range []int{600, 600, 300} {
+		df, err := r.Read(600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(df.Data) != size {
+			t.Fatalf("got %d rows, want %d", len(df.Data), size)
+		}
+		vals, err := df.ColumnValues("n")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, v := range vals {
+			if v != n {
+				t.Fatalf("got value %v, want %d", v, n)
+			}
+			n++
+		}
+	}
+	if _, err := r.Read(600); err != io.EOF {
+		t.Errorf("got error %v, want EOF", err)
+	}
+}
+
+func TestStreamCSV(t *testing.T) {
+	var body string
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "metadata.json") {
+			w.Write([]byte(`{"database_code":"BTC","dataset_code":"BLOCK","type":"table",
+				"columns":[{"code":"time","type":"datetime"},{"code":"height","type":"uint64"}]}`))
+			return
+		}
+		if r.Header.Get("Accept") != "text/csv" {
+			t.Errorf("got accept header %q", r.Header.Get("Accept"))
+		}
+		if strings.HasPrefix(body, "truncated") {
+			// announce more data than is sent
+			w.Header().Set("Content-Length", "100000")
+		}
+		w.Write([]byte(strings.TrimPrefix(body, "truncated")))
+	})
+	rows := func(n int, bad int) string {
+		var buf strings.Builder
+		buf.WriteString("time,height\n")
+		for i := 0; i < n; i++ {
+			if i == bad {
+				buf.WriteString("1577923200000,x\n")
+				continue
+			}
+			fmt.Fprintf(&buf, "%d,%d\n", 1577923200000+int64(i)*60000, i)
+		}
+		return buf.String()
+	}
+	ctx := context.Background()
+	stream := func() (int, error) {
+		var n int
+		err := c.StreamTable(ctx, "BTC", "BLOCK", TableParams{}, func(r Row) error {
+			var v struct {
+				Time   time.Time `json:"time"`
+				Height uint64    `json:"height"`
+			}
+			if err := r.Decode(&v); err != nil {
+				return err
+			}
+			if v.Height != uint64(n) || !v.Time.Equal(resampleTime.Add(time.Duration(n)*time.Minute)) {
+				return fmt.Errorf("row %d: got %+v", n, v)
+			}
+			n++
+			return nil
+		})
+		return n, err
+	}
+
+	// rows are decoded in chunks
+	body = rows(2*csvStreamRows+1, -1)
+	if n, err := stream(); err != nil || n != 2*csvStreamRows+1 {
+		t.Errorf("got %d rows, error %v", n, err)
+	}
+
+	// decode errors stop the stream after the previous chunk
+	body = rows(2*csvStreamRows, csvStreamRows+5)
+	n, err := stream()
+	if err == nil || !strings.Contains(err.Error(), "cannot decode column 'height' [1:1005]") || n != csvStreamRows {
+		t.Errorf("got %d rows, error %v", n, err)
+	}
+
+	// a truncated response is an error, not a short result
+	body = "truncated" + rows(10, -1)
+	if n, err := stream(); err == nil || n != 0 {
+		t.Errorf("got %d rows, error %v", n, err)
+	}
+
+	// callback errors are returned unchanged
+	body = rows(10, -1)
+	stop := errors.New("stop")
+	err = c.StreamTable(ctx, "BTC", "BLOCK", TableParams{}, func(r Row) error { return stop })
+	if err != stop {
+		t.Errorf("got error %v, want %v", err, stop)
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"math"
 	"reflect"
 	"strconv"
 	"strings"
@@ -88,6 +89,20 @@ func (t *Dataframe) FieldAt(col, row int) (interface{}, error) {
 	}
 }
 
+// IsNullAt returns true when the value at col and row is JSON null. Decoders
+// return zero values for null (NaN for float64 columns).
+func (t *Dataframe) IsNullAt(col, row int) bool {
+	if col < 0 || col >= len(t.Columns) || row < 0 || row >= len(t.Data) {
+		return false
+	}
+	v := stripArray(t.Data[row][:])
+	start, end := indexByteColumnN(v, ',', col)
+	if start < 0 {
+		return false
+	}
+	return isNullValue(v[start:end])
+}
+
 func (t *Dataframe) ForEach(fn func(r Row) error) error {
 	for i, l := 0, len(t.Data); i < l; i++ {
 		if err := fn(Row{data: t, n: i}); err != nil {
@@ -145,6 +160,23 @@ func (t *Dataframe) columnIndex(name string) int {
 	return -1
 }
 
+// timeColumn returns the index of the column named time or the first date
+// or datetime column.
+func (t *Dataframe) timeColumn() int {
+	if err := t.initType(nil); err != nil {
+		return -1
+	}
+	if i := t.columnIndex("time"); i >= 0 {
+		return i
+	}
+	for i, v := range t.Columns {
+		if v.Type == FieldTypeDatetime || v.Type == FieldTypeDate {
+			return i
+		}
+	}
+	return -1
+}
+
 func (t *Dataframe) initType(val interface{}) error {
 	var err error
 	if t.tinfo == nil && val != nil {
@@ -178,7 +210,7 @@ func (t *Dataframe) decodeAt(pos int, val interface{}, tinfo *typeInfo) error {
 	buf := t.Data[pos]
 
 	// strip JSON array delimiter and split JSON columns
-	cols := bytes.Split(buf[1:len(buf)-1], []byte(","))
+	cols := splitColumns(buf[1:len(buf)-1], ',')
 
 	// decode all struct fields
 	for _, finfo := range tinfo.fields {
@@ -187,6 +219,10 @@ func (t *Dataframe) decodeAt(pos int, val interface{}, tinfo *typeInfo) error {
 		if col < 0 {
 			continue
 		}
+		// skip null values, struct fields keep their zero value
+		if isNullValue(cols[col]) {
+			continue
+		}
 		// resolve field, fail on error
 		dst := finfo.value(v)
 		if !dst.IsValid() {
@@ -399,6 +435,9 @@ func (t *Dataframe) decodeInt64At(col, row int, name string) (int64, error) {
 	if start < 0 {
 		return 0, makeColumnMissingError(name, col, row)
 	}
+	if isNullValue(v[start:end]) {
+		return 0, nil
+	}
 	val, err := strconv.ParseInt(string(v[start:end]), 10, 64)
 	if err != nil {
 		return 0, makeColumnError(name, col, row, err)
@@ -415,6 +454,9 @@ func (t *Dataframe) decodeUint64At(col, row int, name string) (uint64, error) {
 	if start < 0 {
 		return 0, makeColumnMissingError(name, col, row)
 	}
+	if isNullValue(v[start:end]) {
+		return 0, nil
+	}
 	val, err := strconv.ParseUint(string(v[start:end]), 10, 64)
 	if err != nil {
 		return 0, makeColumnError(name, col, row, err)
@@ -431,6 +473,9 @@ func (t *Dataframe) decodeFloat64At(col, row int, name string) (float64, error)
 	if start < 0 {
 		return 0, makeColumnMissingError(name, col, row)
 	}
+	if isNullValue(v[start:end]) {
+		return math.NaN(), nil
+	}
 	val, err := strconv.ParseFloat(string(v[start:end]), 64)
 	if err != nil {
 		return 0, makeColumnError(name, col, row, err)
@@ -447,6 +492,9 @@ func (t *Dataframe) decodeStringAt(col, row int, name string) (string, error) {
 	if start < 0 {
 		return "", makeColumnMissingError(name, col, row)
 	}
+	if isNullValue(v[start:end]) {
+		return "", nil
+	}
 	val, err := strconv.Unquote(string(bytes.TrimSpace(v[start:end])))
 	if err != nil {
 		return "", makeColumnError(name, col, row, err)
@@ -463,6 +511,9 @@ func (t *Dataframe) decodeBytesAt(col, row int, name string) ([]byte, error) {
 	if start < 0 {
 		return nil, makeColumnMissingError(name, col, row)
 	}
+	if isNullValue(v[start:end]) {
+		return nil, nil
+	}
 	val, err := strconv.Unquote(string(bytes.TrimSpace(v[start:end])))
 	if err != nil {
 		return nil, makeColumnError(name, col, row, err)
@@ -483,6 +534,9 @@ func (t *Dataframe) decodeBoolAt(col, row int, name string) (bool, error) {
 	if start < 0 {
 		return false, makeColumnMissingError(name, col, row)
 	}
+	if isNullValue(v[start:end]) {
+		return false, nil
+	}
 	val, err := strconv.ParseBool(string(v[start:end]))
 	if err != nil {
 		return false, makeColumnError(name, col, row, err)
@@ -499,6 +553,9 @@ func (t *Dataframe) decodeTimeAt(col, row int, name string) (time.Time, error) {
 	if start < 0 {
 		return time.Time{}, fmt.Errorf("blockwatch: missing column %s (%d:%d)", name, col, row)
 	}
+	if isNullValue(v[start:end]) {
+		return time.Time{}, nil
+	}
 	val, err := strconv.ParseInt(string(v[start:end]), 10, 64)
 	if err != nil {
 		return time.Time{}, fmt.Errorf("blockwatch: cannot decode time column %s [%d:%d]: %v",
@@ -507,6 +564,13 @@ func (t *Dataframe) decodeTimeAt(col, row int, name string) (time.Time, error) {
 	return time.Unix(0, val*1000000).UTC(), nil
 }
 
+// isNullValue returns true for JSON null values. Resampled and joined
+// dataframes contain nulls for missing values, decoders treat them as
+// zero values instead of failing.
+func isNullValue(v []byte) bool {
+	return bytes.Equal(bytes.TrimSpace(v), []byte("null"))
+}
+
 func stripArray(data []byte) []byte {
 	end := len(data) - 2
 	if end >= 0 && data[end] == ',' {
@@ -0,0 +1,195 @@
+// Copyright (c) 2020 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package blockwatch
+
+import (
+	"encoding/json"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var decodeColumns = []Datafield{
+	{Code: "s", Type: FieldTypeString},
+	{Code: "b", Type: FieldTypeBytes},
+	{Code: "t", Type: FieldTypeDatetime},
+	{Code: "ok", Type: FieldTypeBoolean},
+	{Code: "f", Type: FieldTypeFloat64},
+	{Code: "i", Type: FieldTypeInt64},
+	{Code: "u", Type: FieldTypeUint64},
+}
+
+type decodeRow struct {
+	S  string    `json:"s"`
+	B  []byte    `json:"b"`
+	T  time.Time `json:"t"`
+	Ok bool      `json:"ok"`
+	F  float64   `json:"f"`
+	I  int64     `json:"i"`
+	U  uint64    `json:"u"`
+}
+
+func TestDecodeNull(t *testing.T) {
+	df := &Dataframe{
+		Columns: decodeColumns,
+		Data: []json.RawMessage{
+			json.RawMessage(`["a","0102",1577836800000,true,1.5,-2,3]`),
+			json.RawMessage(`[null,null,null,null,null,null,null]`),
+			json.RawMessage(`[ null , null , null , null , null , null , null ]`),
+		},
+	}
+
+	// typed field access returns zero values, NaN for float64
+	want := []interface{}{"", []byte(nil), time.Time{}, false, math.NaN(), int64(0), uint64(0)}
+	for row := 1; row < len(df.Data); row++ {
+		for col := range df.Columns {
+			if !df.IsNullAt(col, row) {
+				t.Errorf("row %d col %d: not null", row, col)
+			}
+			v, err := df.FieldAt(col, row)
+			if err != nil {
+				t.Fatalf("row %d col %d: %v", row, col, err)
+			}
+			if f, ok := v.(float64); ok {
+				if !math.IsNaN(f) {
+					t.Errorf("row %d col %d: got %v, want NaN", row, col, f)
+				}
+				continue
+			}
+			if !reflect.DeepEqual(v, want[col]) {
+				t.Errorf("row %d col %d: got %#v, want %#v", row, col, v, want[col])
+			}
+		}
+	}
+	for col := range df.Columns {
+		if df.IsNullAt(col, 0) {
+			t.Errorf("row 0 col %d: unexpected null", col)
+		}
+	}
+
+	// struct decoding skips null values and keeps the previous field value
+	var r decodeRow
+	if err := df.DecodeAt(0, &r); err != nil {
+		t.Fatal(err)
+	}
+	first := r
+	if err := df.DecodeAt(1, &r); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(r, first) {
+		t.Errorf("null row changed fields: %#v != %#v", r, first)
+	}
+	var z decodeRow
+	if err := df.DecodeAt(2, &z); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(z, decodeRow{}) {
+		t.Errorf("null row: got %#v, want zero value", z)
+	}
+
+	// column access
+	_, v, err := df.Column("f")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f := v.([]float64); f[0] != 1.5 || !math.IsNaN(f[1]) || !math.IsNaN(f[2]) {
+		t.Errorf("float column: got %v", f)
+	}
+}
+
+func TestSplitColumns(t *testing.T) {
+	var tests = []struct {
+		in   string
+		want []string
+	}{
+		{``, []string{``}},
+		{`1,2,3`, []string{`1`, `2`, `3`}},
+		{`"a,b",2`, []string{`"a,b"`, `2`}},
+		{`1,"a,b","c"`, []string{`1`, `"a,b"`, `"c"`}},
+		{`"a\",b",null`, []string{`"a\",b"`, `null`}},
+		{`"a\\",b`, []string{`"a\\"`, `b`}},
+		{`"",","`, []string{`""`, `","`}},
+	}
+	for _, test := range tests {
+		var got []string
+		for _, c := range splitColumns([]byte(test.in), ',') {
+			got = append(got, string(c))
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("split %s: got %q, want %q", test.in, got, test.want)
+		}
+		// column lookup agrees with splitting, like stripArray the last
+		// column ends one byte past the slice
+		b := []byte(test.in + "]")[:len(test.in)]
+		for n, w := range test.want {
+			if n == len(test.want)-1 {
+				w += "]"
+			}
+			start, end := indexByteColumnN(b, ',', n)
+			if start < 0 || string(b[start:end]) != w {
+				t.Errorf("column %d of %s: got [%d:%d], want %s", n, test.in, start, end, w)
+			}
+		}
+	}
+}
+
+func TestDecodeQuotedComma(t *testing.T) {
+	df := &Dataframe{
+		Columns: decodeColumns[:2],
+		Data: []json.RawMessage{
+			json.RawMessage(`["a,\"b\",c","ff"]`),
+		},
+	}
+	var r decodeRow
+	if err := df.DecodeAt(0, &r); err != nil {
+		t.Fatal(err)
+	}
+	if r.S != `a,"b",c` || !reflect.DeepEqual(r.B, []byte{0xff}) {
+		t.Errorf("got %#v", r)
+	}
+	v, err := df.FieldAt(1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(v, []byte{0xff}) {
+		t.Errorf("bytes: got %#v", v)
+	}
+}
+
+func TestAggStdPooled(t *testing.T) {
+	// two buckets of raw samples and their summaries
+	a := []float64{1, 2, 4}
+	b := []float64{3, 7}
+	var vals []interface{}
+	var idx []int
+	for _, f := range append(append([]float64(nil), a...), b...) {
+		idx = append(idx, len(vals))
+		vals = append(vals, f)
+	}
+	raw := aggregate(AggStd, FieldTypeFloat64, vals, idx, nil, nil).(float64)
+
+	var stds, counts, means []interface{}
+	for _, s := range [][]float64{a, b} {
+		v := make([]interface{}, len(s))
+		x := make([]int, len(s))
+		var sum float64
+		for i, f := range s {
+			v[i], x[i] = f, i
+			sum += f
+		}
+		stds = append(stds, aggregate(AggStd, FieldTypeFloat64, v, x, nil, nil))
+		counts = append(counts, float64(len(s)))
+		means = append(means, sum/float64(len(s)))
+	}
+	pooled := aggregate(AggStd, FieldTypeFloat64, stds, []int{0, 1}, counts, means).(float64)
+
+	// sample std of 1,2,4,3,7
+	if want := math.Sqrt(5.3); math.Abs(raw-want) > 1e-12 {
+		t.Errorf("raw std %v, want %v", raw, want)
+	}
+	if math.Abs(pooled-raw) > 1e-12 {
+		t.Errorf("pooled std %v, want %v", pooled, raw)
+	}
+}
@@ -0,0 +1,335 @@
+// Copyright (c) 2020 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package blockwatch
+
+import (
+	"container/heap"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// describeExactLimit is the number of distinct values per column that are
+	// counted exactly, beyond this limit the distinct count is estimated.
+	describeExactLimit = 1 << 16
+
+	// describeSketchSize is the number of hashes kept for estimating distinct
+	// counts.
+	describeSketchSize = 1024
+
+	// describeTopN is the number of most frequent values reported for string
+	// columns.
+	describeTopN = 5
+)
+
+// ValueCount is a value and the number of rows it appears in.
+type ValueCount struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// ColumnSummary holds descriptive statistics for a single column. Min and Max
+// hold values of the column type. Mean, Std and quantiles are only set for
+// numeric columns and are NaN otherwise. Top lists the most frequent values
+// of string columns. Span is the time covered by date and datetime columns.
+type ColumnSummary struct {
+	Code          string        `json:"code"`
+	Name          string        `json:"name"`
+	Type          FieldType     `json:"type"`
+	Count         int           `json:"count"`
+	Nulls         int           `json:"nulls"`
+	Distinct      int           `json:"distinct"`
+	DistinctExact bool          `json:"distinct_exact"`
+	Min           interface{}   `json:"min"`
+	Max           interface{}   `json:"max"`
+	Mean          float64       `json:"mean"`
+	Std           float64       `json:"std"`
+	Q25           float64       `json:"q25"`
+	Median        float64       `json:"median"`
+	Q75           float64       `json:"q75"`
+	Top           []ValueCount  `json:"top,omitempty"`
+	Span          time.Duration `json:"span,omitempty"`
+}
+
+// MarshalJSON encodes NaN statistics as null.
+func (s ColumnSummary) MarshalJSON() ([]byte, error) {
+	type alias ColumnSummary
+	nullable := func(f float64) *float64 {
+		if math.IsNaN(f) {
+			return nil
+		}
+		return &f
+	}
+	return json.Marshal(struct {
+		alias
+		Mean   *float64 `json:"mean"`
+		Std    *float64 `json:"std"`
+		Q25    *float64 `json:"q25"`
+		Median *float64 `json:"median"`
+		Q75    *float64 `json:"q75"`
+	}{
+		alias:  alias(s),
+		Mean:   nullable(s.Mean),
+		Std:    nullable(s.Std),
+		Q25:    nullable(s.Q25),
+		Median: nullable(s.Median),
+		Q75:    nullable(s.Q75),
+	})
+}
+
+// Description is the result of Dataframe.Describe.
+type Description struct {
+	Rows    int              `json:"rows"`
+	Columns []*ColumnSummary `json:"columns"`
+}
+
+// Describe profiles all columns of a dataframe. Distinct counts are exact up
+// to 65536 distinct values per column and estimated beyond.
+func (t *Dataframe) Describe() (*Description, error) {
+	if err := t.initType(nil); err != nil {
+		return nil, err
+	}
+	d := &Description{
+		Rows:    len(t.Data),
+		Columns: make([]*ColumnSummary, len(t.Columns)),
+	}
+	for i := range t.Columns {
+		s, err := t.describeColumn(i)
+		if err != nil {
+			return nil, err
+		}
+		d.Columns[i] = s
+	}
+	return d, nil
+}
+
+func (t *Dataframe) describeColumn(col int) (*ColumnSummary, error) {
+	field := t.Columns[col]
+	s := &ColumnSummary{
+		Code:          field.Code,
+		Name:          field.Name,
+		Type:          field.Type,
+		Mean:          math.NaN(),
+		Std:           math.NaN(),
+		Q25:           math.NaN(),
+		Median:        math.NaN(),
+		Q75:           math.NaN(),
+		DistinctExact: true,
+	}
+	vals, err := t.columnValues(col)
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int)
+	sketch := &hashSketch{}
+	nums := make([]float64, 0)
+	for _, v := range vals {
+		if v == nil {
+			s.Nulls++
+			continue
+		}
+		if f, ok := v.(float64); ok && math.IsNaN(f) {
+			s.Nulls++
+			continue
+		}
+		s.Count++
+		key := keyString([]interface{}{v})
+		sketch.add(key)
+		if _, ok := counts[key]; ok || len(counts) < describeExactLimit {
+			counts[key]++
+		} else {
+			s.DistinctExact = false
+		}
+		if s.Min == nil || compareValues(field.Type, v, s.Min) < 0 {
+			s.Min = v
+		}
+		if s.Max == nil || compareValues(field.Type, v, s.Max) > 0 {
+			s.Max = v
+		}
+		if f, ok := toFloat64(v); ok {
+			nums = append(nums, f)
+		}
+	}
+	if s.DistinctExact {
+		s.Distinct = len(counts)
+	} else {
+		s.Distinct = sketch.estimate()
+	}
+
+	switch field.Type {
+	case FieldTypeFloat64, FieldTypeInt64, FieldTypeUint64:
+		if len(nums) == 0 {
+			break
+		}
+		var sum, sum2 float64
+		for _, f := range nums {
+			sum += f
+		}
+		s.Mean = sum / float64(len(nums))
+		for _, f := range nums {
+			sum2 += (f - s.Mean) * (f - s.Mean)
+		}
+		if len(nums) > 1 {
+			s.Std = math.Sqrt(sum2 / float64(len(nums)-1))
+		}
+		sort.Float64s(nums)
+		s.Q25 = quantileSorted(nums, 0.25)
+		s.Median = quantileSorted(nums, 0.5)
+		s.Q75 = quantileSorted(nums, 0.75)
+	case FieldTypeString:
+		s.Top = make([]ValueCount, 0, len(counts))
+		for k, n := range counts {
+			s.Top = append(s.Top, ValueCount{Value: k, Count: n})
+		}
+		sort.Slice(s.Top, func(i, j int) bool {
+			if s.Top[i].Count != s.Top[j].Count {
+				return s.Top[i].Count > s.Top[j].Count
+			}
+			return s.Top[i].Value < s.Top[j].Value
+		})
+		if len(s.Top) > describeTopN {
+			s.Top = s.Top[:describeTopN]
+		}
+	case FieldTypeDate, FieldTypeDatetime:
+		if s.Min != nil {
+			s.Span = s.Max.(time.Time).Sub(s.Min.(time.Time))
+		}
+	}
+	return s, nil
+}
+
+// Dataframe returns the description as a dataframe with one row per column,
+// e.g. for printing or exporting. Min, max and top values are formatted as
+// strings.
+func (d *Description) Dataframe() (*Dataframe, error) {
+	t := NewDataframe(
+		Datafield{Name: "Column", Code: "column", Type: FieldTypeString},
+		Datafield{Name: "Type", Code: "type", Type: FieldTypeString},
+		Datafield{Name: "Count", Code: "count", Type: FieldTypeInt64},
+		Datafield{Name: "Nulls", Code: "nulls", Type: FieldTypeInt64},
+		Datafield{Name: "Distinct", Code: "distinct", Type: FieldTypeString},
+		Datafield{Name: "Min", Code: "min", Type: FieldTypeString},
+		Datafield{Name: "Max", Code: "max", Type: FieldTypeString},
+		Datafield{Name: "Mean", Code: "mean", Type: FieldTypeFloat64},
+		Datafield{Name: "Std", Code: "std", Type: FieldTypeFloat64},
+		Datafield{Name: "25%", Code: "q25", Type: FieldTypeFloat64},
+		Datafield{Name: "50%", Code: "median", Type: FieldTypeFloat64},
+		Datafield{Name: "75%", Code: "q75", Type: FieldTypeFloat64},
+		Datafield{Name: "Top", Code: "top", Type: FieldTypeString},
+		Datafield{Name: "Span", Code: "span", Type: FieldTypeString},
+	)
+	for _, c := range d.Columns {
+		distinct := strconv.Itoa(c.Distinct)
+		if !c.DistinctExact {
+			distinct = "~" + distinct
+		}
+		top := make([]string, len(c.Top))
+		for i, v := range c.Top {
+			top[i] = fmt.Sprintf("%s (%d)", v.Value, v.Count)
+		}
+		var span string
+		if c.Span > 0 {
+			span = c.Span.String()
+		}
+		err := t.Append(
+			c.Code,
+			c.Type.String(),
+			c.Count,
+			c.Nulls,
+			distinct,
+			formatSummaryValue(c.Min),
+			formatSummaryValue(c.Max),
+			c.Mean,
+			c.Std,
+			c.Q25,
+			c.Median,
+			c.Q75,
+			strings.Join(top, ", "),
+			span,
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+func formatSummaryValue(v interface{}) string {
+	switch x := v.(type) {
+	case nil:
+		return ""
+	case time.Time:
+		return x.Format(time.RFC3339)
+	case []byte:
+		return hex.EncodeToString(x)
+	case float64:
+		return strconv.FormatFloat(x, 'g', -1, 64)
+	default:
+		return fmt.Sprint(x)
+	}
+}
+
+// hashSketch estimates the number of distinct values from the k smallest
+// value hashes (KMV sketch).
+type hashSketch struct {
+	h    maxHeap
+	seen map[uint64]struct{}
+}
+
+func (s *hashSketch) add(key string) {
+	f := fnv.New64a()
+	f.Write([]byte(key))
+	// mix bits, FNV distributes short similar keys poorly
+	x := f.Sum64()
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	if s.seen == nil {
+		s.seen = make(map[uint64]struct{}, describeSketchSize)
+	}
+	if _, ok := s.seen[x]; ok {
+		return
+	}
+	if len(s.h) < describeSketchSize {
+		heap.Push(&s.h, x)
+		s.seen[x] = struct{}{}
+		return
+	}
+	if x >= s.h[0] {
+		return
+	}
+	delete(s.seen, s.h[0])
+	s.h[0] = x
+	heap.Fix(&s.h, 0)
+	s.seen[x] = struct{}{}
+}
+
+func (s *hashSketch) estimate() int {
+	if len(s.h) < describeSketchSize {
+		return len(s.h)
+	}
+	return int(float64(describeSketchSize-1) / (float64(s.h[0]) / math.MaxUint64))
+}
+
+type maxHeap []uint64
+
+func (h maxHeap) Len() int            { return len(h) }
+func (h maxHeap) Less(i, j int) bool  { return h[i] > h[j] }
+func (h maxHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *maxHeap) Push(x interface{}) { *h = append(*h, x.(uint64)) }
+func (h *maxHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
@@ -0,0 +1,157 @@
+// Copyright (c) 2020 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package blockwatch
+
+import (
+	"encoding/json"
+	"math"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDescribe(t *testing.T) {
+	h := time.Hour
+	cols := []Datafield{
+		{Code: "time", Type: FieldTypeDatetime},
+		{Name: "Value", Code: "v", Type: FieldTypeFloat64},
+		{Code: "s", Type: FieldTypeString},
+	}
+	df := newTestSeries(t, cols, [][]interface{}{
+		{0 * h, 1.0, "a"},
+		{1 * h, 2.0, "b"},
+		{3 * h, nil, "a"},
+		{2 * h, math.NaN(), "c"},
+		{h / 2, 4.0, "b"},
+		{5 * h, 5.0, "a"},
+		{6 * h, nil, "d"},
+		{8 * h, nil, "f"},
+		{7 * h, nil, "e"},
+	}).Dataframe
+	desc, err := df.Describe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if desc.Rows != 9 || len(desc.Columns) != 3 {
+		t.Fatalf("got %d rows and %d columns", desc.Rows, len(desc.Columns))
+	}
+
+	v := desc.Columns[1]
+	if v.Code != "v" || v.Name != "Value" || v.Count != 4 || v.Nulls != 5 || v.Distinct != 4 || !v.DistinctExact {
+		t.Errorf("v: got %+v", v)
+	}
+	if v.Min != 1.0 || v.Max != 5.0 {
+		t.Errorf("v: got min %v max %v", v.Min, v.Max)
+	}
+	for _, x := range [][2]float64{
+		{v.Mean, 3},
+		{v.Std, math.Sqrt(10.0 / 3)},
+		{v.Q25, 1.75},
+		{v.Median, 3},
+		{v.Q75, 4.25},
+	} {
+		if math.Abs(x[0]-x[1]) > 1e-9 {
+			t.Errorf("v: got %v, want %v", x[0], x[1])
+		}
+	}
+
+	// top values are ordered by count, then value, and limited to five
+	s := desc.Columns[2]
+	want := []ValueCount{{"a", 3}, {"b", 2}, {"c", 1}, {"d", 1}, {"e", 1}}
+	if s.Count != 9 || s.Distinct != 6 || len(s.Top) != len(want) {
+		t.Fatalf("s: got %+v", s)
+	}
+	for i := range want {
+		if s.Top[i] != want[i] {
+			t.Errorf("s: got top %v, want %v", s.Top, want)
+			break
+		}
+	}
+	if !math.IsNaN(s.Mean) || s.Span != 0 {
+		t.Errorf("s: got mean %v span %v", s.Mean, s.Span)
+	}
+
+	ts := desc.Columns[0]
+	if ts.Span != 8*h || !ts.Min.(time.Time).Equal(resampleTime) || !math.IsNaN(ts.Mean) {
+		t.Errorf("time: got %+v", ts)
+	}
+
+	// NaN statistics are encoded as null
+	buf, err := json.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(buf), `"mean":null`) || !strings.Contains(string(buf), `"top":[{"value":"a","count":3}`) {
+		t.Errorf("got json %s", buf)
+	}
+
+	res, err := desc.Dataframe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkRows(t, res, [][]interface{}{
+		{"time", "datetime", int64(9), int64(0), "9", "2020-01-02T00:00:00Z", "2020-01-02T08:00:00Z",
+			nil, nil, nil, nil, nil, "", "8h0m0s"},
+		{"v", "float64", int64(4), int64(5), "4", "1", "5", 3.0, math.Sqrt(10.0 / 3), 1.75, 3.0, 4.25, "", ""},
+		{"s", "string", int64(9), int64(0), "6", "a", "f", nil, nil, nil, nil, nil,
+			"a (3), b (2), c (1), d (1), e (1)", ""},
+	})
+}
+
+func TestDescribeDistinctEstimate(t *testing.T) {
+	// beyond the exact limit distinct counts are estimated from the sketch
+	n := describeExactLimit + 20000
+	df := NewDataframe(Datafield{Code: "id", Type: FieldTypeInt64})
+	for i := 0; i < n; i++ {
+		if err := df.Append(int64(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// duplicates do not change the estimate
+	for i := 0; i < 1000; i++ {
+		if err := df.Append(int64(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	desc, err := df.Describe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := desc.Columns[0]
+	if c.DistinctExact {
+		t.Error("got exact distinct count beyond the limit")
+	}
+	// the relative error of a KMV sketch with k hashes is about 1/sqrt(k)
+	if e := math.Abs(float64(c.Distinct-n)) / float64(n); e > 0.1 {
+		t.Errorf("got distinct estimate %d for %d values", c.Distinct, n)
+	}
+	res, err := desc.Dataframe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d, _ := res.FieldAt(4, 0); d != "~"+strconv.Itoa(c.Distinct) {
+		t.Errorf("got distinct %v", d)
+	}
+}
+
+func TestHashSketch(t *testing.T) {
+	for _, n := range []int{0, 1, 500, describeSketchSize - 1, describeSketchSize, 10000, 200000} {
+		s := &hashSketch{}
+		for i := 0; i < n; i++ {
+			s.add(strconv.Itoa(i))
+			s.add(strconv.Itoa(i))
+		}
+		got := s.estimate()
+		if n < describeSketchSize {
+			if got != n {
+				t.Errorf("%d keys: got estimate %d, want exact count", n, got)
+			}
+			continue
+		}
+		if e := math.Abs(float64(got-n)) / float64(n); e > 0.1 {
+			t.Errorf("%d keys: got estimate %d", n, got)
+		}
+	}
+}
@@ -17,6 +17,8 @@ import (
 	"time"
 
 	"blockwatch.cc/blockwatch-go"
+	"blockwatch.cc/blockwatch-go/arrow"
+	"blockwatch.cc/blockwatch-go/parquet"
 )
 
 var (
@@ -27,7 +29,12 @@ var (
 	code     string
 	columns  string
 	collapse string
+	filter   string
+	with     string
 	limit    int
+	csvout   bool
+	pqout    string
+	arrowout string
 )
 
 var ()
@@ -39,6 +46,7 @@ Available Commands:
   list-fields         list all datafields in a given dataset
   series              show time-series data
   table               show table data
+  describe            show descriptive statistics for table or series data
   parse-table         parse table into blockchain BLOCK struct
   parse-table-column  parse first table column
 `
@@ -50,6 +58,11 @@ func init() {
 	flags.IntVar(&limit, "limit", 5, "row limit")
 	flags.StringVar(&columns, "columns", "", "list of columns")
 	flags.StringVar(&collapse, "collapse", "", "collapse mode for time-series (1m, 1h, 1d)")
+	flags.StringVar(&filter, "filter", "", "filter expression (e.g. 'height >= 500000 and n_tx > 100')")
+	flags.BoolVar(&csvout, "csv", false, "print table and series data as CSV")
+	flags.StringVar(&pqout, "parquet", "", "write table and series data as Parquet to file")
+	flags.StringVar(&arrowout, "arrow", "", "write table and series data as Arrow IPC file")
+	flags.StringVar(&with, "with", "", "derived columns separated by ';' (e.g. 'ret=close/open-1;fpv=fee/vsize')")
 }
 
 func printhelp() {
@@ -105,6 +118,8 @@ func run() error {
 		return fetchTable(ctx, c)
 	case "series":
 		return fetchSeries(ctx, c)
+	case "describe":
+		return describeData(ctx, c)
 	case "parse-table":
 		return parseTable(ctx, c)
 	case "parse-table-column":
@@ -184,13 +199,30 @@ func fetchTable(ctx context.Context, c *blockwatch.Client) error {
 	if len(cf) != 2 {
 		return fmt.Errorf("invalid dataset code")
 	}
+	filters, err := blockwatch.ParseFilterExpr(filter)
+	if err != nil {
+		return err
+	}
 	table, err := c.GetTable(ctx, cf[0], cf[1], blockwatch.TableParams{
 		Limit:   limit,
 		Columns: strings.Split(columns, ","),
+		Filter:  filters,
 	})
 	if err != nil {
 		return err
 	}
+	if err := withColumns(&table.Dataframe); err != nil {
+		return err
+	}
+	if pqout != "" {
+		return writeParquet(&table.Dataframe)
+	}
+	if arrowout != "" {
+		return writeArrow(&table.Dataframe)
+	}
+	if csvout {
+		return table.WriteCSV(os.Stdout, blockwatch.CSVOptions{})
+	}
 	fmt.Printf("%s", dumpData(table.Dataframe))
 	return nil
 }
@@ -288,20 +320,132 @@ func fetchSeries(ctx context.Context, c *blockwatch.Client) error {
 	if len(cf) != 2 {
 		return fmt.Errorf("invalid dataset code")
 	}
+	filters, err := blockwatch.ParseFilterExpr(filter)
+	if err != nil {
+		return err
+	}
 	series, err := c.GetSeries(ctx, cf[0], cf[1], blockwatch.SeriesParams{
 		Limit:    limit,
 		Columns:  strings.Split(columns, ","),
 		Collapse: blockwatch.ParseCollapseModeIgnoreError(collapse),
+		Filter:   filters,
 	})
 	if err != nil {
 		return err
 	}
+	if err := withColumns(&series.Dataframe); err != nil {
+		return err
+	}
+	if pqout != "" {
+		return writeParquet(&series.Dataframe)
+	}
+	if arrowout != "" {
+		return writeArrow(&series.Dataframe)
+	}
+	if csvout {
+		return series.WriteCSV(os.Stdout, blockwatch.CSVOptions{})
+	}
 	fmt.Printf("%s", dumpData(series.Dataframe))
 	return nil
 }
 
+func describeData(ctx context.Context, c *blockwatch.Client) error {
+	cf := strings.Split(code, "/")
+	if len(cf) != 2 {
+		return fmt.Errorf("invalid dataset code")
+	}
+	set, err := c.GetDataset(ctx, cf[0], cf[1])
+	if err != nil {
+		return err
+	}
+	filters, err := blockwatch.ParseFilterExpr(filter)
+	if err != nil {
+		return err
+	}
+	var frame blockwatch.Dataframe
+	if set.Type == blockwatch.DatasetTypeSeries {
+		series, err := c.GetSeries(ctx, cf[0], cf[1], blockwatch.SeriesParams{
+			Limit:    limit,
+			Columns:  strings.Split(columns, ","),
+			Collapse: blockwatch.ParseCollapseModeIgnoreError(collapse),
+			Filter:   filters,
+		})
+		if err != nil {
+			return err
+		}
+		frame = series.Dataframe
+	} else {
+		table, err := c.GetTable(ctx, cf[0], cf[1], blockwatch.TableParams{
+			Limit:   limit,
+			Columns: strings.Split(columns, ","),
+			Filter:  filters,
+		})
+		if err != nil {
+			return err
+		}
+		frame = table.Dataframe
+	}
+	if err := withColumns(&frame); err != nil {
+		return err
+	}
+	desc, err := frame.Describe()
+	if err != nil {
+		return err
+	}
+	summary, err := desc.Dataframe()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Described %d rows\n", desc.Rows)
+	fmt.Printf("%s\n", dumpData(*summary))
+	return nil
+}
+
 // helper functions
 
+// withColumns adds derived columns from the -with flag.
+func withColumns(t *blockwatch.Dataframe) error {
+	for _, def := range strings.Split(with, ";") {
+		if strings.TrimSpace(def) == "" {
+			continue
+		}
+		kv := strings.SplitN(def, "=", 2)
+		if len(kv) != 2 {
+			return fmt.Errorf("invalid column definition '%s', expected name=expr", def)
+		}
+		if err := t.WithColumn(strings.TrimSpace(kv[0]), kv[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeParquet writes data to the file from the -parquet flag.
+func writeParquet(t *blockwatch.Dataframe) error {
+	f, err := os.Create(pqout)
+	if err != nil {
+		return err
+	}
+	if err := parquet.Write(f, t, parquet.Options{}); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// writeArrow writes data to the file from the -arrow flag.
+func writeArrow(t *blockwatch.Dataframe) error {
+	f, err := os.Create(arrowout)
+	if err != nil {
+		return err
+	}
+	if err := arrow.Write(f, t, arrow.FormatFile); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
 func contains(slice []string, s string) bool {
 	for _, v := range slice {
 		if v == s {
@@ -321,6 +465,9 @@ func dumpData(t blockwatch.Dataframe) string {
 	}
 	for i := 0; i < rows; i++ {
 		for j := 0; j < cols; j++ {
+			if t.IsNullAt(j, i) {
+				continue
+			}
 			val, err := t.FieldAt(j, i)
 			if err != nil {
 				fmt.Printf("Field %d/%d: %v\n", j, i, err)
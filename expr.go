@@ -0,0 +1,1246 @@
+// Copyright (c) 2020 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package blockwatch
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ExprError is returned when a column expression cannot be parsed or its
+// operand types do not match. Pos is the 1-based character position where
+// the error was detected.
+type ExprError struct {
+	Expr string
+	Pos  int
+	Msg  string
+}
+
+func (e *ExprError) Error() string {
+	return fmt.Sprintf("blockwatch: expression at position %d: %s", e.Pos, e.Msg)
+}
+
+// Expr is a compiled column expression, see ParseExpr.
+type Expr struct {
+	src   string
+	root  exprNode
+	codes []string    // referenced columns
+	types []FieldType // referenced column types
+}
+
+// ParseExpr compiles an expression that derives a value from other columns
+// of the same row, e.g.
+//
+//	close / open - 1
+//	vol_buy_base / vol_base
+//	if(fee > 0 and vsize > 0, fee / vsize, null)
+//
+// Expressions support arithmetic (+ - * / %), comparisons (= == != <> < <=
+// > >=), boolean logic (and or not, && || !), parentheses, number, string,
+// true, false and null literals and the functions abs, sqrt, exp, log, log2,
+// log10, pow, floor, ceil, round(x[, digits]), min, max, if(cond, a, b),
+// coalesce, isnull and lag(col[, n]). lag returns the value of a column n
+// rows earlier in dataframe order (n defaults to 1, negative n looks ahead).
+//
+// The result type is inferred from the column types in fields. Integer
+// arithmetic keeps int64 or uint64, while division and float operands produce
+// float64. Mixed int64 and uint64 operands, uint64 operands with a negative
+// literal and differences of uint64 values result in int64. Datetime columns may be
+// compared, subtracted from each other (resulting in milliseconds) and
+// shifted by integer milliseconds. String literals compared to datetime or
+// bytes columns are parsed as time or hex values.
+//
+// Null values propagate: an operation with a null operand, a division by
+// zero, a math function outside its domain or an integer that does not fit
+// the result type results in null. and/or use
+// three-valued logic, so `false and null` is false and `true or null` is
+// true. if treats a null condition as false.
+func ParseExpr(expr string, fields ...Datafield) (*Expr, error) {
+	p := &exprParser{
+		lex:    newExprLexer(expr),
+		fields: fields,
+		slots:  make(map[string]int),
+	}
+	e := &Expr{src: expr}
+	root, err := p.parse()
+	if err != nil {
+		return nil, err
+	}
+	if root.fieldType() == FieldTypeUndefined {
+		return nil, &ExprError{Expr: expr, Pos: 1, Msg: "expression has no type"}
+	}
+	e.root = root
+	e.codes = p.codes
+	e.types = p.types
+	return e, nil
+}
+
+// String returns the source expression.
+func (e *Expr) String() string {
+	return e.src
+}
+
+// Type returns the inferred result type.
+func (e *Expr) Type() FieldType {
+	return e.root.fieldType()
+}
+
+// Columns returns the codes of all columns referenced by the expression.
+func (e *Expr) Columns() []string {
+	return e.codes
+}
+
+// Eval evaluates the expression for all rows of a dataframe and returns one
+// value per row with nil for null results. Referenced columns must exist with
+// the same types as at compile time.
+func (e *Expr) Eval(t *Dataframe) ([]interface{}, error) {
+	if err := t.initType(nil); err != nil {
+		return nil, err
+	}
+	env := &exprEnv{cols: make([][]interface{}, len(e.codes))}
+	for i, code := range e.codes {
+		col := t.columnIndex(code)
+		if col < 0 {
+			return nil, fmt.Errorf("blockwatch: expression '%s': missing column '%s'", e.src, code)
+		}
+		if typ := t.Columns[col].Type; typ != e.types[i] {
+			return nil, fmt.Errorf("blockwatch: expression '%s': column '%s' has type %s, expected %s", e.src, code, typ, e.types[i])
+		}
+		vals, err := t.columnValues(col)
+		if err != nil {
+			return nil, err
+		}
+		env.cols[i] = vals
+	}
+	res := make([]interface{}, len(t.Data))
+	for i := range res {
+		res[i] = e.root.eval(env, i)
+	}
+	return res, nil
+}
+
+// WithColumn adds a column computed from an expression over other columns of
+// the same row, see ParseExpr for the syntax. name is used as column code and
+// name, an existing column with the same code is replaced. On error the
+// dataframe is left unchanged.
+func (t *Dataframe) WithColumn(name, expr string) error {
+	if err := t.initType(nil); err != nil {
+		return err
+	}
+	e, err := ParseExpr(expr, t.Columns...)
+	if err != nil {
+		return err
+	}
+	vals, err := e.Eval(t)
+	if err != nil {
+		return err
+	}
+	return t.AddColumn(Datafield{Name: name, Code: name, Type: e.Type()}, vals)
+}
+
+// exprEnv holds decoded values of referenced columns during evaluation.
+type exprEnv struct {
+	cols [][]interface{}
+}
+
+type exprNode interface {
+	fieldType() FieldType
+	eval(env *exprEnv, row int) interface{}
+}
+
+// exprLiteral is a constant. Integer literals are untyped and adopt the type
+// of the other operand, null literals have no type.
+type exprLiteral struct {
+	typ     FieldType
+	val     interface{}
+	untyped bool
+}
+
+func (n *exprLiteral) fieldType() FieldType                   { return n.typ }
+func (n *exprLiteral) eval(env *exprEnv, row int) interface{} { return n.val }
+
+// exprColumn reads a column value, optionally from a previous row.
+type exprColumn struct {
+	typ  FieldType
+	slot int
+	lag  int
+}
+
+func (n *exprColumn) fieldType() FieldType { return n.typ }
+
+func (n *exprColumn) eval(env *exprEnv, row int) interface{} {
+	vals := env.cols[n.slot]
+	row -= n.lag
+	if row < 0 || row >= len(vals) {
+		return nil
+	}
+	return vals[row]
+}
+
+type exprUnary struct {
+	op  string
+	x   exprNode
+	typ FieldType
+}
+
+func (n *exprUnary) fieldType() FieldType { return n.typ }
+
+func (n *exprUnary) eval(env *exprEnv, row int) interface{} {
+	v := n.x.eval(env, row)
+	if v == nil {
+		return nil
+	}
+	if n.op == "not" {
+		return !v.(bool)
+	}
+	switch x := convertExprValue(n.typ, v).(type) {
+	case float64:
+		return -x
+	case int64:
+		return -x
+	default:
+		return nil
+	}
+}
+
+// exprBinary applies an operator to two operands which are converted to
+// arg before evaluation.
+type exprBinary struct {
+	op   string
+	x, y exprNode
+	typ  FieldType
+	arg  FieldType
+}
+
+func (n *exprBinary) fieldType() FieldType { return n.typ }
+
+func (n *exprBinary) eval(env *exprEnv, row int) interface{} {
+	a := n.x.eval(env, row)
+	switch n.op {
+	case "and":
+		if a == false {
+			return false
+		}
+		b := n.y.eval(env, row)
+		if b == false {
+			return false
+		}
+		if a == nil || b == nil {
+			return nil
+		}
+		return true
+	case "or":
+		if a == true {
+			return true
+		}
+		b := n.y.eval(env, row)
+		if b == true {
+			return true
+		}
+		if a == nil || b == nil {
+			return nil
+		}
+		return false
+	}
+	if a == nil {
+		return nil
+	}
+	b := n.y.eval(env, row)
+	if b == nil {
+		return nil
+	}
+	if n.typ == FieldTypeBoolean {
+		c, ok := 0, false
+		if n.arg == FieldTypeInt64 {
+			c, ok = compareInts(a, b)
+		}
+		if !ok {
+			a, b = convertExprValue(n.arg, a), convertExprValue(n.arg, b)
+			if a == nil || b == nil {
+				return nil
+			}
+			c = compareValues(n.arg, a, b)
+		}
+		switch n.op {
+		case "=":
+			return c == 0
+		case "!=":
+			return c != 0
+		case "<":
+			return c < 0
+		case "<=":
+			return c <= 0
+		case ">":
+			return c > 0
+		default:
+			return c >= 0
+		}
+	}
+	a, b = convertExprValue(n.arg, a), convertExprValue(n.arg, b)
+	if a == nil || b == nil {
+		return nil
+	}
+	switch x := a.(type) {
+	case float64:
+		y := b.(float64)
+		switch n.op {
+		case "+":
+			return exprFloat(x + y)
+		case "-":
+			return exprFloat(x - y)
+		case "*":
+			return exprFloat(x * y)
+		case "/":
+			return exprFloat(x / y)
+		case "%":
+			return exprFloat(math.Mod(x, y))
+		}
+	case int64:
+		y := b.(int64)
+		switch n.op {
+		case "+":
+			return x + y
+		case "-":
+			return x - y
+		case "*":
+			return x * y
+		case "%":
+			if y == 0 {
+				return nil
+			}
+			return x % y
+		}
+	case uint64:
+		y := b.(uint64)
+		switch n.op {
+		case "+":
+			return x + y
+		case "-":
+			return x - y
+		case "*":
+			return x * y
+		case "%":
+			if y == 0 {
+				return nil
+			}
+			return x % y
+		}
+	case string:
+		return x + b.(string)
+	case time.Time:
+		// time - time, time +/- milliseconds
+		switch y := b.(type) {
+		case time.Time:
+			return x.Sub(y).Milliseconds()
+		default:
+			ms, _ := toInt64(y)
+			if n.op == "-" {
+				ms = -ms
+			}
+			return x.Add(time.Duration(ms) * time.Millisecond)
+		}
+	}
+	return nil
+}
+
+// compareInts compares a uint64 value beyond the int64 range with an int64
+// value, which does not fit a common integer type.
+func compareInts(a, b interface{}) (int, bool) {
+	if x, ok := a.(uint64); ok && x > math.MaxInt64 {
+		if _, ok := b.(int64); ok {
+			return 1, true
+		}
+	}
+	if y, ok := b.(uint64); ok && y > math.MaxInt64 {
+		if _, ok := a.(int64); ok {
+			return -1, true
+		}
+	}
+	return 0, false
+}
+
+// exprCall calls a function. Strict functions return null when any argument
+// is null.
+type exprCall struct {
+	name   string
+	args   []exprNode
+	typ    FieldType
+	strict bool
+	fn     func(args []interface{}) interface{}
+}
+
+func (n *exprCall) fieldType() FieldType { return n.typ }
+
+func (n *exprCall) eval(env *exprEnv, row int) interface{} {
+	vals := make([]interface{}, len(n.args))
+	for i, a := range n.args {
+		vals[i] = a.eval(env, row)
+		if vals[i] == nil && n.strict {
+			return nil
+		}
+	}
+	return n.fn(vals)
+}
+
+// exprFloat turns NaN and infinite results into null.
+func exprFloat(f float64) interface{} {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return nil
+	}
+	return f
+}
+
+// convertExprValue converts numeric values to the Go type of typ and returns
+// nil when an integer is out of range. Times are left unchanged so that time
+// arithmetic can see both operands.
+func convertExprValue(typ FieldType, v interface{}) interface{} {
+	switch typ {
+	case FieldTypeFloat64:
+		f, _ := toFloat64(v)
+		return f
+	case FieldTypeInt64:
+		i, ok := toInt64(v)
+		if !ok {
+			return nil
+		}
+		return i
+	case FieldTypeUint64:
+		u, ok := toUint64(v)
+		if !ok {
+			return nil
+		}
+		return u
+	default:
+		return v
+	}
+}
+
+func isNumericType(typ FieldType) bool {
+	switch typ {
+	case FieldTypeFloat64, FieldTypeInt64, FieldTypeUint64:
+		return true
+	default:
+		return false
+	}
+}
+
+func isIntegerType(typ FieldType) bool {
+	return typ == FieldTypeInt64 || typ == FieldTypeUint64
+}
+
+func isTimeType(typ FieldType) bool {
+	return typ == FieldTypeDate || typ == FieldTypeDatetime
+}
+
+func isUntyped(n exprNode) bool {
+	l, ok := n.(*exprLiteral)
+	return ok && l.untyped
+}
+
+func isNegativeLiteral(n exprNode) bool {
+	l, ok := n.(*exprLiteral)
+	if !ok {
+		return false
+	}
+	i, ok := l.val.(int64)
+	return ok && i < 0
+}
+
+// commonType returns the type both operands are converted to before they are
+// combined or compared.
+func commonType(x, y exprNode) (FieldType, bool) {
+	a, b := x.fieldType(), y.fieldType()
+	switch true {
+	case a == FieldTypeUndefined:
+		return b, true
+	case b == FieldTypeUndefined, a == b:
+		return a, true
+	case isTimeType(a) && isTimeType(b):
+		return FieldTypeDatetime, true
+	case !isNumericType(a) || !isNumericType(b):
+		return FieldTypeUndefined, false
+	case a == FieldTypeFloat64 || b == FieldTypeFloat64:
+		return FieldTypeFloat64, true
+	case isUntyped(x) && !(b == FieldTypeUint64 && isNegativeLiteral(x)):
+		return b, true
+	case isUntyped(y) && !(a == FieldTypeUint64 && isNegativeLiteral(y)):
+		return a, true
+	default:
+		return FieldTypeInt64, true
+	}
+}
+
+// exprLexer splits an expression into tokens. Numbers are returned as words.
+type exprLexer struct {
+	input string
+	pos   int // byte offset
+	rpos  int // 1-based rune position of the next rune
+	peek  *filterToken
+}
+
+func newExprLexer(s string) *exprLexer {
+	return &exprLexer{input: s, rpos: 1}
+}
+
+func (l *exprLexer) errorf(pos int, format string, args ...interface{}) error {
+	return &ExprError{
+		Expr: l.input,
+		Pos:  pos,
+		Msg:  fmt.Sprintf(format, args...),
+	}
+}
+
+func (l *exprLexer) next() (filterToken, error) {
+	if l.peek != nil {
+		t := *l.peek
+		l.peek = nil
+		return t, nil
+	}
+	return l.scan()
+}
+
+func (l *exprLexer) unread(t filterToken) {
+	l.peek = &t
+}
+
+func (l *exprLexer) current() rune {
+	r, _ := utf8.DecodeRuneInString(l.input[l.pos:])
+	return r
+}
+
+func (l *exprLexer) read() rune {
+	r, n := utf8.DecodeRuneInString(l.input[l.pos:])
+	l.pos += n
+	l.rpos++
+	return r
+}
+
+func (l *exprLexer) scan() (filterToken, error) {
+	for l.pos < len(l.input) && unicode.IsSpace(l.current()) {
+		l.read()
+	}
+	start := l.rpos
+	if l.pos >= len(l.input) {
+		return filterToken{typ: tokEOF, pos: start}, nil
+	}
+	r := l.read()
+	switch true {
+	case r == '(':
+		return filterToken{typ: tokLParen, val: "(", pos: start}, nil
+	case r == ')':
+		return filterToken{typ: tokRParen, val: ")", pos: start}, nil
+	case r == ',':
+		return filterToken{typ: tokComma, val: ",", pos: start}, nil
+	case r == '"' || r == '\'':
+		return l.scanString(r, start)
+	case strings.ContainsRune("+-*/%", r):
+		return filterToken{typ: tokOp, val: string(r), pos: start}, nil
+	case strings.ContainsRune("=!<>&|", r):
+		op := string(r)
+		if l.pos < len(l.input) {
+			switch op + string(l.input[l.pos]) {
+			case "==", "!=", "<>", "<=", ">=", "&&", "||":
+				op += string(l.read())
+			}
+		}
+		if op == "&" || op == "|" {
+			return filterToken{}, l.errorf(start, "unexpected character '%s'", op)
+		}
+		return filterToken{typ: tokOp, val: op, pos: start}, nil
+	case unicode.IsDigit(r) || r == '.':
+		buf := []rune{r}
+		for l.pos < len(l.input) {
+			c := l.current()
+			last := buf[len(buf)-1]
+			if !unicode.IsDigit(c) && c != '.' && c != 'e' && c != 'E' &&
+				!((c == '+' || c == '-') && (last == 'e' || last == 'E')) {
+				break
+			}
+			buf = append(buf, l.read())
+		}
+		return filterToken{typ: tokWord, val: string(buf), pos: start}, nil
+	case unicode.IsLetter(r) || r == '_':
+		buf := []rune{r}
+		for l.pos < len(l.input) {
+			c := l.current()
+			if !unicode.IsLetter(c) && !unicode.IsDigit(c) && c != '_' {
+				break
+			}
+			buf = append(buf, l.read())
+		}
+		return filterToken{typ: tokWord, val: string(buf), pos: start}, nil
+	default:
+		return filterToken{}, l.errorf(start, "unexpected character '%c'", r)
+	}
+}
+
+func (l *exprLexer) scanString(quote rune, start int) (filterToken, error) {
+	var b strings.Builder
+	for l.pos < len(l.input) {
+		r := l.read()
+		switch r {
+		case quote:
+			return filterToken{typ: tokString, val: b.String(), pos: start}, nil
+		case '\\':
+			if l.pos >= len(l.input) {
+				return filterToken{}, l.errorf(l.rpos, "unterminated escape sequence")
+			}
+			switch e := l.read(); e {
+			case 'n':
+				b.WriteRune('\n')
+			case 't':
+				b.WriteRune('\t')
+			default:
+				b.WriteRune(e)
+			}
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return filterToken{}, l.errorf(start, "unterminated string")
+}
+
+// exprParser is a recursive descent parser that type checks while parsing.
+//
+//	or      = and { ("or" | "||") and }
+//	and     = not { ("and" | "&&") not }
+//	not     = ("not" | "!") not | compare
+//	compare = sum [ ("=" | "==" | "!=" | "<>" | "<" | "<=" | ">" | ">=") sum ]
+//	sum     = product { ("+" | "-") product }
+//	product = unary { ("*" | "/" | "%") unary }
+//	unary   = "-" unary | primary
+//	primary = literal | column | call | "(" or ")"
+type exprParser struct {
+	lex    *exprLexer
+	fields []Datafield
+	slots  map[string]int
+	codes  []string
+	types  []FieldType
+}
+
+func (p *exprParser) parse() (exprNode, error) {
+	n, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	t, err := p.lex.next()
+	if err != nil {
+		return nil, err
+	}
+	if t.typ != tokEOF {
+		return nil, p.lex.errorf(t.pos, "expected operator or end of expression, got %s", t)
+	}
+	return n, nil
+}
+
+func (p *exprParser) parseOr() (exprNode, error) {
+	x, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t, err := p.lex.next()
+		if err != nil {
+			return nil, err
+		}
+		if !t.isKeyword("or") && !(t.typ == tokOp && t.val == "||") {
+			p.lex.unread(t)
+			return x, nil
+		}
+		y, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		if x, err = p.logical(t, "or", x, y); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *exprParser) parseAnd() (exprNode, error) {
+	x, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t, err := p.lex.next()
+		if err != nil {
+			return nil, err
+		}
+		if !t.isKeyword("and") && !(t.typ == tokOp && t.val == "&&") {
+			p.lex.unread(t)
+			return x, nil
+		}
+		y, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		if x, err = p.logical(t, "and", x, y); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *exprParser) logical(t filterToken, op string, x, y exprNode) (exprNode, error) {
+	for _, n := range []exprNode{x, y} {
+		if typ := n.fieldType(); typ != FieldTypeBoolean && typ != FieldTypeUndefined {
+			return nil, p.lex.errorf(t.pos, "'%s' requires boolean operands, got %s", op, typ)
+		}
+	}
+	return &exprBinary{op: op, x: x, y: y, typ: FieldTypeBoolean, arg: FieldTypeBoolean}, nil
+}
+
+func (p *exprParser) parseNot() (exprNode, error) {
+	t, err := p.lex.next()
+	if err != nil {
+		return nil, err
+	}
+	if !t.isKeyword("not") && !(t.typ == tokOp && t.val == "!") {
+		p.lex.unread(t)
+		return p.parseCompare()
+	}
+	x, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	if typ := x.fieldType(); typ != FieldTypeBoolean && typ != FieldTypeUndefined {
+		return nil, p.lex.errorf(t.pos, "'not' requires a boolean operand, got %s", typ)
+	}
+	return &exprUnary{op: "not", x: x, typ: FieldTypeBoolean}, nil
+}
+
+func (p *exprParser) parseCompare() (exprNode, error) {
+	x, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+	t, err := p.lex.next()
+	if err != nil {
+		return nil, err
+	}
+	var op string
+	switch t.val {
+	case "=", "==":
+		op = "="
+	case "!=", "<>":
+		op = "!="
+	case "<", "<=", ">", ">=":
+		op = t.val
+	}
+	if t.typ != tokOp || op == "" {
+		p.lex.unread(t)
+		return x, nil
+	}
+	y, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+	// parse string literals compared to time and bytes columns
+	if x, err = p.coerce(t, x, y.fieldType()); err != nil {
+		return nil, err
+	}
+	if y, err = p.coerce(t, y, x.fieldType()); err != nil {
+		return nil, err
+	}
+	typ, ok := commonType(x, y)
+	if !ok {
+		return nil, p.lex.errorf(t.pos, "cannot compare %s and %s", x.fieldType(), y.fieldType())
+	}
+	return &exprBinary{op: op, x: x, y: y, typ: FieldTypeBoolean, arg: typ}, nil
+}
+
+func (p *exprParser) coerce(t filterToken, n exprNode, typ FieldType) (exprNode, error) {
+	l, ok := n.(*exprLiteral)
+	if !ok || l.typ != FieldTypeString {
+		return n, nil
+	}
+	switch typ {
+	case FieldTypeDate, FieldTypeDatetime, FieldTypeBytes:
+		v, err := parseFieldValue(typ, l.val.(string))
+		if err != nil {
+			return nil, p.lex.errorf(t.pos, "invalid %s value %s", typ, strconv.Quote(l.val.(string)))
+		}
+		return &exprLiteral{typ: typ, val: v}, nil
+	default:
+		return n, nil
+	}
+}
+
+func (p *exprParser) parseSum() (exprNode, error) {
+	x, err := p.parseProduct()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t, err := p.lex.next()
+		if err != nil {
+			return nil, err
+		}
+		if t.typ != tokOp || (t.val != "+" && t.val != "-") {
+			p.lex.unread(t)
+			return x, nil
+		}
+		y, err := p.parseProduct()
+		if err != nil {
+			return nil, err
+		}
+		if x, err = p.arith(t, x, y); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *exprParser) parseProduct() (exprNode, error) {
+	x, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t, err := p.lex.next()
+		if err != nil {
+			return nil, err
+		}
+		if t.typ != tokOp || (t.val != "*" && t.val != "/" && t.val != "%") {
+			p.lex.unread(t)
+			return x, nil
+		}
+		y, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if x, err = p.arith(t, x, y); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *exprParser) arith(t filterToken, x, y exprNode) (exprNode, error) {
+	a, b := x.fieldType(), y.fieldType()
+	n := &exprBinary{op: t.val, x: x, y: y}
+	switch true {
+	case t.val == "+" && a == FieldTypeString && b == FieldTypeString:
+		n.typ, n.arg = FieldTypeString, FieldTypeString
+	case t.val == "-" && isTimeType(a) && isTimeType(b):
+		n.typ, n.arg = FieldTypeInt64, FieldTypeDatetime
+	case (t.val == "+" || t.val == "-") && isTimeType(a) && isIntegerType(b):
+		n.typ, n.arg = FieldTypeDatetime, FieldTypeDatetime
+	case t.val == "+" && isIntegerType(a) && isTimeType(b):
+		n.x, n.y = y, x
+		n.typ, n.arg = FieldTypeDatetime, FieldTypeDatetime
+	case (isNumericType(a) || a == FieldTypeUndefined) && (isNumericType(b) || b == FieldTypeUndefined):
+		typ, _ := commonType(x, y)
+		switch true {
+		case t.val == "/" || typ == FieldTypeUndefined:
+			typ = FieldTypeFloat64
+		case t.val == "-" && typ == FieldTypeUint64:
+			// differences of unsigned values may be negative
+			typ = FieldTypeInt64
+		}
+		n.typ, n.arg = typ, typ
+	default:
+		return nil, p.lex.errorf(t.pos, "operator '%s' is not defined for %s and %s", t.val, a, b)
+	}
+	return n, nil
+}
+
+func (p *exprParser) parseUnary() (exprNode, error) {
+	t, err := p.lex.next()
+	if err != nil {
+		return nil, err
+	}
+	if t.typ != tokOp || t.val != "-" {
+		p.lex.unread(t)
+		return p.parsePrimary()
+	}
+	x, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	// fold negative literals so they stay untyped
+	if l, ok := x.(*exprLiteral); ok {
+		switch v := l.val.(type) {
+		case int64:
+			return &exprLiteral{typ: l.typ, val: -v, untyped: l.untyped}, nil
+		case float64:
+			return &exprLiteral{typ: l.typ, val: -v}, nil
+		}
+	}
+	switch typ := x.fieldType(); typ {
+	case FieldTypeFloat64, FieldTypeInt64:
+		return &exprUnary{op: "-", x: x, typ: typ}, nil
+	case FieldTypeUint64:
+		return &exprUnary{op: "-", x: x, typ: FieldTypeInt64}, nil
+	default:
+		return nil, p.lex.errorf(t.pos, "cannot negate %s", typ)
+	}
+}
+
+func (p *exprParser) parsePrimary() (exprNode, error) {
+	t, err := p.lex.next()
+	if err != nil {
+		return nil, err
+	}
+	switch t.typ {
+	case tokLParen:
+		x, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(tokRParen); err != nil {
+			return nil, err
+		}
+		return x, nil
+	case tokString:
+		return &exprLiteral{typ: FieldTypeString, val: t.val}, nil
+	case tokWord:
+		// continue below
+	default:
+		return nil, p.lex.errorf(t.pos, "expected value, column or function, got %s", t)
+	}
+
+	if r, _ := utf8.DecodeRuneInString(t.val); unicode.IsDigit(r) || r == '.' {
+		if i, err := strconv.ParseInt(t.val, 10, 64); err == nil {
+			return &exprLiteral{typ: FieldTypeInt64, val: i, untyped: true}, nil
+		}
+		f, err := strconv.ParseFloat(t.val, 64)
+		if err != nil {
+			return nil, p.lex.errorf(t.pos, "invalid number '%s'", t.val)
+		}
+		return &exprLiteral{typ: FieldTypeFloat64, val: f}, nil
+	}
+	switch strings.ToLower(t.val) {
+	case "true":
+		return &exprLiteral{typ: FieldTypeBoolean, val: true}, nil
+	case "false":
+		return &exprLiteral{typ: FieldTypeBoolean, val: false}, nil
+	case "null":
+		return &exprLiteral{}, nil
+	}
+
+	// function call or column
+	next, err := p.lex.next()
+	if err != nil {
+		return nil, err
+	}
+	if next.typ == tokLParen {
+		return p.parseCall(t)
+	}
+	p.lex.unread(next)
+	return p.column(t, 0)
+}
+
+func (p *exprParser) expect(typ filterTokenType) error {
+	t, err := p.lex.next()
+	if err != nil {
+		return err
+	}
+	if t.typ != typ {
+		return p.lex.errorf(t.pos, "expected %s, got %s", typ, t)
+	}
+	return nil
+}
+
+func (p *exprParser) column(t filterToken, lag int) (exprNode, error) {
+	for _, f := range p.fields {
+		if f.Code != t.val {
+			continue
+		}
+		slot, ok := p.slots[f.Code]
+		if !ok {
+			slot = len(p.codes)
+			p.slots[f.Code] = slot
+			p.codes = append(p.codes, f.Code)
+			p.types = append(p.types, f.Type)
+		}
+		return &exprColumn{typ: f.Type, slot: slot, lag: lag}, nil
+	}
+	return nil, p.lex.errorf(t.pos, "unknown column '%s'", t.val)
+}
+
+func (p *exprParser) parseCall(name filterToken) (exprNode, error) {
+	fn := strings.ToLower(name.val)
+	if fn == "lag" {
+		return p.parseLag(name)
+	}
+	args := make([]exprNode, 0)
+	t, err := p.lex.next()
+	if err != nil {
+		return nil, err
+	}
+	if t.typ != tokRParen {
+		p.lex.unread(t)
+		for {
+			a, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, a)
+			t, err := p.lex.next()
+			if err != nil {
+				return nil, err
+			}
+			if t.typ == tokRParen {
+				break
+			}
+			if t.typ != tokComma {
+				return nil, p.lex.errorf(t.pos, "expected ',' or ')', got %s", t)
+			}
+		}
+	}
+	return p.call(name, fn, args)
+}
+
+// parseLag parses lag(col[, n]) where n is an integer literal.
+func (p *exprParser) parseLag(name filterToken) (exprNode, error) {
+	t, err := p.lex.next()
+	if err != nil {
+		return nil, err
+	}
+	if t.typ != tokWord {
+		return nil, p.lex.errorf(t.pos, "lag expects a column, got %s", t)
+	}
+	lag := 1
+	next, err := p.lex.next()
+	if err != nil {
+		return nil, err
+	}
+	if next.typ == tokComma {
+		neg := false
+		n, err := p.lex.next()
+		if err != nil {
+			return nil, err
+		}
+		if n.typ == tokOp && n.val == "-" {
+			neg = true
+			if n, err = p.lex.next(); err != nil {
+				return nil, err
+			}
+		}
+		i, err := strconv.Atoi(n.val)
+		if n.typ != tokWord || err != nil {
+			return nil, p.lex.errorf(n.pos, "lag expects an integer row offset, got %s", n)
+		}
+		if neg {
+			i = -i
+		}
+		lag = i
+	} else {
+		p.lex.unread(next)
+	}
+	if err := p.expect(tokRParen); err != nil {
+		return nil, err
+	}
+	return p.column(t, lag)
+}
+
+func (p *exprParser) call(name filterToken, fn string, args []exprNode) (exprNode, error) {
+	nargs := func(min, max int) error {
+		if len(args) < min || (max >= 0 && len(args) > max) {
+			switch true {
+			case min == max:
+				return p.lex.errorf(name.pos, "%s expects %d arguments, got %d", fn, min, len(args))
+			case max < 0:
+				return p.lex.errorf(name.pos, "%s expects at least %d arguments, got %d", fn, min, len(args))
+			default:
+				return p.lex.errorf(name.pos, "%s expects %d to %d arguments, got %d", fn, min, max, len(args))
+			}
+		}
+		return nil
+	}
+	numeric := func(args ...exprNode) error {
+		for _, a := range args {
+			if typ := a.fieldType(); !isNumericType(typ) && typ != FieldTypeUndefined {
+				return p.lex.errorf(name.pos, "%s expects numeric arguments, got %s", fn, typ)
+			}
+		}
+		return nil
+	}
+	// unify returns the common type of all arguments
+	unify := func(args ...exprNode) (FieldType, error) {
+		n := args[0]
+		for _, a := range args[1:] {
+			typ, ok := commonType(n, a)
+			if !ok {
+				return FieldTypeUndefined, p.lex.errorf(name.pos, "%s arguments have incompatible types %s and %s", fn, n.fieldType(), a.fieldType())
+			}
+			if typ != n.fieldType() || isUntyped(n) {
+				n = &exprLiteral{typ: typ}
+			}
+		}
+		return n.fieldType(), nil
+	}
+	c := &exprCall{name: fn, args: args, strict: true}
+
+	switch fn {
+	case "abs", "floor", "ceil":
+		if err := nargs(1, 1); err != nil {
+			return nil, err
+		}
+		if err := numeric(args...); err != nil {
+			return nil, err
+		}
+		c.typ = args[0].fieldType()
+		if c.typ == FieldTypeUndefined {
+			c.typ = FieldTypeFloat64
+		}
+		c.fn = func(v []interface{}) interface{} {
+			switch x := v[0].(type) {
+			case float64:
+				switch fn {
+				case "abs":
+					return math.Abs(x)
+				case "floor":
+					return math.Floor(x)
+				default:
+					return math.Ceil(x)
+				}
+			case int64:
+				if fn == "abs" && x < 0 {
+					return -x
+				}
+				return x
+			default:
+				return x
+			}
+		}
+	case "round":
+		if err := nargs(1, 2); err != nil {
+			return nil, err
+		}
+		if err := numeric(args...); err != nil {
+			return nil, err
+		}
+		if len(args) == 2 && !isIntegerType(args[1].fieldType()) {
+			return nil, p.lex.errorf(name.pos, "round expects integer digits, got %s", args[1].fieldType())
+		}
+		c.typ = args[0].fieldType()
+		if c.typ == FieldTypeUndefined {
+			c.typ = FieldTypeFloat64
+		}
+		c.fn = func(v []interface{}) interface{} {
+			x, ok := v[0].(float64)
+			if !ok {
+				return v[0]
+			}
+			if len(v) == 1 {
+				return math.Round(x)
+			}
+			d, _ := toInt64(v[1])
+			scale := math.Pow(10, float64(d))
+			return exprFloat(math.Round(x*scale) / scale)
+		}
+	case "sqrt", "exp", "log", "log2", "log10":
+		if err := nargs(1, 1); err != nil {
+			return nil, err
+		}
+		if err := numeric(args...); err != nil {
+			return nil, err
+		}
+		f := map[string]func(float64) float64{
+			"sqrt":  math.Sqrt,
+			"exp":   math.Exp,
+			"log":   math.Log,
+			"log2":  math.Log2,
+			"log10": math.Log10,
+		}[fn]
+		c.typ = FieldTypeFloat64
+		c.fn = func(v []interface{}) interface{} {
+			x, _ := toFloat64(v[0])
+			return exprFloat(f(x))
+		}
+	case "pow":
+		if err := nargs(2, 2); err != nil {
+			return nil, err
+		}
+		if err := numeric(args...); err != nil {
+			return nil, err
+		}
+		c.typ = FieldTypeFloat64
+		c.fn = func(v []interface{}) interface{} {
+			x, _ := toFloat64(v[0])
+			y, _ := toFloat64(v[1])
+			return exprFloat(math.Pow(x, y))
+		}
+	case "min", "max":
+		if err := nargs(2, -1); err != nil {
+			return nil, err
+		}
+		typ, err := unify(args...)
+		if err != nil {
+			return nil, err
+		}
+		c.typ = typ
+		c.fn = func(v []interface{}) interface{} {
+			best := convertExprValue(typ, v[0])
+			for _, x := range v[1:] {
+				if x = convertExprValue(typ, x); x == nil || best == nil {
+					return nil
+				}
+				cmp := compareValues(typ, x, best)
+				if (fn == "min" && cmp < 0) || (fn == "max" && cmp > 0) {
+					best = x
+				}
+			}
+			return best
+		}
+	case "if":
+		if err := nargs(3, 3); err != nil {
+			return nil, err
+		}
+		if typ := args[0].fieldType(); typ != FieldTypeBoolean && typ != FieldTypeUndefined {
+			return nil, p.lex.errorf(name.pos, "if expects a boolean condition, got %s", typ)
+		}
+		typ, err := unify(args[1:]...)
+		if err != nil {
+			return nil, err
+		}
+		c.typ, c.strict = typ, false
+		c.fn = func(v []interface{}) interface{} {
+			if v[0] == true {
+				return exprConvertNullable(typ, v[1])
+			}
+			return exprConvertNullable(typ, v[2])
+		}
+	case "coalesce":
+		if err := nargs(1, -1); err != nil {
+			return nil, err
+		}
+		typ, err := unify(args...)
+		if err != nil {
+			return nil, err
+		}
+		c.typ, c.strict = typ, false
+		c.fn = func(v []interface{}) interface{} {
+			for _, x := range v {
+				if x != nil {
+					return convertExprValue(typ, x)
+				}
+			}
+			return nil
+		}
+	case "isnull":
+		if err := nargs(1, 1); err != nil {
+			return nil, err
+		}
+		c.typ, c.strict = FieldTypeBoolean, false
+		c.fn = func(v []interface{}) interface{} {
+			return v[0] == nil
+		}
+	default:
+		return nil, p.lex.errorf(name.pos, "unknown function '%s'", name.val)
+	}
+	return c, nil
+}
+
+func exprConvertNullable(typ FieldType, v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+	return convertExprValue(typ, v)
+}
@@ -0,0 +1,204 @@
+// Copyright (c) 2020 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package blockwatch
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func exprTestFrame(t *testing.T) *Dataframe {
+	df := NewDataframe(
+		Datafield{Code: "a", Type: FieldTypeInt64},
+		Datafield{Code: "u", Type: FieldTypeUint64},
+		Datafield{Code: "f", Type: FieldTypeFloat64},
+		Datafield{Code: "s", Type: FieldTypeString},
+		Datafield{Code: "ts", Type: FieldTypeDatetime},
+		Datafield{Code: "b", Type: FieldTypeBoolean},
+	)
+	for _, r := range [][]interface{}{
+		{int64(1), uint64(5), 1.5, "x", resampleTime, true},
+		{int64(-2), uint64(math.MaxUint64), nil, "y", resampleTime.Add(time.Second), false},
+		{nil, uint64(0), 4.0, nil, resampleTime.Add(2 * time.Second), nil},
+	} {
+		if err := df.Append(r...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return df
+}
+
+func TestExprEval(t *testing.T) {
+	df := exprTestFrame(t)
+	var tests = []struct {
+		expr string
+		typ  FieldType
+		want []interface{}
+	}{
+		// precedence and associativity
+		{"1 + 2 * 3", FieldTypeInt64, []interface{}{int64(7), int64(7), int64(7)}},
+		{"(1 + 2) * 3", FieldTypeInt64, []interface{}{int64(9), int64(9), int64(9)}},
+		{"10 - 4 - 3", FieldTypeInt64, []interface{}{int64(3), int64(3), int64(3)}},
+		{"2 * 3 % 4", FieldTypeInt64, []interface{}{int64(2), int64(2), int64(2)}},
+		{"-2 * 3", FieldTypeInt64, []interface{}{int64(-6), int64(-6), int64(-6)}},
+		{"1 < 2 and not 2 < 1 or false", FieldTypeBoolean, []interface{}{true, true, true}},
+		{"false and true or true", FieldTypeBoolean, []interface{}{true, true, true}},
+
+		// type inference
+		{"a + 1", FieldTypeInt64, []interface{}{int64(2), int64(-1), nil}},
+		{"a / 2", FieldTypeFloat64, []interface{}{0.5, -1.0, nil}},
+		{"a + f", FieldTypeFloat64, []interface{}{2.5, nil, nil}},
+		{"a + 0.5", FieldTypeFloat64, []interface{}{1.5, -1.5, nil}},
+		{"u % 2", FieldTypeUint64, []interface{}{uint64(1), uint64(1), uint64(0)}},
+		{"s + '!'", FieldTypeString, []interface{}{"x!", "y!", nil}},
+		{"ts - lag(ts)", FieldTypeInt64, []interface{}{nil, int64(1000), int64(1000)}},
+		{"ts + 500 > '2020-01-02T00:00:01Z'", FieldTypeBoolean, []interface{}{false, true, true}},
+
+		// unsigned values never wrap, out of range values are null
+		{"a + u", FieldTypeInt64, []interface{}{int64(6), nil, nil}},
+		{"u - 10", FieldTypeInt64, []interface{}{int64(-5), nil, int64(-10)}},
+		{"u + -1", FieldTypeInt64, []interface{}{int64(4), nil, int64(-1)}},
+		{"-u", FieldTypeInt64, []interface{}{int64(-5), nil, int64(0)}},
+		{"u > -1", FieldTypeBoolean, []interface{}{true, true, true}},
+		{"u > a", FieldTypeBoolean, []interface{}{true, true, nil}},
+		{"a < u", FieldTypeBoolean, []interface{}{true, true, nil}},
+		{"min(u, -1)", FieldTypeInt64, []interface{}{int64(-1), nil, int64(-1)}},
+		{"max(u, 1)", FieldTypeUint64, []interface{}{uint64(5), uint64(math.MaxUint64), uint64(1)}},
+
+		// null propagation
+		{"b and f > 2", FieldTypeBoolean, []interface{}{false, false, nil}},
+		{"b or f > 2", FieldTypeBoolean, []interface{}{true, nil, true}},
+		{"not b", FieldTypeBoolean, []interface{}{false, true, nil}},
+		{"if(b, s, 'none')", FieldTypeString, []interface{}{"x", "none", "none"}},
+		{"coalesce(f, a, 0)", FieldTypeFloat64, []interface{}{1.5, -2.0, 4.0}},
+		{"isnull(a)", FieldTypeBoolean, []interface{}{false, false, true}},
+		{"a % 0", FieldTypeInt64, []interface{}{nil, nil, nil}},
+		{"f / 0", FieldTypeFloat64, []interface{}{nil, nil, nil}},
+		{"sqrt(a)", FieldTypeFloat64, []interface{}{1.0, nil, nil}},
+		{"round(f / 3, 2)", FieldTypeFloat64, []interface{}{0.5, nil, 1.33}},
+		{"a + null", FieldTypeInt64, []interface{}{nil, nil, nil}},
+
+		// lag looks back or ahead in dataframe order
+		{"lag(a)", FieldTypeInt64, []interface{}{nil, int64(1), int64(-2)}},
+		{"lag(a, -1)", FieldTypeInt64, []interface{}{int64(-2), nil, nil}},
+		{"lag(s, 2)", FieldTypeString, []interface{}{nil, nil, "x"}},
+	}
+	for _, test := range tests {
+		e, err := ParseExpr(test.expr, df.Columns...)
+		if err != nil {
+			t.Errorf("%s: %v", test.expr, err)
+			continue
+		}
+		if e.Type() != test.typ {
+			t.Errorf("%s: got type %s, want %s", test.expr, e.Type(), test.typ)
+		}
+		got, err := e.Eval(df)
+		if err != nil {
+			t.Errorf("%s: %v", test.expr, err)
+			continue
+		}
+		for i := range test.want {
+			if !equalValue(got[i], test.want[i]) {
+				t.Errorf("%s: got %v, want %v", test.expr, got, test.want)
+				break
+			}
+		}
+	}
+}
+
+func TestExprError(t *testing.T) {
+	df := exprTestFrame(t)
+	var tests = []struct {
+		expr string
+		pos  int
+		msg  string
+	}{
+		{"a +", 4, "expected value"},
+		{"a + s", 3, "operator '+' is not defined for int64 and string"},
+		{"a > 'x'", 3, "cannot compare int64 and string"},
+		{"x + 1", 1, "unknown column 'x'"},
+		{"1 + foo(1)", 5, "unknown function 'foo'"},
+		{"(a + 1", 7, "expected"},
+		{"a b", 3, "expected operator or end of expression"},
+		{"not a", 1, "'not' requires a boolean operand"},
+		{"a and b", 3, "'and' requires boolean operands"},
+		{"lag(a, x)", 8, "integer row offset"},
+		{"round(f, 1.5)", 1, "round expects integer digits"},
+		{"pow(1)", 1, "pow expects 2 arguments, got 1"},
+		{"if(b, s, a)", 1, "incompatible types"},
+		{"a & b", 3, "unexpected character '&'"},
+		{"s = 'abc", 5, "unterminated string"},
+		{"ts > 'nope'", 4, "invalid datetime value"},
+		{"-s", 1, "cannot negate string"},
+		{"null", 1, "expression has no type"},
+	}
+	for _, test := range tests {
+		_, err := ParseExpr(test.expr, df.Columns...)
+		var e *ExprError
+		if !errors.As(err, &e) {
+			t.Errorf("%s: got error %v, want ExprError", test.expr, err)
+			continue
+		}
+		if e.Pos != test.pos || !strings.Contains(e.Msg, test.msg) || e.Expr != test.expr {
+			t.Errorf("%s: got %d %q, want %d %q", test.expr, e.Pos, e.Msg, test.pos, test.msg)
+		}
+	}
+
+	// columns must keep their compile time type
+	e, err := ParseExpr("a + 1", df.Columns...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := NewDataframe(Datafield{Code: "a", Type: FieldTypeFloat64})
+	if _, err := e.Eval(other); err == nil || !strings.Contains(err.Error(), "has type float64") {
+		t.Errorf("got error %v", err)
+	}
+	if _, err := e.Eval(NewDataframe()); err == nil || !strings.Contains(err.Error(), "missing column 'a'") {
+		t.Errorf("got error %v", err)
+	}
+}
+
+func TestWithColumn(t *testing.T) {
+	df := exprTestFrame(t)
+	if err := df.WithColumn("spread", "f - a"); err != nil {
+		t.Fatal(err)
+	}
+	n := len(df.Columns)
+	if c := df.Columns[n-1]; c != (Datafield{Name: "spread", Code: "spread", Type: FieldTypeFloat64}) {
+		t.Errorf("got field %+v", c)
+	}
+	vals, err := df.ColumnValues("spread")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vals) != 3 || vals[0] != 0.5 || vals[1] != nil || vals[2] != nil {
+		t.Errorf("got values %v", vals)
+	}
+
+	// an existing column is replaced in place
+	if err := df.WithColumn("a", "a * 2"); err != nil {
+		t.Fatal(err)
+	}
+	if len(df.Columns) != n || df.Columns[0].Code != "a" {
+		t.Errorf("got columns %v", df.Columns)
+	}
+	vals, err = df.ColumnValues("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vals) != 3 || vals[0] != int64(2) || vals[1] != int64(-4) || vals[2] != nil {
+		t.Errorf("got values %v", vals)
+	}
+
+	// on error the dataframe is unchanged
+	if err := df.WithColumn("z", "x + 1"); err == nil {
+		t.Error("expected error for unknown column")
+	}
+	if len(df.Columns) != n {
+		t.Errorf("got %d columns after error, want %d", len(df.Columns), n)
+	}
+}
@@ -4,6 +4,7 @@
 package blockwatch
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/url"
 	"strings"
@@ -26,9 +27,9 @@ const (
 )
 
 type Filter struct {
-	Field string
-	Mode  FilterMode
-	Value string
+	Field string     `json:"field"`
+	Mode  FilterMode `json:"mode"`
+	Value string     `json:"value"`
 }
 
 func NewFilter(field string, mode FilterMode, value string) *Filter {
@@ -44,7 +45,50 @@ func (f Filter) String() string {
 }
 
 func (f Filter) AppendQuery(q url.Values) {
-	q.Add(fmt.Sprintf("%s.%s", f.Field, f.Mode), f.Value)
+	q.Add(f.queryKey(), f.Value)
+}
+
+func (f Filter) queryKey() string {
+	return fmt.Sprintf("%s.%s", f.Field, f.Mode)
+}
+
+// MarshalText encodes the filter as textual expression, e.g. `height >= 5`.
+func (f Filter) MarshalText() ([]byte, error) {
+	if f.Mode < FilterModeEqual || f.Mode >= FilterModeInvalid {
+		return nil, fmt.Errorf("invalid filter mode %d", f.Mode)
+	}
+	return []byte(f.Expr()), nil
+}
+
+func (f *Filter) UnmarshalText(data []byte) error {
+	l, err := ParseFilterExpr(string(data))
+	if err != nil {
+		return err
+	}
+	if len(l) != 1 {
+		return fmt.Errorf("expected a single filter condition, got %d", len(l))
+	}
+	*f = *l[0]
+	return nil
+}
+
+// UnmarshalJSON accepts both, a textual filter expression and a JSON object
+// with field, mode and value.
+func (f *Filter) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		return f.UnmarshalText([]byte(s))
+	}
+	type alias Filter
+	var a alias
+	if err := json.Unmarshal(data, &a); err != nil {
+		return err
+	}
+	*f = Filter(a)
+	return nil
 }
 
 func ParseFilterMode(s string) FilterMode {
@@ -101,6 +145,22 @@ func (m FilterMode) String() string {
 	}
 }
 
+func (m FilterMode) MarshalText() ([]byte, error) {
+	if m < FilterModeEqual || m >= FilterModeInvalid {
+		return nil, fmt.Errorf("invalid filter mode %d", m)
+	}
+	return []byte(m.String()), nil
+}
+
+func (m *FilterMode) UnmarshalText(data []byte) error {
+	mode := ParseFilterMode(string(data))
+	if mode == FilterModeInvalid {
+		return fmt.Errorf("invalid filter mode '%s'", string(data))
+	}
+	*m = mode
+	return nil
+}
+
 // col_name.{ne|gt|gte|lt|lte|in|nin|re|rg}=value
 func ParseFilter(key string, val string) (*Filter, error) {
 	var fkey, mkey string
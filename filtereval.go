@@ -0,0 +1,313 @@
+// Copyright (c) 2020 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package blockwatch
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Filter returns a view on all rows that match all filters. Filters are
+// evaluated locally using the same semantics as the API, comparisons are
+// type-aware based on column types. The view shares raw row data with the
+// original dataframe. Rows with null values never match. An error is returned
+// for filters on unknown columns or with values that cannot be parsed as the
+// column type.
+func (t *Dataframe) Filter(filters ...*Filter) (*Dataframe, error) {
+	m, err := t.CompileFilters(filters...)
+	if err != nil {
+		return nil, err
+	}
+	data := make([]json.RawMessage, 0)
+	for i := range t.Data {
+		if m.match(i) {
+			data = append(data, t.Data[i])
+		}
+	}
+	return t.view(data), nil
+}
+
+// MatchAt returns true when row matches all filters. Use CompileFilters to
+// match many rows against the same filters.
+func (t *Dataframe) MatchAt(row int, filters ...*Filter) (bool, error) {
+	m, err := t.CompileFilters(filters...)
+	if err != nil {
+		return false, err
+	}
+	return m.MatchAt(row)
+}
+
+// FilterMatcher evaluates a list of compiled filters on rows of a dataframe.
+type FilterMatcher struct {
+	df    *Dataframe
+	conds []*filterCond
+}
+
+// CompileFilters checks filters against the dataframe's columns and parses
+// filter values once so that rows can be matched without repeating this work.
+func (t *Dataframe) CompileFilters(filters ...*Filter) (*FilterMatcher, error) {
+	if err := t.initType(nil); err != nil {
+		return nil, err
+	}
+	conds := make([]*filterCond, 0, len(filters))
+	for _, f := range filters {
+		if f == nil {
+			continue
+		}
+		col := t.columnIndex(f.Field)
+		if col < 0 {
+			return nil, fmt.Errorf("blockwatch: missing column '%s'", f.Field)
+		}
+		c, err := compileFilter(t.Columns[col], col, f)
+		if err != nil {
+			return nil, err
+		}
+		conds = append(conds, c)
+	}
+	return &FilterMatcher{df: t, conds: conds}, nil
+}
+
+// MatchAt returns true when row matches all filters.
+func (m *FilterMatcher) MatchAt(row int) (bool, error) {
+	if row < 0 || row >= len(m.df.Data) {
+		return false, fmt.Errorf("blockwatch: invalid data row %d > len %d", row, len(m.df.Data))
+	}
+	return m.match(row), nil
+}
+
+func (m *FilterMatcher) match(row int) bool {
+	for _, c := range m.conds {
+		if !c.match(m.df, row) {
+			return false
+		}
+	}
+	return true
+}
+
+// view returns a new dataframe with the same column layout and the given
+// rows. Raw row data is shared, not copied.
+func (t *Dataframe) view(data []json.RawMessage) *Dataframe {
+	if data == nil {
+		data = make([]json.RawMessage, 0)
+	}
+	return &Dataframe{
+		Columns: t.Columns,
+		Data:    data,
+	}
+}
+
+type filterCond struct {
+	col  int
+	typ  FieldType
+	mode FilterMode
+	vals []interface{}
+	re   *regexp.Regexp
+}
+
+func compileFilter(field Datafield, col int, f *Filter) (*filterCond, error) {
+	m := &filterCond{
+		col:  col,
+		typ:  field.Type,
+		mode: f.Mode,
+	}
+	var vals []string
+	switch f.Mode {
+	case FilterModeRegexp:
+		if err := validateFilterValue(field.Type, f); err != nil {
+			return nil, fmt.Errorf("blockwatch: filter on column '%s': %v", f.Field, err)
+		}
+		re, err := regexp.Compile(f.Value)
+		if err != nil {
+			return nil, fmt.Errorf("blockwatch: filter on column '%s': %v", f.Field, err)
+		}
+		m.re = re
+		return m, nil
+	case FilterModeIn, FilterModeNotIn, FilterModeRange:
+		vals = strings.Split(f.Value, ",")
+	case FilterModeEqual, FilterModeNotEqual, FilterModeGt, FilterModeGte, FilterModeLt, FilterModeLte:
+		vals = []string{f.Value}
+	default:
+		return nil, fmt.Errorf("blockwatch: filter on column '%s': invalid filter mode", f.Field)
+	}
+
+	// list values may be separated by comma and space
+	for i, v := range vals {
+		vals[i] = strings.TrimSpace(v)
+	}
+	trimmed := *f
+	trimmed.Value = strings.Join(vals, ",")
+	if err := validateFilterValue(field.Type, &trimmed); err != nil {
+		return nil, fmt.Errorf("blockwatch: filter on column '%s': %v", f.Field, err)
+	}
+	m.vals = make([]interface{}, len(vals))
+	for i, v := range vals {
+		val, err := parseFieldValue(field.Type, v)
+		if err != nil {
+			return nil, fmt.Errorf("blockwatch: filter on column '%s': %v", f.Field, err)
+		}
+		m.vals[i] = val
+	}
+	return m, nil
+}
+
+func (m *filterCond) match(t *Dataframe, row int) bool {
+	if t.IsNullAt(m.col, row) {
+		return false
+	}
+	val, err := t.FieldAt(m.col, row)
+	if err != nil {
+		// undecodable values never match
+		return false
+	}
+	switch m.mode {
+	case FilterModeEqual:
+		return compareValues(m.typ, val, m.vals[0]) == 0
+	case FilterModeNotEqual:
+		return compareValues(m.typ, val, m.vals[0]) != 0
+	case FilterModeGt:
+		return compareValues(m.typ, val, m.vals[0]) > 0
+	case FilterModeGte:
+		return compareValues(m.typ, val, m.vals[0]) >= 0
+	case FilterModeLt:
+		return compareValues(m.typ, val, m.vals[0]) < 0
+	case FilterModeLte:
+		return compareValues(m.typ, val, m.vals[0]) <= 0
+	case FilterModeIn, FilterModeNotIn:
+		var found bool
+		for _, v := range m.vals {
+			if compareValues(m.typ, val, v) == 0 {
+				found = true
+				break
+			}
+		}
+		return found == (m.mode == FilterModeIn)
+	case FilterModeRange:
+		return compareValues(m.typ, val, m.vals[0]) >= 0 && compareValues(m.typ, val, m.vals[1]) <= 0
+	case FilterModeRegexp:
+		s, ok := val.(string)
+		return ok && m.re.MatchString(s)
+	default:
+		return false
+	}
+}
+
+// parseFieldValue converts a string into a Go value of the type that
+// FieldAt returns for columns of type typ.
+func parseFieldValue(typ FieldType, s string) (interface{}, error) {
+	switch typ {
+	case FieldTypeString:
+		return s, nil
+	case FieldTypeBytes:
+		return hex.DecodeString(s)
+	case FieldTypeDate, FieldTypeDatetime:
+		return parseTimeValue(s)
+	case FieldTypeBoolean:
+		return strconv.ParseBool(s)
+	case FieldTypeFloat64:
+		return strconv.ParseFloat(s, 64)
+	case FieldTypeInt64:
+		return strconv.ParseInt(s, 10, 64)
+	case FieldTypeUint64:
+		return strconv.ParseUint(s, 10, 64)
+	default:
+		return nil, fmt.Errorf("unsupported column type %s", typ)
+	}
+}
+
+// parseTimeValue accepts UNIX milliseconds, RFC3339 timestamps and dates.
+func parseTimeValue(s string) (time.Time, error) {
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(0, i*1000000).UTC(), nil
+	}
+	for _, layout := range []string{
+		time.RFC3339Nano,
+		"2006-01-02T15:04:05",
+		"2006-01-02 15:04:05",
+		"2006-01-02",
+	} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time value '%s'", s)
+}
+
+// compareValues compares two values of column type typ as returned from
+// FieldAt and returns -1, 0 or +1. Values of unexpected Go types compare
+// as equal.
+func compareValues(typ FieldType, a, b interface{}) int {
+	switch typ {
+	case FieldTypeString:
+		x, _ := a.(string)
+		y, _ := b.(string)
+		return strings.Compare(x, y)
+	case FieldTypeBytes:
+		x, _ := a.([]byte)
+		y, _ := b.([]byte)
+		return bytes.Compare(x, y)
+	case FieldTypeDate, FieldTypeDatetime:
+		x, _ := a.(time.Time)
+		y, _ := b.(time.Time)
+		switch true {
+		case x.Before(y):
+			return -1
+		case x.After(y):
+			return 1
+		default:
+			return 0
+		}
+	case FieldTypeBoolean:
+		x, _ := a.(bool)
+		y, _ := b.(bool)
+		switch true {
+		case x == y:
+			return 0
+		case !x:
+			return -1
+		default:
+			return 1
+		}
+	case FieldTypeFloat64:
+		x, _ := a.(float64)
+		y, _ := b.(float64)
+		switch true {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		default:
+			return 0
+		}
+	case FieldTypeInt64:
+		x, _ := a.(int64)
+		y, _ := b.(int64)
+		switch true {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		default:
+			return 0
+		}
+	case FieldTypeUint64:
+		x, _ := a.(uint64)
+		y, _ := b.(uint64)
+		switch true {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		default:
+			return 0
+		}
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,147 @@
+// Copyright (c) 2020 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package blockwatch
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func filterTestFrame(t *testing.T) *Dataframe {
+	t.Helper()
+	df := NewDataframe(
+		Datafield{Code: "time", Type: FieldTypeDatetime},
+		Datafield{Code: "height", Type: FieldTypeUint64},
+		Datafield{Code: "delta", Type: FieldTypeInt64},
+		Datafield{Code: "price", Type: FieldTypeFloat64},
+		Datafield{Code: "name", Type: FieldTypeString},
+		Datafield{Code: "hash", Type: FieldTypeBytes},
+		Datafield{Code: "ok", Type: FieldTypeBoolean},
+	)
+	t0 := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	rows := [][]interface{}{
+		{t0, uint64(10), int64(-5), 1.5, "alpha", []byte{0x0a, 0x01}, true},
+		{t0.Add(time.Hour), uint64(100), int64(0), 2.5, "beta", []byte{0x0b}, false},
+		{t0.Add(2 * time.Hour), uint64(1000), int64(5), -1.0, "gamma", []byte{0xff}, true},
+		{t0.Add(3 * time.Hour), nil, nil, nil, nil, nil, nil},
+		{t0.Add(4 * time.Hour), uint64(math.MaxUint64), int64(math.MaxInt64), 1e10, "Alpha", []byte{}, false},
+	}
+	for _, r := range rows {
+		if err := df.Append(r...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return df
+}
+
+func TestDataframeFilter(t *testing.T) {
+	var tests = []struct {
+		filters []*Filter
+		want    []int
+	}{
+		{nil, []int{0, 1, 2, 3, 4}},
+		{[]*Filter{NewFilter("height", FilterModeEqual, "100")}, []int{1}},
+		{[]*Filter{NewFilter("height", FilterModeIn, "10, 100")}, []int{0, 1}},
+		{[]*Filter{NewFilter("height", FilterModeNotIn, "10,100")}, []int{2, 4}},
+		{[]*Filter{NewFilter("height", FilterModeGt, "1000")}, []int{4}},
+		{[]*Filter{NewFilter("height", FilterModeRange, "10, 1000")}, []int{0, 1, 2}},
+		{[]*Filter{NewFilter("delta", FilterModeLt, "0")}, []int{0}},
+		{[]*Filter{NewFilter("delta", FilterModeGte, "0")}, []int{1, 2, 4}},
+		{[]*Filter{NewFilter("price", FilterModeLte, "1.5")}, []int{0, 2}},
+		{[]*Filter{NewFilter("name", FilterModeRegexp, "^[ab]")}, []int{0, 1}},
+		{[]*Filter{NewFilter("name", FilterModeNotEqual, "alpha")}, []int{1, 2, 4}},
+		{[]*Filter{NewFilter("name", FilterModeGt, "Z")}, []int{0, 1, 2}},
+		{[]*Filter{NewFilter("hash", FilterModeEqual, "0b")}, []int{1}},
+		{[]*Filter{NewFilter("hash", FilterModeIn, "0a01, ff")}, []int{0, 2}},
+		{[]*Filter{NewFilter("ok", FilterModeEqual, "true")}, []int{0, 2}},
+		{[]*Filter{NewFilter("time", FilterModeGte, "2020-01-01T01:00:00Z")}, []int{1, 2, 3, 4}},
+		{[]*Filter{NewFilter("time", FilterModeRange, "1577836800000, 1577840400000")}, []int{0, 1}},
+		{[]*Filter{NewFilter("time", FilterModeLt, "2020-01-01")}, []int{}},
+		{[]*Filter{
+			NewFilter("height", FilterModeGt, "10"),
+			nil,
+			NewFilter("ok", FilterModeEqual, "false"),
+		}, []int{1, 4}},
+	}
+	df := filterTestFrame(t)
+	for _, test := range tests {
+		view, err := df.Filter(test.filters...)
+		if err != nil {
+			t.Errorf("%v: %v", test.filters, err)
+			continue
+		}
+		if !reflect.DeepEqual(view.Columns, df.Columns) {
+			t.Errorf("%v: columns changed", test.filters)
+		}
+		got := make([]int, 0)
+		for i := range view.Data {
+			for j := range df.Data {
+				if &view.Data[i][0] == &df.Data[j][0] {
+					got = append(got, j)
+				}
+			}
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%v: got rows %v, want %v", test.filters, got, test.want)
+		}
+
+		// matching single rows agrees with the view
+		m, err := df.CompileFilters(test.filters...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = got[:0]
+		for i := range df.Data {
+			ok, err := m.MatchAt(i)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok2, _ := df.MatchAt(i, test.filters...); ok2 != ok {
+				t.Errorf("%v: row %d: MatchAt %t, matcher %t", test.filters, i, ok2, ok)
+			}
+			if ok {
+				got = append(got, i)
+			}
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%v: matcher got rows %v, want %v", test.filters, got, test.want)
+		}
+	}
+}
+
+func TestDataframeFilterError(t *testing.T) {
+	df := filterTestFrame(t)
+	for _, f := range []*Filter{
+		NewFilter("nope", FilterModeEqual, "1"),
+		NewFilter("height", FilterModeEqual, "x"),
+		NewFilter("height", FilterModeIn, "1, -2"),
+		NewFilter("height", FilterModeRegexp, "1"),
+		NewFilter("ok", FilterModeGt, "true"),
+		NewFilter("price", FilterModeRange, "1"),
+		NewFilter("name", FilterModeRegexp, "("),
+		NewFilter("time", FilterModeEqual, "yesterday"),
+		NewFilter("height", FilterModeInvalid, "1"),
+	} {
+		if view, err := df.Filter(f); err == nil {
+			t.Errorf("%s: expected error, got %d rows", f, len(view.Data))
+		}
+		if _, err := df.MatchAt(0, f); err == nil {
+			t.Errorf("%s: expected MatchAt error", f)
+		}
+		if _, err := df.CompileFilters(f); err == nil {
+			t.Errorf("%s: expected compile error", f)
+		}
+	}
+	m, err := df.CompileFilters()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range []int{-1, len(df.Data)} {
+		if _, err := m.MatchAt(row); err == nil {
+			t.Errorf("row %d: expected invalid row error", row)
+		}
+	}
+}
@@ -0,0 +1,579 @@
+// Copyright (c) 2020 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package blockwatch
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// FilterList is a list of filters that are combined with logical AND. Its
+// String method returns the textual filter expression which can be parsed back
+// with ParseFilterExpr.
+type FilterList []*Filter
+
+func (l FilterList) String() string {
+	s := make([]string, 0, len(l))
+	for _, f := range l {
+		if f == nil {
+			continue
+		}
+		s = append(s, f.Expr())
+	}
+	return strings.Join(s, " and ")
+}
+
+// Expr returns the filter in textual expression form, e.g. `height >= 500000`.
+func (f Filter) Expr() string {
+	switch f.Mode {
+	case FilterModeIn, FilterModeNotIn:
+		vals := strings.Split(f.Value, ",")
+		for i, v := range vals {
+			vals[i] = quoteExprValue(v)
+		}
+		return fmt.Sprintf("%s %s (%s)", f.Field, f.Mode.Operator(), strings.Join(vals, ", "))
+	case FilterModeRange:
+		vals := strings.SplitN(f.Value, ",", 2)
+		if len(vals) != 2 {
+			vals = append(vals, "")
+		}
+		return fmt.Sprintf("%s between %s and %s", f.Field, quoteExprValue(vals[0]), quoteExprValue(vals[1]))
+	case FilterModeRegexp:
+		return fmt.Sprintf("%s %s %s", f.Field, f.Mode.Operator(), quoteExprString(f.Value))
+	default:
+		return fmt.Sprintf("%s %s %s", f.Field, f.Mode.Operator(), quoteExprValue(f.Value))
+	}
+}
+
+// Operator returns the symbol or keyword used for a filter mode in textual
+// filter expressions.
+func (m FilterMode) Operator() string {
+	switch m {
+	case FilterModeEqual:
+		return "="
+	case FilterModeNotEqual:
+		return "!="
+	case FilterModeGt:
+		return ">"
+	case FilterModeGte:
+		return ">="
+	case FilterModeLt:
+		return "<"
+	case FilterModeLte:
+		return "<="
+	case FilterModeIn:
+		return "in"
+	case FilterModeNotIn:
+		return "not in"
+	case FilterModeRange:
+		return "between"
+	case FilterModeRegexp:
+		return "~"
+	default:
+		return ""
+	}
+}
+
+// parseFilterOperator returns the filter mode for a symbolic operator. Mode
+// names are handled by ParseFilterMode which is also used for URL query keys
+// and therefore does not accept symbols.
+func parseFilterOperator(s string) FilterMode {
+	switch s {
+	case "=", "==":
+		return FilterModeEqual
+	case "!=", "<>":
+		return FilterModeNotEqual
+	case ">":
+		return FilterModeGt
+	case ">=":
+		return FilterModeGte
+	case "<":
+		return FilterModeLt
+	case "<=":
+		return FilterModeLte
+	case "~", "=~":
+		return FilterModeRegexp
+	default:
+		return FilterModeInvalid
+	}
+}
+
+// FilterExprError is returned when a filter expression cannot be parsed. Pos
+// is the 1-based character position where the error was detected.
+type FilterExprError struct {
+	Expr string
+	Pos  int
+	Msg  string
+}
+
+func (e *FilterExprError) Error() string {
+	return fmt.Sprintf("blockwatch: filter expression at position %d: %s", e.Pos, e.Msg)
+}
+
+// ParseFilterExpr parses a textual filter expression like
+//
+//	height >= 500000 and volume in (10, 100) and hash ~ "^0000"
+//
+// into a list of filters. Conditions are combined with `and` (or `&&`, `,`).
+// Supported operators are = == != <> > >= < <= ~ =~, the keywords in, not in,
+// between .. and .., and all URL filter mode names (eq, ne, gt, gte, lt, lte,
+// in, nin, rg, re). Values may be bare words, numbers or single/double quoted
+// strings.
+//
+// When column metadata is passed, unknown columns are rejected and literals
+// are checked against the column type.
+func ParseFilterExpr(expr string, fields ...Datafield) (FilterList, error) {
+	p := &filterParser{
+		lex:    newFilterLexer(expr),
+		fields: fields,
+	}
+	return p.parse()
+}
+
+type filterTokenType int
+
+const (
+	tokEOF filterTokenType = iota
+	tokWord
+	tokString
+	tokOp
+	tokLParen
+	tokRParen
+	tokComma
+)
+
+func (t filterTokenType) String() string {
+	switch t {
+	case tokEOF:
+		return "end of expression"
+	case tokWord:
+		return "word"
+	case tokString:
+		return "string"
+	case tokOp:
+		return "operator"
+	case tokLParen:
+		return "'('"
+	case tokRParen:
+		return "')'"
+	case tokComma:
+		return "','"
+	default:
+		return "token"
+	}
+}
+
+type filterToken struct {
+	typ filterTokenType
+	val string
+	pos int // 1-based rune position
+}
+
+func (t filterToken) String() string {
+	switch t.typ {
+	case tokEOF:
+		return t.typ.String()
+	case tokString:
+		return strconv.Quote(t.val)
+	default:
+		return "'" + t.val + "'"
+	}
+}
+
+func (t filterToken) isKeyword(kw string) bool {
+	return t.typ == tokWord && strings.EqualFold(t.val, kw)
+}
+
+type filterLexer struct {
+	input string
+	pos   int // byte offset
+	rpos  int // 1-based rune position
+	peek  *filterToken
+}
+
+func newFilterLexer(s string) *filterLexer {
+	return &filterLexer{input: s, rpos: 1}
+}
+
+func (l *filterLexer) errorf(pos int, format string, args ...interface{}) error {
+	return &FilterExprError{
+		Expr: l.input,
+		Pos:  pos,
+		Msg:  fmt.Sprintf(format, args...),
+	}
+}
+
+func (l *filterLexer) next() (filterToken, error) {
+	if l.peek != nil {
+		t := *l.peek
+		l.peek = nil
+		return t, nil
+	}
+	return l.scan()
+}
+
+func (l *filterLexer) unread(t filterToken) {
+	l.peek = &t
+}
+
+func (l *filterLexer) read() rune {
+	r, n := utf8.DecodeRuneInString(l.input[l.pos:])
+	l.pos += n
+	l.rpos++
+	return r
+}
+
+func (l *filterLexer) scan() (filterToken, error) {
+	// skip whitespace
+	for l.pos < len(l.input) {
+		r, _ := utf8.DecodeRuneInString(l.input[l.pos:])
+		if !unicode.IsSpace(r) {
+			break
+		}
+		l.read()
+	}
+	start := l.rpos
+	if l.pos >= len(l.input) {
+		return filterToken{typ: tokEOF, pos: start}, nil
+	}
+	r := l.read()
+	switch r {
+	case '(', '[':
+		return filterToken{typ: tokLParen, val: string(r), pos: start}, nil
+	case ')', ']':
+		return filterToken{typ: tokRParen, val: string(r), pos: start}, nil
+	case ',':
+		return filterToken{typ: tokComma, val: ",", pos: start}, nil
+	case '"', '\'':
+		return l.scanString(r, start)
+	case '=', '!', '<', '>', '~', '&':
+		op := string(r)
+		if l.pos < len(l.input) {
+			switch op + string(l.input[l.pos]) {
+			case "==", "!=", "<>", "<=", ">=", "=~", "&&":
+				op += string(l.read())
+			}
+		}
+		if op == "!" || op == "&" {
+			return filterToken{}, l.errorf(start, "unexpected character '%s'", op)
+		}
+		return filterToken{typ: tokOp, val: op, pos: start}, nil
+	default:
+		buf := []rune{r}
+		for l.pos < len(l.input) {
+			r, _ := utf8.DecodeRuneInString(l.input[l.pos:])
+			if unicode.IsSpace(r) || strings.ContainsRune("()[],\"'=!<>~&", r) {
+				break
+			}
+			buf = append(buf, l.read())
+		}
+		return filterToken{typ: tokWord, val: string(buf), pos: start}, nil
+	}
+}
+
+func (l *filterLexer) scanString(quote rune, start int) (filterToken, error) {
+	var b strings.Builder
+	for l.pos < len(l.input) {
+		r := l.read()
+		switch r {
+		case quote:
+			return filterToken{typ: tokString, val: b.String(), pos: start}, nil
+		case '\\':
+			if l.pos >= len(l.input) {
+				return filterToken{}, l.errorf(l.rpos, "unterminated escape sequence")
+			}
+			switch e := l.read(); e {
+			case 'n':
+				b.WriteRune('\n')
+			case 't':
+				b.WriteRune('\t')
+			case '\\', '"', '\'':
+				b.WriteRune(e)
+			default:
+				// keep unknown escapes as is, they are common in regexps
+				b.WriteRune('\\')
+				b.WriteRune(e)
+			}
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return filterToken{}, l.errorf(start, "unterminated string")
+}
+
+type filterParser struct {
+	lex    *filterLexer
+	fields []Datafield
+}
+
+func (p *filterParser) parse() (FilterList, error) {
+	list := make(FilterList, 0)
+	for {
+		t, err := p.lex.next()
+		if err != nil {
+			return nil, err
+		}
+		if t.typ == tokEOF {
+			if len(list) == 0 {
+				return list, nil
+			}
+			return nil, p.lex.errorf(t.pos, "expected condition after 'and'")
+		}
+		p.lex.unread(t)
+		f, err := p.parseCondition()
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, f)
+
+		// expect conjunction or end
+		t, err = p.lex.next()
+		if err != nil {
+			return nil, err
+		}
+		switch true {
+		case t.typ == tokEOF:
+			return list, nil
+		case t.isKeyword("and"), t.typ == tokComma, t.typ == tokOp && t.val == "&&":
+			continue
+		case t.isKeyword("or"):
+			return nil, p.lex.errorf(t.pos, "'or' is not supported, filters are always combined with 'and'")
+		default:
+			return nil, p.lex.errorf(t.pos, "expected 'and' or end of expression, got %s", t)
+		}
+	}
+}
+
+func (p *filterParser) parseCondition() (*Filter, error) {
+	t, err := p.lex.next()
+	if err != nil {
+		return nil, err
+	}
+	if t.typ != tokWord {
+		return nil, p.lex.errorf(t.pos, "expected column name, got %s", t)
+	}
+	col := t
+	if err := p.checkField(col); err != nil {
+		return nil, err
+	}
+
+	// operator
+	t, err = p.lex.next()
+	if err != nil {
+		return nil, err
+	}
+	var mode FilterMode
+	switch t.typ {
+	case tokOp:
+		mode = parseFilterOperator(t.val)
+	case tokWord:
+		if t.isKeyword("not") {
+			n, err := p.lex.next()
+			if err != nil {
+				return nil, err
+			}
+			if !n.isKeyword("in") {
+				return nil, p.lex.errorf(n.pos, "expected 'in' after 'not', got %s", n)
+			}
+			mode = FilterModeNotIn
+		} else if t.isKeyword("between") {
+			mode = FilterModeRange
+		} else {
+			mode = ParseFilterMode(t.val)
+		}
+	default:
+		mode = FilterModeInvalid
+	}
+	if mode == FilterModeInvalid {
+		return nil, p.lex.errorf(t.pos, "expected filter operator, got %s", t)
+	}
+	op := t
+
+	// value(s)
+	var vals []filterToken
+	switch true {
+	case op.isKeyword("between"):
+		a, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		n, err := p.lex.next()
+		if err != nil {
+			return nil, err
+		}
+		if !n.isKeyword("and") {
+			return nil, p.lex.errorf(n.pos, "expected 'and' in between condition, got %s", n)
+		}
+		b, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		vals = []filterToken{a, b}
+	case mode == FilterModeIn, mode == FilterModeNotIn, mode == FilterModeRange:
+		vals, err = p.parseList()
+		if err != nil {
+			return nil, err
+		}
+		if mode == FilterModeRange && len(vals) != 2 {
+			return nil, p.lex.errorf(op.pos, "range needs exactly two values, got %d", len(vals))
+		}
+	default:
+		v, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		vals = []filterToken{v}
+	}
+
+	// check literals against column type
+	if err := p.checkValues(col, op, mode, vals); err != nil {
+		return nil, err
+	}
+	s := make([]string, len(vals))
+	for i, v := range vals {
+		s[i] = v.val
+	}
+	return NewFilter(col.val, mode, strings.Join(s, ",")), nil
+}
+
+func (p *filterParser) parseValue() (filterToken, error) {
+	t, err := p.lex.next()
+	if err != nil {
+		return t, err
+	}
+	if t.typ != tokWord && t.typ != tokString {
+		return t, p.lex.errorf(t.pos, "expected value, got %s", t)
+	}
+	return t, nil
+}
+
+func (p *filterParser) parseList() ([]filterToken, error) {
+	t, err := p.lex.next()
+	if err != nil {
+		return nil, err
+	}
+	if t.typ != tokLParen {
+		// allow a single unparenthesized value
+		if t.typ == tokWord || t.typ == tokString {
+			return []filterToken{t}, nil
+		}
+		return nil, p.lex.errorf(t.pos, "expected '(', got %s", t)
+	}
+	vals := make([]filterToken, 0)
+	for {
+		v, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		vals = append(vals, v)
+		t, err = p.lex.next()
+		if err != nil {
+			return nil, err
+		}
+		switch t.typ {
+		case tokComma:
+			continue
+		case tokRParen:
+			return vals, nil
+		default:
+			return nil, p.lex.errorf(t.pos, "expected ',' or ')', got %s", t)
+		}
+	}
+}
+
+func (p *filterParser) field(name string) (Datafield, bool) {
+	for _, v := range p.fields {
+		if v.Code == name {
+			return v, true
+		}
+	}
+	return Datafield{}, false
+}
+
+func (p *filterParser) checkField(t filterToken) error {
+	if len(p.fields) == 0 {
+		return nil
+	}
+	if _, ok := p.field(t.val); !ok {
+		return p.lex.errorf(t.pos, "unknown column '%s'", t.val)
+	}
+	return nil
+}
+
+func (p *filterParser) checkValues(col, op filterToken, mode FilterMode, vals []filterToken) error {
+	for _, v := range vals {
+		if !strings.ContainsRune(v.val, ',') {
+			continue
+		}
+		switch {
+		case v.typ == tokWord:
+			return p.lex.errorf(v.pos, "value %s contains a comma and must be quoted", v)
+		case mode == FilterModeIn, mode == FilterModeNotIn, mode == FilterModeRange:
+			// list values are sent comma separated
+			return p.lex.errorf(v.pos, "value %s contains a comma which is not allowed in %s lists", v, mode)
+		}
+	}
+	field, ok := p.field(col.val)
+	if !ok {
+		return nil
+	}
+	switch mode {
+	case FilterModeRegexp:
+		if field.Type != FieldTypeString {
+			return p.lex.errorf(op.pos, "mode %s is unsupported on %s columns", mode, field.Type)
+		}
+		return nil
+	case FilterModeGt, FilterModeGte, FilterModeLt, FilterModeLte, FilterModeRange:
+		if field.Type == FieldTypeBoolean || field.Type == FieldTypeBytes {
+			return p.lex.errorf(op.pos, "mode %s is unsupported on %s columns", mode, field.Type)
+		}
+	}
+	for _, v := range vals {
+		if err := validateFieldValue(field.Type, v.val); err != nil {
+			return p.lex.errorf(v.pos, "%v", err)
+		}
+	}
+	return nil
+}
+
+// quoteExprValue returns v unquoted when it can be read back as a single
+// bare word and quoted otherwise.
+func quoteExprValue(v string) string {
+	if v == "" {
+		return `""`
+	}
+	switch strings.ToLower(v) {
+	case "and", "or", "not", "in", "nin", "between":
+		return quoteExprString(v)
+	}
+	for _, r := range v {
+		if unicode.IsSpace(r) || strings.ContainsRune("()[],\"'=!<>~&\\", r) {
+			return quoteExprString(v)
+		}
+	}
+	return v
+}
+
+func quoteExprString(v string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range v {
+		switch r {
+		case '"', '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
@@ -0,0 +1,188 @@
+// Copyright (c) 2020 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package blockwatch
+
+import (
+	"errors"
+	"math/rand"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/quick"
+)
+
+var exprFields = []Datafield{
+	{Code: "height", Type: FieldTypeUint64},
+	{Code: "hash", Type: FieldTypeBytes},
+	{Code: "name", Type: FieldTypeString},
+	{Code: "price", Type: FieldTypeFloat64},
+}
+
+func TestParseFilterExpr(t *testing.T) {
+	var tests = []struct {
+		expr string
+		want FilterList
+	}{
+		{``, FilterList{}},
+		{`height = 5`, FilterList{NewFilter("height", FilterModeEqual, "5")}},
+		{`height == 5`, FilterList{NewFilter("height", FilterModeEqual, "5")}},
+		{`height eq 5`, FilterList{NewFilter("height", FilterModeEqual, "5")}},
+		{`height != 5`, FilterList{NewFilter("height", FilterModeNotEqual, "5")}},
+		{`height <> 5`, FilterList{NewFilter("height", FilterModeNotEqual, "5")}},
+		{`height>5&&height<=9`, FilterList{
+			NewFilter("height", FilterModeGt, "5"),
+			NewFilter("height", FilterModeLte, "9"),
+		}},
+		{`height >= 5, height < 9 AND height LTE 8`, FilterList{
+			NewFilter("height", FilterModeGte, "5"),
+			NewFilter("height", FilterModeLt, "9"),
+			NewFilter("height", FilterModeLte, "8"),
+		}},
+		{`height in (1, 2,3)`, FilterList{NewFilter("height", FilterModeIn, "1,2,3")}},
+		{`height in 1`, FilterList{NewFilter("height", FilterModeIn, "1")}},
+		{`height not in [1]`, FilterList{NewFilter("height", FilterModeNotIn, "1")}},
+		{`height nin (1, 2)`, FilterList{NewFilter("height", FilterModeNotIn, "1,2")}},
+		{`height between 1 and 2 and price rg (1.5, 2)`, FilterList{
+			NewFilter("height", FilterModeRange, "1,2"),
+			NewFilter("price", FilterModeRange, "1.5,2"),
+		}},
+		{`name ~ "^a\d"`, FilterList{NewFilter("name", FilterModeRegexp, `^a\d`)}},
+		{`name =~ 'it\'s' and name re x`, FilterList{
+			NewFilter("name", FilterModeRegexp, "it's"),
+			NewFilter("name", FilterModeRegexp, "x"),
+		}},
+		{`name = "a, b" and name in ("x y", "and")`, FilterList{
+			NewFilter("name", FilterModeEqual, "a, b"),
+			NewFilter("name", FilterModeIn, "x y,and"),
+		}},
+		{`name = "ä\t\n\""`, FilterList{NewFilter("name", FilterModeEqual, "ä\t\n\"")}},
+	}
+	for _, test := range tests {
+		got, err := ParseFilterExpr(test.expr, exprFields...)
+		if err != nil {
+			t.Errorf("%s: %v", test.expr, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %s, want %s", test.expr, got, test.want)
+		}
+	}
+}
+
+func TestFilterExprError(t *testing.T) {
+	var tests = []struct {
+		expr   string
+		fields []Datafield
+		pos    int
+		msg    string
+	}{
+		{`height >`, nil, 9, "expected value"},
+		{`height ! 5`, nil, 8, "unexpected character"},
+		{`height & 5`, nil, 8, "unexpected character"},
+		{`height >= 5 or a = 1`, nil, 13, "'or' is not supported"},
+		{`height = 5 and`, nil, 15, "expected condition"},
+		{`height = 5 x`, nil, 12, "expected 'and'"},
+		{`= 5`, nil, 1, "expected column name"},
+		{`height foo 5`, nil, 8, "expected filter operator"},
+		{`height >= > 5`, nil, 11, "expected value"},
+		{`height not 5`, nil, 12, "expected 'in'"},
+		{`height between 1 2`, nil, 18, "expected 'and'"},
+		{`height in (1 2)`, nil, 14, "expected ',' or ')'"},
+		{`height in (1,`, nil, 14, "expected value"},
+		{`height in >`, nil, 11, "expected '('"},
+		{`height rg (1)`, nil, 8, "exactly two values"},
+		{`height in ("a,b")`, nil, 12, "comma"},
+		{`name = "abc`, nil, 8, "unterminated string"},
+		{`name = "abc\`, nil, 13, "unterminated escape"},
+		{`ä = 1 and b`, nil, 12, "expected filter operator"},
+		{`nope = 1`, exprFields, 1, "unknown column"},
+		{`height = abc`, exprFields, 10, "not of type"},
+		{`height in (1, x)`, exprFields, 15, "not of type"},
+		{`price between 1 and x`, exprFields, 21, "not of type"},
+		{`hash > ab`, exprFields, 6, "unsupported"},
+		{`height ~ 1`, exprFields, 8, "unsupported"},
+	}
+	for _, test := range tests {
+		_, err := ParseFilterExpr(test.expr, test.fields...)
+		var e *FilterExprError
+		if !errors.As(err, &e) {
+			t.Errorf("%s: got %v, want FilterExprError", test.expr, err)
+			continue
+		}
+		if e.Pos != test.pos || e.Expr != test.expr || !strings.Contains(e.Msg, test.msg) {
+			t.Errorf("%s: got position %d %q, want %d %q", test.expr, e.Pos, e.Msg, test.pos, test.msg)
+		}
+	}
+}
+
+func TestFilterExprRoundTrip(t *testing.T) {
+	f := func(seed int64) bool {
+		l := FilterList(randFilters(rand.New(rand.NewSource(seed))))
+		got, err := ParseFilterExpr(l.String())
+		if err != nil {
+			t.Logf("%s: %v", l, err)
+			return false
+		}
+		if len(got) != len(l) || (len(l) > 0 && !reflect.DeepEqual(got, l)) {
+			t.Logf("%s: got %#v", l, got)
+			return false
+		}
+		return got.String() == l.String()
+	}
+	if err := quick.Check(f, quickConfig); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestParseFilterMode(t *testing.T) {
+	// the URL form only accepts mode names
+	for m := FilterModeEqual; m < FilterModeInvalid; m++ {
+		if got := ParseFilterMode(m.String()); got != m {
+			t.Errorf("%s: got %s", m, got)
+		}
+		if got := ParseFilterMode(strings.ToUpper(m.String())); got != m {
+			t.Errorf("%s: got %s", strings.ToUpper(m.String()), got)
+		}
+		op := m.Operator()
+		if op == m.String() {
+			continue
+		}
+		if got := ParseFilterMode(op); got != FilterModeInvalid {
+			t.Errorf("%s: got %s, want invalid", op, got)
+		}
+		if _, err := ParseFilter("height."+op, "1"); err == nil {
+			t.Errorf("%s: expected invalid filter mode error", op)
+		}
+	}
+	for _, s := range []string{"=", "==", "!=", "<>", "~", "=~", "range", "between", "x"} {
+		if got := ParseFilterMode(s); got != FilterModeInvalid {
+			t.Errorf("%s: got %s, want invalid", s, got)
+		}
+	}
+	if _, err := ParseTableParams(url.Values{"height.>=": {"5"}}); err == nil {
+		t.Error("expected error for symbolic mode in URL query")
+	}
+
+	// expressions accept operators and mode names
+	for m := FilterModeEqual; m < FilterModeInvalid; m++ {
+		for _, op := range []string{m.Operator(), m.String()} {
+			expr := "height " + op + " 1"
+			switch {
+			case m == FilterModeRange && op == m.Operator():
+				expr = "height between 1 and 2"
+			case m == FilterModeIn, m == FilterModeNotIn, m == FilterModeRange:
+				expr = "height " + op + " (1, 2)"
+			}
+			l, err := ParseFilterExpr(expr)
+			if err != nil {
+				t.Errorf("%s: %v", expr, err)
+				continue
+			}
+			if len(l) != 1 || l[0].Mode != m {
+				t.Errorf("%s: got %s", expr, l)
+			}
+		}
+	}
+}
@@ -0,0 +1,325 @@
+// Copyright (c) 2020 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package blockwatch
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// FilledColumn is the code of the boolean column that marks rows synthesized
+// by FillGaps.
+const FilledColumn = "filled"
+
+// Gap is a range of missing collapse buckets [Start, End). Row is the
+// position of the row that follows the gap in time order.
+type Gap struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	Count int       `json:"count"`
+	Row   int       `json:"row"`
+}
+
+// Duplicate lists rows that share the same timestamp.
+type Duplicate struct {
+	Time time.Time `json:"time"`
+	Rows []int     `json:"rows"`
+}
+
+// GapReport describes the continuity of a series. Expected is the number of
+// collapse buckets between the first and the last row, Actual is the number
+// of distinct buckets that contain data. OutOfOrder lists rows whose
+// timestamp violates the series order.
+type GapReport struct {
+	Collapse   CollapseMode `json:"collapse"`
+	Start      time.Time    `json:"start"`
+	End        time.Time    `json:"end"`
+	Expected   int          `json:"expected"`
+	Actual     int          `json:"actual"`
+	Gaps       []Gap        `json:"gaps"`
+	Duplicates []Duplicate  `json:"duplicates"`
+	OutOfOrder []int        `json:"out_of_order"`
+}
+
+// IsContinuous returns true when the series has no gaps, duplicates or
+// out-of-order rows.
+func (r *GapReport) IsContinuous() bool {
+	return len(r.Gaps) == 0 && len(r.Duplicates) == 0 && len(r.OutOfOrder) == 0
+}
+
+// Missing returns the total number of missing buckets.
+func (r *GapReport) Missing() int {
+	var n int
+	for _, g := range r.Gaps {
+		n += g.Count
+	}
+	return n
+}
+
+// Gaps checks the continuity of a series with collapse buckets in UTC.
+// See GapsIn for details.
+func (s *Series) Gaps() (*GapReport, error) {
+	return s.GapsIn(time.UTC)
+}
+
+// GapsIn reports missing collapse buckets between the first and the last row,
+// duplicate timestamps and rows that are out of order. Buckets are aligned in
+// time zone loc using calendar aware stepping. Rows without timestamp are
+// ignored. The series must have a collapse mode with a fixed step.
+func (s *Series) GapsIn(loc *time.Location) (*GapReport, error) {
+	if !s.Collapse.HasStep() {
+		return nil, fmt.Errorf("blockwatch: gap detection requires a collapse mode, got '%s'", s.Collapse)
+	}
+	if loc == nil {
+		loc = time.UTC
+	}
+	times, idx, err := s.sortedTimes()
+	if err != nil {
+		return nil, err
+	}
+	r := &GapReport{
+		Collapse:   s.Collapse,
+		Gaps:       make([]Gap, 0),
+		Duplicates: make([]Duplicate, 0),
+		OutOfOrder: make([]int, 0),
+	}
+
+	// out-of-order rows in original row order
+	var prev time.Time
+	desc := s.Order == OrderDesc
+	for i, t := range times {
+		if t.IsZero() {
+			continue
+		}
+		if !prev.IsZero() && (!desc && t.Before(prev) || desc && t.After(prev)) {
+			r.OutOfOrder = append(r.OutOfOrder, i)
+			continue
+		}
+		prev = t
+	}
+	if len(idx) == 0 {
+		return r, nil
+	}
+
+	// duplicates and gaps in time order
+	m := s.Collapse
+	r.Start = m.Truncate(times[idx[0]], loc)
+	r.End = m.Next(m.Truncate(times[idx[len(idx)-1]], loc))
+	r.Expected = m.Count(r.Start, r.End)
+	last := r.Start
+	r.Actual = 1
+	for k := 1; k < len(idx); k++ {
+		i, p := idx[k], idx[k-1]
+		if times[i].Equal(times[p]) {
+			if n := len(r.Duplicates); n > 0 && r.Duplicates[n-1].Time.Equal(times[i]) {
+				r.Duplicates[n-1].Rows = append(r.Duplicates[n-1].Rows, i)
+			} else {
+				r.Duplicates = append(r.Duplicates, Duplicate{Time: times[i], Rows: []int{p, i}})
+			}
+		}
+		b := m.Truncate(times[i], loc)
+		if b.Equal(last) {
+			continue
+		}
+		r.Actual++
+		if next := m.Next(last); b.After(next) {
+			r.Gaps = append(r.Gaps, Gap{
+				Start: next,
+				End:   b,
+				Count: m.Count(next, b),
+				Row:   i,
+			})
+		}
+		last = b
+	}
+	return r, nil
+}
+
+// sortedTimes returns all row timestamps and the positions of rows with
+// timestamp sorted by time.
+func (s *Series) sortedTimes() ([]time.Time, []int, error) {
+	tcol := s.TimeColumn()
+	if tcol < 0 {
+		return nil, nil, fmt.Errorf("blockwatch: missing time column")
+	}
+	times, err := s.decodeTimeColumn(tcol, s.Columns[tcol].Code)
+	if err != nil {
+		return nil, nil, err
+	}
+	idx := make([]int, 0, len(times))
+	for i, t := range times {
+		if !t.IsZero() {
+			idx = append(idx, i)
+		}
+	}
+	sort.SliceStable(idx, func(i, j int) bool { return times[idx[i]].Before(times[idx[j]]) })
+	return times, idx, nil
+}
+
+// GapFillMode defines how FillGaps synthesizes rows for missing buckets.
+type GapFillMode int
+
+const (
+	GapFillForward     GapFillMode = iota // repeat the previous row
+	GapFillZeroVolume                     // OHLCV candles at the previous close with zero volume
+	GapFillInterpolate                    // linear interpolation of numeric columns
+)
+
+func (m GapFillMode) String() string {
+	switch m {
+	case GapFillForward:
+		return "forward"
+	case GapFillZeroVolume:
+		return "zero_volume"
+	case GapFillInterpolate:
+		return "interpolate"
+	default:
+		return "invalid"
+	}
+}
+
+// FillGaps fills missing buckets with collapse buckets in UTC. See
+// FillGapsIn for details.
+func (s *Series) FillGaps(mode GapFillMode) (*Series, error) {
+	return s.FillGapsIn(time.UTC, mode)
+}
+
+// FillGapsIn returns a copy of the series with one synthesized row for each
+// missing collapse bucket. Rows are sorted by time and keep the series order.
+// A boolean FilledColumn is added (or updated when it exists) which is true
+// for synthesized rows.
+//
+// GapFillForward repeats all values of the previous row. GapFillZeroVolume
+// sets OHLC, vwap and mean to the previous close and counts, volumes and
+// stddev to zero, other columns repeat their previous value. GapFillInterpolate
+// interpolates numeric columns linearly in time between the rows around a gap
+// and repeats all other values.
+func (s *Series) FillGapsIn(loc *time.Location, mode GapFillMode) (*Series, error) {
+	if !s.Collapse.HasStep() {
+		return nil, fmt.Errorf("blockwatch: gap filling requires a collapse mode, got '%s'", s.Collapse)
+	}
+	if loc == nil {
+		loc = time.UTC
+	}
+	times, idx, err := s.sortedTimes()
+	if err != nil {
+		return nil, err
+	}
+	tcol := s.TimeColumn()
+	fcol := s.columnIndex(FilledColumn)
+	fields := s.Columns
+	if fcol < 0 {
+		fcol = len(fields)
+		fields = append(fields[:len(fields):len(fields)], Datafield{
+			Name: "Filled",
+			Code: FilledColumn,
+			Type: FieldTypeBoolean,
+		})
+	}
+	out := NewDataframe(fields...)
+	m := s.Collapse
+
+	var (
+		prev     []interface{}
+		prevTime time.Time
+	)
+	for _, i := range idx {
+		vals, err := s.RowValues(i)
+		if err != nil {
+			return nil, err
+		}
+		if len(vals) < len(fields) {
+			vals = append(vals, false)
+		} else if vals[fcol] == nil {
+			vals[fcol] = false
+		}
+		b := m.Truncate(times[i], loc)
+		if prev != nil {
+			for t := m.Next(m.Truncate(prevTime, loc)); t.Before(b); t = m.Next(t) {
+				row := fillRow(s.Columns, mode, prev, vals, prevTime, times[i], t)
+				row[tcol] = t
+				row[fcol] = true
+				if err := out.Append(row...); err != nil {
+					return nil, err
+				}
+			}
+		}
+		if err := out.Append(vals...); err != nil {
+			return nil, err
+		}
+		prev, prevTime = vals, times[i]
+	}
+
+	res := &Series{
+		Dataframe: *out,
+		Collapse:  s.Collapse,
+		Order:     OrderAsc,
+		StartDate: s.StartDate,
+		EndDate:   s.EndDate,
+		Limit:     s.Limit,
+		Count:     len(out.Data),
+		Cursor:    s.Cursor,
+	}
+	if s.Order == OrderDesc {
+		res.Order = OrderDesc
+		for i, j := 0, len(res.Data)-1; i < j; i, j = i+1, j-1 {
+			res.Data[i], res.Data[j] = res.Data[j], res.Data[i]
+		}
+	}
+	return res, nil
+}
+
+// fillRow synthesizes a row at time t between rows prev and next.
+func fillRow(cols []Datafield, mode GapFillMode, prev, next []interface{}, t0, t1, t time.Time) []interface{} {
+	row := make([]interface{}, len(prev))
+	copy(row, prev)
+	switch mode {
+	case GapFillZeroVolume:
+		var close interface{}
+		for i, c := range cols {
+			if c.Code == "close" {
+				close = prev[i]
+			}
+		}
+		for i, c := range cols {
+			switch c.Code {
+			case "open", "high", "low", "close", "vwap", "mean":
+				if close != nil {
+					row[i] = close
+				}
+			case "stddev":
+				row[i] = 0.0
+			default:
+				if rule, ok := OhlcvResampleRules[c.Code]; ok && rule.Func == AggSum {
+					row[i] = 0
+				}
+			}
+		}
+	case GapFillInterpolate:
+		span := t1.Sub(t0)
+		if span <= 0 {
+			break
+		}
+		f := float64(t.Sub(t0)) / float64(span)
+		for i, c := range cols {
+			a, aok := toFloat64(prev[i])
+			b, bok := toFloat64(next[i])
+			if !aok || !bok {
+				continue
+			}
+			v := a + f*(b-a)
+			switch c.Type {
+			case FieldTypeFloat64:
+				row[i] = v
+			case FieldTypeInt64:
+				row[i] = int64(math.Round(v))
+			case FieldTypeUint64:
+				row[i] = uint64(math.Round(v))
+			}
+		}
+	}
+	return row
+}
@@ -0,0 +1,214 @@
+// Copyright (c) 2020 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package blockwatch
+
+import (
+	"fmt"
+	"sort"
+)
+
+// GroupBy groups dataframe rows by the values of one or more columns. Groups
+// are ordered by their first appearance. Rows with null values form their
+// own groups.
+type GroupBy struct {
+	frame  *Dataframe
+	cols   []int
+	groups [][]int // row positions per group
+	err    error
+}
+
+// GroupBy groups rows by the given columns. Errors are reported by Agg.
+func (t *Dataframe) GroupBy(cols ...string) *GroupBy {
+	g := &GroupBy{frame: t}
+	if err := t.initType(nil); err != nil {
+		g.err = err
+		return g
+	}
+	if len(cols) == 0 {
+		g.err = fmt.Errorf("blockwatch: group by requires at least one column")
+		return g
+	}
+	for _, name := range cols {
+		col := t.columnIndex(name)
+		if col < 0 {
+			g.err = fmt.Errorf("blockwatch: group by: missing column '%s'", name)
+			return g
+		}
+		g.cols = append(g.cols, col)
+	}
+	index := make(map[string]int)
+	for i := range t.Data {
+		key := make([]interface{}, len(g.cols))
+		for j, c := range g.cols {
+			if t.IsNullAt(c, i) {
+				continue
+			}
+			v, err := t.FieldAt(c, i)
+			if err != nil {
+				g.err = err
+				return g
+			}
+			key[j] = v
+		}
+		s := groupKeyString(key)
+		n, ok := index[s]
+		if !ok {
+			n = len(g.groups)
+			index[s] = n
+			g.groups = append(g.groups, nil)
+		}
+		g.groups[n] = append(g.groups[n], i)
+	}
+	return g
+}
+
+// groupKeyString returns a hashable key that distinguishes null values.
+func groupKeyString(key []interface{}) string {
+	b := make([]byte, 0, 16*len(key))
+	for _, v := range key {
+		if v == nil {
+			b = append(b, 1)
+		} else {
+			b = append(b, 2)
+			b = append(b, keyString([]interface{}{v})...)
+		}
+		b = append(b, 0)
+	}
+	return string(b)
+}
+
+// Len returns the number of groups.
+func (g *GroupBy) Len() int {
+	return len(g.groups)
+}
+
+// Agg aggregates each group. The map key is the column to aggregate and the
+// result column keeps its code, so each column is aggregated at most once and
+// group columns cannot be aggregated at all. Use AggRules with different
+// result codes to compute several aggregates of one column, e.g. the min and
+// max price. The result contains the group columns followed by aggregated
+// columns in dataframe column order.
+func (g *GroupBy) Agg(funcs map[string]AggFunc) (*Dataframe, error) {
+	if g.err != nil {
+		return nil, g.err
+	}
+	rules := make(map[string]AggRule, len(funcs))
+	for name, fn := range funcs {
+		rules[name] = AggRule{Func: fn}
+	}
+	return g.AggRules(rules)
+}
+
+// AggRules aggregates each group with full control over output columns.
+// The map key is the result column code, AggRule.Source the aggregated
+// column. Aggregated columns are ordered by the position of their source
+// column, then by code. Result codes must differ from group column codes.
+func (g *GroupBy) AggRules(rules map[string]AggRule) (*Dataframe, error) {
+	if g.err != nil {
+		return nil, g.err
+	}
+	t := g.frame
+
+	// order output columns
+	type outCol struct {
+		name string
+		rule AggRule
+		src  int
+	}
+	outs := make([]outCol, 0, len(rules))
+	for name, rule := range rules {
+		for _, c := range g.cols {
+			if t.Columns[c].Code == name {
+				return nil, fmt.Errorf("blockwatch: aggregate column '%s' conflicts with group column", name)
+			}
+		}
+		src := t.columnIndex(rule.source(name))
+		if src < 0 {
+			return nil, fmt.Errorf("blockwatch: aggregate column '%s': missing source column '%s'", name, rule.source(name))
+		}
+		if err := rule.check(t.Columns[src].Type); err != nil {
+			return nil, fmt.Errorf("blockwatch: aggregate column '%s': %v", name, err)
+		}
+		outs = append(outs, outCol{name: name, rule: rule, src: src})
+	}
+	sort.Slice(outs, func(i, j int) bool {
+		if outs[i].src != outs[j].src {
+			return outs[i].src < outs[j].src
+		}
+		return outs[i].name < outs[j].name
+	})
+
+	// decode source columns
+	cache := make(map[int][]interface{})
+	load := func(col int) ([]interface{}, error) {
+		if v, ok := cache[col]; ok {
+			return v, nil
+		}
+		v, err := t.columnValues(col)
+		if err != nil {
+			return nil, err
+		}
+		cache[col] = v
+		return v, nil
+	}
+	fields := make([]Datafield, 0, len(g.cols)+len(outs))
+	for _, c := range g.cols {
+		fields = append(fields, t.Columns[c])
+	}
+	type aggCol struct {
+		typ                  FieldType
+		vals, weights, means []interface{}
+	}
+	aggs := make([]aggCol, len(outs))
+	for i, o := range outs {
+		var err error
+		a := aggCol{typ: t.Columns[o.src].Type}
+		if a.vals, err = load(o.src); err != nil {
+			return nil, err
+		}
+		switch o.rule.Func {
+		case AggWeightedMean, AggVwap, AggStd:
+			if wc := t.columnIndex(o.rule.weight()); wc >= 0 {
+				if a.weights, err = load(wc); err != nil {
+					return nil, err
+				}
+			}
+			if mc := t.columnIndex(o.rule.Mean); mc >= 0 {
+				if a.means, err = load(mc); err != nil {
+					return nil, err
+				}
+			}
+		}
+		aggs[i] = a
+		fields = append(fields, Datafield{
+			Name: t.fieldName(t.Columns[o.src].Code, o.name),
+			Code: o.name,
+			Type: o.rule.resultType(a.typ),
+		})
+	}
+
+	// aggregate groups
+	out := NewDataframe(fields...)
+	row := make([]interface{}, len(fields))
+	for _, rows := range g.groups {
+		for j, c := range g.cols {
+			row[j] = nil
+			if !t.IsNullAt(c, rows[0]) {
+				v, err := t.FieldAt(c, rows[0])
+				if err != nil {
+					return nil, err
+				}
+				row[j] = v
+			}
+		}
+		for i, o := range outs {
+			a := aggs[i]
+			row[len(g.cols)+i] = aggregate(o.rule.Func, a.typ, a.vals, rows, a.weights, a.means)
+		}
+		if err := out.Append(row...); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
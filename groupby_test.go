@@ -0,0 +1,124 @@
+// Copyright (c) 2020 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package blockwatch
+
+import (
+	"strings"
+	"testing"
+)
+
+func groupTestFrame(t *testing.T) *Dataframe {
+	df := NewDataframe(
+		Datafield{Code: "sym", Type: FieldTypeString},
+		Datafield{Code: "side", Type: FieldTypeString},
+		Datafield{Name: "Price", Code: "price", Type: FieldTypeFloat64},
+		Datafield{Code: "qty", Type: FieldTypeInt64},
+	)
+	for _, r := range [][]interface{}{
+		{"btc", "buy", 10.0, int64(1)},
+		{"eth", "sell", 2.0, int64(5)},
+		{"btc", "sell", 12.0, int64(2)},
+		{nil, "buy", 1.0, int64(1)},
+		{"btc", "buy", 11.0, nil},
+		{"eth", "sell", 3.0, int64(5)},
+		{nil, "buy", 4.0, int64(2)},
+	} {
+		if err := df.Append(r...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return df
+}
+
+func TestGroupByAgg(t *testing.T) {
+	df := groupTestFrame(t)
+	g := df.GroupBy("sym")
+	if g.Len() != 3 {
+		t.Errorf("got %d groups, want 3", g.Len())
+	}
+	res, err := g.Agg(map[string]AggFunc{"qty": AggSum, "price": AggMean})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// aggregated columns follow the dataframe order, not the map order
+	want := []Datafield{
+		{Code: "sym", Type: FieldTypeString},
+		{Name: "Price", Code: "price", Type: FieldTypeFloat64},
+		{Name: "qty", Code: "qty", Type: FieldTypeInt64},
+	}
+	for i, f := range want {
+		if res.Columns[i] != f {
+			t.Errorf("column %d: got %+v, want %+v", i, res.Columns[i], f)
+		}
+	}
+	// groups are ordered by first appearance, nulls form their own group
+	checkRows(t, res, [][]interface{}{
+		{"btc", 11.0, int64(3)},
+		{"eth", 2.5, int64(10)},
+		{nil, 2.5, int64(3)},
+	})
+
+	res, err = df.GroupBy("sym", "side").Agg(map[string]AggFunc{"qty": AggCount})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkRows(t, res, [][]interface{}{
+		{"btc", "buy", int64(1)},
+		{"eth", "sell", int64(2)},
+		{"btc", "sell", int64(1)},
+		{nil, "buy", int64(2)},
+	})
+}
+
+func TestGroupByAggRules(t *testing.T) {
+	df := groupTestFrame(t)
+	res, err := df.GroupBy("side").AggRules(map[string]AggRule{
+		"high":    {Func: AggMax, Source: "price"},
+		"low":     {Func: AggMin, Source: "price"},
+		"price":   {Func: AggWeightedMean, Weight: "qty"},
+		"symbols": {Func: AggDistinct, Source: "sym"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	codes := []string{"side", "symbols", "high", "low", "price"}
+	for i, c := range res.Columns {
+		if c.Code != codes[i] {
+			t.Errorf("column %d: got %s, want %s", i, c.Code, codes[i])
+		}
+	}
+	// the rule name only keeps the source name when codes match
+	if res.Columns[2].Name != "high" || res.Columns[4].Name != "Price" {
+		t.Errorf("got names %q and %q", res.Columns[2].Name, res.Columns[4].Name)
+	}
+	checkRows(t, res, [][]interface{}{
+		{"buy", int64(1), 11.0, 1.0, 19.0 / 4},
+		{"sell", int64(2), 12.0, 2.0, 49.0 / 12},
+	})
+}
+
+func TestGroupByErrors(t *testing.T) {
+	df := groupTestFrame(t)
+	var tests = []struct {
+		g     *GroupBy
+		rules map[string]AggRule
+		want  string
+	}{
+		{df.GroupBy(), nil, "at least one column"},
+		{df.GroupBy("nope"), nil, "missing column 'nope'"},
+		{df.GroupBy("sym"), map[string]AggRule{"sym": {Func: AggCount}}, "conflicts with group column"},
+		{df.GroupBy("sym"), map[string]AggRule{"x": {Func: AggSum}}, "missing source column 'x'"},
+		{df.GroupBy("sym"), map[string]AggRule{"side": {Func: AggSum}}, "unsupported on string columns"},
+		{df.GroupBy("sym"), map[string]AggRule{"qty": {Func: "foo"}}, "unknown aggregation"},
+	}
+	for _, test := range tests {
+		_, err := test.g.AggRules(test.rules)
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("got error %v, want %q", err, test.want)
+		}
+	}
+	if _, err := df.GroupBy().Agg(nil); err == nil {
+		t.Error("expected error from Agg")
+	}
+}
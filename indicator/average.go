@@ -0,0 +1,98 @@
+// Copyright (c) 2020 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package indicator
+
+import (
+	"math"
+)
+
+// SMAState is the incremental form of SMA.
+type SMAState struct {
+	w window
+}
+
+func NewSMA(n int) *SMAState {
+	return &SMAState{w: newWindow(n)}
+}
+
+// Update adds a value and returns the mean of the last n values. The result
+// is valid after n values.
+func (s *SMAState) Update(v float64) (float64, bool) {
+	if !math.IsNaN(v) {
+		s.w.push(v)
+	}
+	return s.Value()
+}
+
+// Value returns the current result.
+func (s *SMAState) Value() (float64, bool) {
+	if !s.w.full() {
+		return math.NaN(), false
+	}
+	return s.w.mean(), true
+}
+
+// SMA returns the simple moving average over n values.
+func SMA(vals []float64, n int) []float64 {
+	return apply(vals, NewSMA(n).Update)
+}
+
+// EMAState is the incremental form of EMA.
+type EMAState struct {
+	n     int
+	alpha float64
+	count int
+	value float64
+}
+
+func NewEMA(n int) *EMAState {
+	if n < 1 {
+		n = 1
+	}
+	return &EMAState{n: n, alpha: 2 / float64(n+1)}
+}
+
+// Update adds a value and returns the exponential moving average. The
+// average is seeded with the simple mean of the first n values and is valid
+// after n values.
+func (s *EMAState) Update(v float64) (float64, bool) {
+	if !math.IsNaN(v) {
+		switch {
+		case s.count < s.n:
+			s.value += (v - s.value) / float64(s.count+1)
+		default:
+			s.value += s.alpha * (v - s.value)
+		}
+		s.count++
+	}
+	return s.Value()
+}
+
+// Value returns the current result.
+func (s *EMAState) Value() (float64, bool) {
+	if s.count < s.n {
+		return math.NaN(), false
+	}
+	return s.value, true
+}
+
+// EMA returns the exponential moving average with smoothing factor 2/(n+1).
+func EMA(vals []float64, n int) []float64 {
+	return apply(vals, NewEMA(n).Update)
+}
+
+// apply runs an incremental update function over a vector. Rows with NaN
+// input or invalid result are NaN.
+func apply(vals []float64, fn func(float64) (float64, bool)) []float64 {
+	res := nans(len(vals))
+	for i, v := range vals {
+		if math.IsNaN(v) {
+			continue
+		}
+		if x, ok := fn(v); ok {
+			res[i] = x
+		}
+	}
+	return res
+}
@@ -0,0 +1,200 @@
+// Copyright (c) 2020 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+// Package indicator implements technical indicators on Ohlcv bars and
+// numeric column vectors.
+//
+// Every indicator is available in two forms. Vector functions such as SMA
+// take a full input vector and return output vectors of the same length
+// where rows during the warm-up period are NaN. Incremental types such as
+// SMAState are created with a New function and updated with one completed bar
+// at a time, which is useful when tailing live data. Update returns the
+// current value and a validity flag that is false during warm-up.
+//
+// NaN inputs (e.g. null values) are skipped by incremental types. Vector
+// functions return NaN for such rows and continue with the next value. Vector
+// functions with several inputs return only NaN when the inputs differ in
+// length.
+package indicator
+
+import (
+	"fmt"
+	"math"
+
+	"blockwatch.cc/blockwatch-go"
+)
+
+// Float64s converts a numeric column vector as returned from
+// Dataframe.Column into a float64 vector.
+func Float64s(v interface{}) ([]float64, error) {
+	switch vals := v.(type) {
+	case []float64:
+		return vals, nil
+	case []int64:
+		res := make([]float64, len(vals))
+		for i, x := range vals {
+			res[i] = float64(x)
+		}
+		return res, nil
+	case []uint64:
+		res := make([]float64, len(vals))
+		for i, x := range vals {
+			res[i] = float64(x)
+		}
+		return res, nil
+	case []interface{}:
+		res := make([]float64, len(vals))
+		for i, x := range vals {
+			switch f := x.(type) {
+			case float64:
+				res[i] = f
+			case int64:
+				res[i] = float64(f)
+			case uint64:
+				res[i] = float64(f)
+			case nil:
+				res[i] = math.NaN()
+			default:
+				return nil, fmt.Errorf("indicator: unsupported value type %T", x)
+			}
+		}
+		return res, nil
+	default:
+		return nil, fmt.Errorf("indicator: unsupported vector type %T", v)
+	}
+}
+
+// Column decodes a numeric dataframe column into a float64 vector. Null
+// values in float columns are returned as NaN.
+func Column(t *blockwatch.Dataframe, name string) ([]float64, error) {
+	_, v, err := t.Column(name)
+	if err != nil {
+		return nil, err
+	}
+	return Float64s(v)
+}
+
+// Opens returns the open prices of bars.
+func Opens(bars []blockwatch.Ohlcv) []float64 {
+	res := make([]float64, len(bars))
+	for i, b := range bars {
+		res[i] = b.Open
+	}
+	return res
+}
+
+// Highs returns the high prices of bars.
+func Highs(bars []blockwatch.Ohlcv) []float64 {
+	res := make([]float64, len(bars))
+	for i, b := range bars {
+		res[i] = b.High
+	}
+	return res
+}
+
+// Lows returns the low prices of bars.
+func Lows(bars []blockwatch.Ohlcv) []float64 {
+	res := make([]float64, len(bars))
+	for i, b := range bars {
+		res[i] = b.Low
+	}
+	return res
+}
+
+// Closes returns the close prices of bars.
+func Closes(bars []blockwatch.Ohlcv) []float64 {
+	res := make([]float64, len(bars))
+	for i, b := range bars {
+		res[i] = b.Close
+	}
+	return res
+}
+
+// Volumes returns the base volumes of bars.
+func Volumes(bars []blockwatch.Ohlcv) []float64 {
+	res := make([]float64, len(bars))
+	for i, b := range bars {
+		res[i] = b.BaseVolume
+	}
+	return res
+}
+
+// Typicals returns the typical price (high+low+close)/3 of bars.
+func Typicals(bars []blockwatch.Ohlcv) []float64 {
+	res := make([]float64, len(bars))
+	for i, b := range bars {
+		res[i] = (b.High + b.Low + b.Close) / 3
+	}
+	return res
+}
+
+// Valid returns a validity flag for each value of an indicator vector.
+func Valid(vals []float64) []bool {
+	res := make([]bool, len(vals))
+	for i, v := range vals {
+		res[i] = !math.IsNaN(v)
+	}
+	return res
+}
+
+// nans returns a vector of length n filled with NaN.
+func nans(n int) []float64 {
+	res := make([]float64, n)
+	for i := range res {
+		res[i] = math.NaN()
+	}
+	return res
+}
+
+// window is a fixed size ring buffer with running sums.
+type window struct {
+	buf   []float64
+	pos   int
+	count int
+	sum   float64
+	sum2  float64
+}
+
+func newWindow(n int) window {
+	if n < 1 {
+		n = 1
+	}
+	return window{buf: make([]float64, n)}
+}
+
+func (w *window) push(v float64) {
+	n := len(w.buf)
+	if w.count == n {
+		old := w.buf[w.pos]
+		w.sum -= old
+		w.sum2 -= old * old
+	} else {
+		w.count++
+	}
+	w.buf[w.pos] = v
+	w.sum += v
+	w.sum2 += v * v
+	w.pos = (w.pos + 1) % n
+	if w.pos == 0 {
+		// recompute running sums once per cycle to limit rounding drift
+		w.sum, w.sum2 = 0, 0
+		for _, x := range w.buf[:w.count] {
+			w.sum += x
+			w.sum2 += x * x
+		}
+	}
+}
+
+func (w *window) full() bool {
+	return w.count == len(w.buf)
+}
+
+func (w *window) mean() float64 {
+	return w.sum / float64(w.count)
+}
+
+// std returns the population standard deviation.
+func (w *window) std() float64 {
+	m := w.mean()
+	return math.Sqrt(math.Max(0, w.sum2/float64(w.count)-m*m))
+}
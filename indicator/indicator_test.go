@@ -0,0 +1,274 @@
+// Copyright (c) 2020 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package indicator
+
+import (
+	"math"
+	"testing"
+)
+
+// Intel closes from the StockCharts moving average example.
+var intc = []float64{
+	22.27, 22.19, 22.08, 22.17, 22.18, 22.13, 22.23, 22.43, 22.24, 22.29,
+	22.15, 22.39, 22.38, 22.61, 23.36, 24.05, 23.75, 23.83, 23.95, 23.63,
+	23.82, 23.87, 23.65, 23.19, 23.10, 23.33, 22.68, 23.10, 22.40, 22.17,
+}
+
+// Closes from the StockCharts RSI example.
+var rsiCloses = []float64{
+	44.34, 44.09, 44.15, 43.61, 44.33, 44.83, 45.10, 45.42, 45.84, 46.08,
+	45.89, 46.03, 45.61, 46.28, 46.28, 46.00, 46.03, 46.41, 46.22, 45.64,
+	46.21, 46.25, 45.71, 46.45, 45.78, 45.35, 44.03, 44.18, 44.22, 44.57,
+	43.42, 42.66, 43.13,
+}
+
+// Closes from the StockCharts Bollinger Bands example.
+var bollCloses = []float64{
+	86.16, 89.09, 88.78, 90.32, 89.07, 91.15, 89.44, 89.18, 86.93, 87.68,
+	86.96, 89.43, 89.32, 88.72, 87.45, 87.26, 89.50, 87.90, 89.13, 90.70,
+	92.90, 92.98, 91.80, 92.66, 92.68, 92.30, 92.77, 92.54, 92.95, 93.20,
+	91.07, 89.83, 89.74, 90.40, 90.74, 88.02, 88.09, 88.84, 90.78, 90.54,
+	91.39, 90.65,
+}
+
+// Bars from the StockCharts ATR example, also used for OBV and VWAP bands.
+var (
+	barHigh = []float64{
+		48.70, 48.72, 48.90, 48.87, 48.82, 49.05, 49.20, 49.35, 49.92, 50.19,
+		50.12, 49.66, 49.88, 50.19, 50.36, 50.57, 50.65, 50.43, 49.63, 50.33,
+	}
+	barLow = []float64{
+		47.79, 48.14, 48.39, 48.37, 48.24, 48.64, 48.94, 48.86, 49.50, 49.87,
+		49.20, 48.90, 49.43, 49.73, 49.26, 50.09, 50.30, 49.21, 48.98, 49.61,
+	}
+	barClose = []float64{
+		48.16, 48.61, 48.75, 48.63, 48.74, 49.03, 49.07, 49.32, 49.91, 50.13,
+		49.53, 49.50, 49.75, 50.03, 50.31, 50.52, 50.41, 49.34, 49.37, 50.23,
+	}
+	barVolume = []float64{
+		1200, 900, 1500, 800, 1100, 1700, 1300, 950, 2100, 1800,
+		2500, 1400, 1000, 1600, 1900, 2200, 1250, 3000, 2400, 1500,
+	}
+)
+
+// checkGolden compares an indicator vector against reference values that
+// start at row offset. All rows before offset must be NaN.
+func checkGolden(t *testing.T, name string, got []float64, offset int, want []float64, eps float64) {
+	t.Helper()
+	if len(got) != offset+len(want) {
+		t.Fatalf("%s: got %d rows, want %d", name, len(got), offset+len(want))
+	}
+	for i, v := range got[:offset] {
+		if !math.IsNaN(v) {
+			t.Errorf("%s[%d]: got %v during warm-up, want NaN", name, i, v)
+		}
+	}
+	for i, w := range want {
+		if v := got[offset+i]; math.IsNaN(v) || math.Abs(v-w) > eps {
+			t.Errorf("%s[%d]: got %.6f, want %.6f", name, offset+i, v, w)
+		}
+	}
+}
+
+// checkSame compares the incremental result with the vector result.
+func checkSame(t *testing.T, name string, i int, v float64, ok bool, want float64) {
+	t.Helper()
+	if ok == math.IsNaN(want) || ok && math.Abs(v-want) > 1e-9 {
+		t.Errorf("%s update %d: got %v/%t, want %v", name, i, v, ok, want)
+	}
+}
+
+func TestSMA(t *testing.T) {
+	// StockCharts 10-day SMA
+	want := []float64{
+		22.221, 22.209, 22.229, 22.259, 22.303, 22.421, 22.613, 22.765, 22.905, 23.076,
+		23.21, 23.377, 23.525, 23.652, 23.71, 23.684, 23.612, 23.505, 23.432, 23.277,
+		23.131,
+	}
+	res := SMA(intc, 10)
+	checkGolden(t, "sma", res, 9, want, 1e-9)
+	s := NewSMA(10)
+	for i, v := range intc {
+		x, ok := s.Update(v)
+		checkSame(t, "sma", i, x, ok, res[i])
+	}
+}
+
+func TestEMA(t *testing.T) {
+	// StockCharts 10-day EMA, published with two decimals
+	want := []float64{
+		22.22, 22.21, 22.24, 22.27, 22.33, 22.52, 22.80, 22.97, 23.13, 23.28,
+		23.34, 23.43, 23.51, 23.53, 23.47, 23.40, 23.39, 23.26, 23.23, 23.08,
+		22.92,
+	}
+	res := EMA(intc, 10)
+	checkGolden(t, "ema", res, 9, want, 0.005)
+	s := NewEMA(10)
+	for i, v := range intc {
+		x, ok := s.Update(v)
+		checkSame(t, "ema", i, x, ok, res[i])
+	}
+}
+
+func TestRSI(t *testing.T) {
+	// StockCharts 14-day RSI, published with averages rounded to two
+	// decimals, so values differ by up to 0.07
+	want := []float64{
+		70.53, 66.32, 66.55, 69.41, 66.36, 57.97, 62.93, 63.26, 56.06, 62.38,
+		54.71, 50.42, 39.99, 41.46, 41.87, 45.46, 37.30, 33.08, 37.77,
+	}
+	res := RSI(rsiCloses, 14)
+	checkGolden(t, "rsi", res, 14, want, 0.1)
+	s := NewRSI(14)
+	for i, v := range rsiCloses {
+		x, ok := s.Update(v)
+		checkSame(t, "rsi", i, x, ok, res[i])
+	}
+}
+
+func TestMACD(t *testing.T) {
+	// with a one period fast EMA the MACD line is the close minus the slow
+	// EMA, so it follows from the StockCharts 10-day EMA
+	ema := []float64{
+		22.22, 22.21, 22.24, 22.27, 22.33, 22.52, 22.80, 22.97, 23.13, 23.28,
+		23.34, 23.43, 23.51, 23.53, 23.47, 23.40, 23.39, 23.26, 23.23, 23.08,
+		22.92,
+	}
+	var want []float64
+	for i, e := range ema {
+		want = append(want, intc[9+i]-e)
+	}
+	macd, _, _ := MACD(intc, 1, 10, 4)
+	checkGolden(t, "macd", macd, 9, want, 0.005)
+
+	// with common periods the signal line is the EMA of the MACD line
+	macd, sig, hist := MACD(bollCloses, 12, 26, 9)
+	fast, slow := EMA(bollCloses, 12), EMA(bollCloses, 26)
+	want = nil
+	for i := 25; i < len(bollCloses); i++ {
+		want = append(want, fast[i]-slow[i])
+	}
+	checkGolden(t, "macd", macd, 25, want, 1e-9)
+	checkGolden(t, "signal", sig, 33, EMA(want, 9)[8:], 1e-9)
+	for i := range hist {
+		if h := macd[i] - sig[i]; math.IsNaN(h) != math.IsNaN(hist[i]) || math.Abs(h-hist[i]) > 1e-9 {
+			t.Errorf("hist[%d]: got %v, want %v", i, hist[i], h)
+		}
+	}
+	s := NewMACD(12, 26, 9)
+	for i, v := range bollCloses {
+		x, ok := s.Update(v)
+		checkSame(t, "macd", i, x.MACD, !math.IsNaN(x.MACD), macd[i])
+		checkSame(t, "signal", i, x.Signal, ok, sig[i])
+		checkSame(t, "hist", i, x.Histogram, ok, hist[i])
+	}
+}
+
+// StockCharts 20-day Bollinger Bands, published with two decimals
+var (
+	bollMid = []float64{
+		88.71, 89.05, 89.24, 89.39, 89.51, 89.69, 89.75, 89.91, 90.08, 90.38,
+		90.66, 90.86, 90.88, 90.90, 90.99, 91.15, 91.19, 91.12, 91.17, 91.25,
+		91.24, 91.17, 91.05,
+	}
+	bollUpper = []float64{
+		91.29, 91.95, 92.61, 92.93, 93.31, 93.73, 93.90, 94.26, 94.56, 94.79,
+		95.04, 94.91, 94.90, 94.89, 94.86, 94.67, 94.55, 94.68, 94.57, 94.53,
+		94.53, 94.37, 94.15,
+	}
+	bollLower = []float64{
+		86.13, 86.14, 85.87, 85.85, 85.70, 85.65, 85.59, 85.56, 85.60, 85.98,
+		86.27, 86.82, 86.86, 86.91, 87.12, 87.63, 87.83, 87.56, 87.76, 87.97,
+		87.95, 87.96, 87.95,
+	}
+)
+
+func TestBollinger(t *testing.T) {
+	mid, upper, lower := Bollinger(bollCloses, 20, 2)
+	checkGolden(t, "mid", mid, 19, bollMid, 0.005)
+	checkGolden(t, "upper", upper, 19, bollUpper, 0.005)
+	checkGolden(t, "lower", lower, 19, bollLower, 0.005)
+	s := NewBollinger(20, 2)
+	for i, v := range bollCloses {
+		b, ok := s.Update(v)
+		checkSame(t, "mid", i, b.Middle, ok, mid[i])
+		checkSame(t, "upper", i, b.Upper, ok, upper[i])
+		checkSame(t, "lower", i, b.Lower, ok, lower[i])
+	}
+}
+
+func TestATR(t *testing.T) {
+	// StockCharts 14-day ATR, published with two decimals
+	want := []float64{0.55, 0.59, 0.59, 0.57, 0.61, 0.62, 0.64}
+	res := ATR(barHigh, barLow, barClose, 14)
+	checkGolden(t, "atr", res, 13, want, 0.005)
+	s := NewATR(14)
+	for i := range barClose {
+		x, ok := s.Update(barHigh[i], barLow[i], barClose[i])
+		checkSame(t, "atr", i, x, ok, res[i])
+	}
+	for i, v := range ATR(barHigh, barLow[1:], barClose, 14) {
+		if !math.IsNaN(v) {
+			t.Errorf("atr length mismatch [%d]: got %v, want NaN", i, v)
+		}
+	}
+}
+
+func TestOBV(t *testing.T) {
+	want := []float64{
+		0, 900, 2400, 1600, 2700, 4400, 5700, 6650, 8750, 10550,
+		8050, 6650, 7650, 9250, 11150, 13350, 12100, 9100, 11500, 13000,
+	}
+	res := OBV(barClose, barVolume)
+	checkGolden(t, "obv", res, 0, want, 0)
+	s := NewOBV()
+	for i := range barClose {
+		x, ok := s.Update(barClose[i], barVolume[i])
+		checkSame(t, "obv", i, x, ok, res[i])
+	}
+	for i, v := range OBV(barClose, barVolume[1:]) {
+		if !math.IsNaN(v) {
+			t.Errorf("obv length mismatch [%d]: got %v, want NaN", i, v)
+		}
+	}
+}
+
+func TestVWAPBands(t *testing.T) {
+	// with equal volumes VWAP bands are Bollinger bands
+	vol := make([]float64, len(bollCloses))
+	for i := range vol {
+		vol[i] = 7
+	}
+	mid, upper, lower := VWAPBands(bollCloses, vol, 20, 2)
+	checkGolden(t, "vwap", mid, 19, bollMid, 0.005)
+	checkGolden(t, "vwap upper", upper, 19, bollUpper, 0.005)
+	checkGolden(t, "vwap lower", lower, 19, bollLower, 0.005)
+
+	// a price traded with twice the volume counts twice
+	mid, upper, _ = VWAPBands([]float64{1, 2, 3}, []float64{1, 1, 2}, 2, 1)
+	checkGolden(t, "vwap", mid, 1, []float64{1.5, 8.0 / 3}, 1e-9)
+	checkGolden(t, "vwap upper", upper, 1, []float64{2, 8.0/3 + math.Sqrt2/3}, 1e-9)
+
+	mid, upper, lower = VWAPBands(barClose, barVolume, 5, 2)
+	s := NewVWAPBands(5, 2)
+	for i := range barClose {
+		b, ok := s.Update(barClose[i], barVolume[i])
+		checkSame(t, "vwap", i, b.Middle, ok, mid[i])
+		checkSame(t, "vwap upper", i, b.Upper, ok, upper[i])
+		checkSame(t, "vwap lower", i, b.Lower, ok, lower[i])
+	}
+	mid, _, _ = VWAPBands(barClose[1:], barVolume, 5, 2)
+	for i, v := range mid {
+		if !math.IsNaN(v) {
+			t.Errorf("vwap length mismatch [%d]: got %v, want NaN", i, v)
+		}
+	}
+}
+
+func TestNaNInputs(t *testing.T) {
+	s := SMA([]float64{1, 2, math.NaN(), 3, 4}, 2)
+	if !math.IsNaN(s[0]) || s[1] != 1.5 || !math.IsNaN(s[2]) || s[3] != 2.5 || s[4] != 3.5 {
+		t.Errorf("sma nan: got %v", s)
+	}
+}
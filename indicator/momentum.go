@@ -0,0 +1,142 @@
+// Copyright (c) 2020 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package indicator
+
+import (
+	"math"
+)
+
+// RSIState is the incremental form of RSI.
+type RSIState struct {
+	n       int
+	count   int // number of price changes
+	prev    float64
+	hasPrev bool
+	gain    float64
+	loss    float64
+}
+
+func NewRSI(n int) *RSIState {
+	if n < 1 {
+		n = 1
+	}
+	return &RSIState{n: n}
+}
+
+// Update adds a price and returns the relative strength index. Average gains
+// and losses are seeded with the simple mean of the first n price changes and
+// then smoothed with Wilder's method. The result is valid after n+1 prices.
+func (s *RSIState) Update(v float64) (float64, bool) {
+	if math.IsNaN(v) {
+		return s.Value()
+	}
+	if !s.hasPrev {
+		s.prev, s.hasPrev = v, true
+		return s.Value()
+	}
+	d := v - s.prev
+	s.prev = v
+	gain, loss := math.Max(d, 0), math.Max(-d, 0)
+	n := float64(s.n)
+	if s.count < s.n {
+		s.gain += gain / n
+		s.loss += loss / n
+	} else {
+		s.gain = (s.gain*(n-1) + gain) / n
+		s.loss = (s.loss*(n-1) + loss) / n
+	}
+	s.count++
+	return s.Value()
+}
+
+// Value returns the current result.
+func (s *RSIState) Value() (float64, bool) {
+	if s.count < s.n {
+		return math.NaN(), false
+	}
+	switch {
+	case s.loss == 0 && s.gain == 0:
+		return 50, true
+	case s.loss == 0:
+		return 100, true
+	default:
+		return 100 - 100/(1+s.gain/s.loss), true
+	}
+}
+
+// RSI returns Wilder's relative strength index over n periods.
+func RSI(vals []float64, n int) []float64 {
+	return apply(vals, NewRSI(n).Update)
+}
+
+// MACDValue holds the MACD line, the signal line and the histogram.
+type MACDValue struct {
+	MACD      float64
+	Signal    float64
+	Histogram float64
+}
+
+// MACDState is the incremental form of MACD.
+type MACDState struct {
+	fast   *EMAState
+	slow   *EMAState
+	signal *EMAState
+}
+
+func NewMACD(fast, slow, signal int) *MACDState {
+	return &MACDState{
+		fast:   NewEMA(fast),
+		slow:   NewEMA(slow),
+		signal: NewEMA(signal),
+	}
+}
+
+// Update adds a price and returns the current MACD values. The MACD line is
+// available after slow prices, the signal line and histogram signal-1 prices
+// later. The validity flag is true when all values are available, missing
+// values are NaN.
+func (s *MACDState) Update(v float64) (MACDValue, bool) {
+	if !math.IsNaN(v) {
+		f, _ := s.fast.Update(v)
+		sl, ok := s.slow.Update(v)
+		if ok {
+			s.signal.Update(f - sl)
+		}
+	}
+	return s.Value()
+}
+
+// Value returns the current result.
+func (s *MACDState) Value() (MACDValue, bool) {
+	res := MACDValue{math.NaN(), math.NaN(), math.NaN()}
+	f, _ := s.fast.Value()
+	sl, ok := s.slow.Value()
+	if !ok {
+		return res, false
+	}
+	res.MACD = f - sl
+	sig, ok := s.signal.Value()
+	if !ok {
+		return res, false
+	}
+	res.Signal = sig
+	res.Histogram = res.MACD - sig
+	return res, true
+}
+
+// MACD returns the moving average convergence divergence line (fast EMA minus
+// slow EMA), its signal line (EMA of the MACD line) and the histogram (MACD
+// minus signal). Common periods are 12, 26 and 9.
+func MACD(vals []float64, fast, slow, signal int) (macd, sig, hist []float64) {
+	macd, sig, hist = nans(len(vals)), nans(len(vals)), nans(len(vals))
+	s := NewMACD(fast, slow, signal)
+	for i, v := range vals {
+		if math.IsNaN(v) {
+			continue
+		}
+		m, _ := s.Update(v)
+		macd[i], sig[i], hist[i] = m.MACD, m.Signal, m.Histogram
+	}
+	return
+}
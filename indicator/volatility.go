@@ -0,0 +1,142 @@
+// Copyright (c) 2020 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package indicator
+
+import (
+	"math"
+
+	"blockwatch.cc/blockwatch-go"
+)
+
+// BandValue holds the middle, upper and lower line of a band indicator.
+type BandValue struct {
+	Middle float64
+	Upper  float64
+	Lower  float64
+}
+
+func nanBand() BandValue {
+	return BandValue{math.NaN(), math.NaN(), math.NaN()}
+}
+
+// BollingerState is the incremental form of Bollinger.
+type BollingerState struct {
+	w window
+	k float64
+}
+
+func NewBollinger(n int, k float64) *BollingerState {
+	return &BollingerState{w: newWindow(n), k: k}
+}
+
+// Update adds a price and returns the current bands. The result is valid
+// after n prices.
+func (s *BollingerState) Update(v float64) (BandValue, bool) {
+	if !math.IsNaN(v) {
+		s.w.push(v)
+	}
+	return s.Value()
+}
+
+// Value returns the current result.
+func (s *BollingerState) Value() (BandValue, bool) {
+	if !s.w.full() {
+		return nanBand(), false
+	}
+	m, d := s.w.mean(), s.k*s.w.std()
+	return BandValue{Middle: m, Upper: m + d, Lower: m - d}, true
+}
+
+// Bollinger returns Bollinger bands, the simple moving average over n prices
+// plus and minus k population standard deviations. Common parameters are
+// 20 and 2.
+func Bollinger(vals []float64, n int, k float64) (mid, upper, lower []float64) {
+	mid, upper, lower = nans(len(vals)), nans(len(vals)), nans(len(vals))
+	s := NewBollinger(n, k)
+	for i, v := range vals {
+		if math.IsNaN(v) {
+			continue
+		}
+		if b, ok := s.Update(v); ok {
+			mid[i], upper[i], lower[i] = b.Middle, b.Upper, b.Lower
+		}
+	}
+	return
+}
+
+// ATRState is the incremental form of ATR.
+type ATRState struct {
+	n       int
+	count   int
+	prev    float64 // previous close
+	hasPrev bool
+	value   float64
+}
+
+func NewATR(n int) *ATRState {
+	if n < 1 {
+		n = 1
+	}
+	return &ATRState{n: n}
+}
+
+// Update adds a bar and returns the average true range. The first true range
+// is high minus low, the average is seeded with the simple mean of the first n
+// true ranges and then smoothed with Wilder's method. The result is valid
+// after n bars.
+func (s *ATRState) Update(high, low, close float64) (float64, bool) {
+	if math.IsNaN(high) || math.IsNaN(low) || math.IsNaN(close) {
+		return s.Value()
+	}
+	tr := high - low
+	if s.hasPrev {
+		tr = math.Max(tr, math.Max(math.Abs(high-s.prev), math.Abs(low-s.prev)))
+	}
+	s.prev, s.hasPrev = close, true
+	n := float64(s.n)
+	if s.count < s.n {
+		s.value += tr / n
+	} else {
+		s.value = (s.value*(n-1) + tr) / n
+	}
+	s.count++
+	return s.Value()
+}
+
+// UpdateBar adds a bar and returns the average true range.
+func (s *ATRState) UpdateBar(b blockwatch.Ohlcv) (float64, bool) {
+	return s.Update(b.High, b.Low, b.Close)
+}
+
+// Value returns the current result.
+func (s *ATRState) Value() (float64, bool) {
+	if s.count < s.n {
+		return math.NaN(), false
+	}
+	return s.value, true
+}
+
+// ATR returns Wilder's average true range over n periods. All rows are NaN
+// when high, low and close differ in length.
+func ATR(high, low, close []float64, n int) []float64 {
+	res := nans(len(close))
+	if len(high) != len(close) || len(low) != len(close) {
+		return res
+	}
+	s := NewATR(n)
+	for i := range close {
+		if math.IsNaN(high[i]) || math.IsNaN(low[i]) || math.IsNaN(close[i]) {
+			continue
+		}
+		if v, ok := s.Update(high[i], low[i], close[i]); ok {
+			res[i] = v
+		}
+	}
+	return res
+}
+
+// BarsATR returns the average true range of bars.
+func BarsATR(bars []blockwatch.Ohlcv, n int) []float64 {
+	return ATR(Highs(bars), Lows(bars), Closes(bars), n)
+}
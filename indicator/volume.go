@@ -0,0 +1,146 @@
+// Copyright (c) 2020 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package indicator
+
+import (
+	"math"
+
+	"blockwatch.cc/blockwatch-go"
+)
+
+// OBVState is the incremental form of OBV.
+type OBVState struct {
+	prev    float64
+	hasPrev bool
+	value   float64
+}
+
+func NewOBV() *OBVState {
+	return &OBVState{}
+}
+
+// Update adds a price and volume and returns the on-balance volume. The
+// result starts at zero and is valid from the first value.
+func (s *OBVState) Update(close, vol float64) (float64, bool) {
+	if math.IsNaN(close) || math.IsNaN(vol) {
+		return s.Value()
+	}
+	if s.hasPrev {
+		switch {
+		case close > s.prev:
+			s.value += vol
+		case close < s.prev:
+			s.value -= vol
+		}
+	}
+	s.prev, s.hasPrev = close, true
+	return s.Value()
+}
+
+// Value returns the current result.
+func (s *OBVState) Value() (float64, bool) {
+	if !s.hasPrev {
+		return math.NaN(), false
+	}
+	return s.value, true
+}
+
+// OBV returns the on-balance volume, the running sum of volume signed by the
+// direction of the price change. All rows are NaN when close and vol differ
+// in length.
+func OBV(close, vol []float64) []float64 {
+	res := nans(len(close))
+	if len(vol) != len(close) {
+		return res
+	}
+	s := NewOBV()
+	for i := range close {
+		if math.IsNaN(close[i]) || math.IsNaN(vol[i]) {
+			continue
+		}
+		res[i], _ = s.Update(close[i], vol[i])
+	}
+	return res
+}
+
+// BarsOBV returns the on-balance volume of bars based on close price and
+// base volume.
+func BarsOBV(bars []blockwatch.Ohlcv) []float64 {
+	return OBV(Closes(bars), Volumes(bars))
+}
+
+// VWAPBandsState is the incremental form of VWAPBands.
+type VWAPBandsState struct {
+	price window
+	vol   window
+	pv    window // price * volume
+	pv2   window // price^2 * volume
+	k     float64
+}
+
+func NewVWAPBands(n int, k float64) *VWAPBandsState {
+	return &VWAPBandsState{
+		price: newWindow(n),
+		vol:   newWindow(n),
+		pv:    newWindow(n),
+		pv2:   newWindow(n),
+		k:     k,
+	}
+}
+
+// Update adds a price and volume and returns the current bands. The result
+// is valid after n values when the window contains volume.
+func (s *VWAPBandsState) Update(price, vol float64) (BandValue, bool) {
+	if !math.IsNaN(price) && !math.IsNaN(vol) {
+		s.price.push(price)
+		s.vol.push(vol)
+		s.pv.push(price * vol)
+		s.pv2.push(price * price * vol)
+	}
+	return s.Value()
+}
+
+// Value returns the current result.
+func (s *VWAPBandsState) Value() (BandValue, bool) {
+	if !s.vol.full() || s.vol.sum <= 0 {
+		return nanBand(), false
+	}
+	vwap := s.pv.sum / s.vol.sum
+	d := s.k * math.Sqrt(math.Max(0, s.pv2.sum/s.vol.sum-vwap*vwap))
+	return BandValue{Middle: vwap, Upper: vwap + d, Lower: vwap - d}, true
+}
+
+// VWAPBands returns the rolling volume weighted average price over n values
+// with bands at k volume weighted standard deviations. All rows are NaN when
+// price and vol differ in length.
+func VWAPBands(price, vol []float64, n int, k float64) (mid, upper, lower []float64) {
+	mid, upper, lower = nans(len(price)), nans(len(price)), nans(len(price))
+	if len(vol) != len(price) {
+		return
+	}
+	s := NewVWAPBands(n, k)
+	for i := range price {
+		if math.IsNaN(price[i]) || math.IsNaN(vol[i]) {
+			continue
+		}
+		if b, ok := s.Update(price[i], vol[i]); ok {
+			mid[i], upper[i], lower[i] = b.Middle, b.Upper, b.Lower
+		}
+	}
+	return
+}
+
+// BarsVWAPBands returns VWAP bands of bars. Each bar contributes its own
+// vwap, or its typical price when the bar has no vwap, weighted by base
+// volume.
+func BarsVWAPBands(bars []blockwatch.Ohlcv, n int, k float64) (mid, upper, lower []float64) {
+	price := make([]float64, len(bars))
+	for i, b := range bars {
+		price[i] = b.Vwap
+		if price[i] == 0 {
+			price[i] = (b.High + b.Low + b.Close) / 3
+		}
+	}
+	return VWAPBands(price, Volumes(bars), n, k)
+}
@@ -0,0 +1,201 @@
+// Copyright (c) 2020 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package blockwatch
+
+import (
+	"context"
+)
+
+// TableIterator pages through a table using cursors. Each call to Next
+// fetches the next page. Iteration stops when a page is empty or shorter
+// than the page limit, or on error. Pages are always fetched as JSON because
+// CSV responses carry no cursor, a FormatCSV setting is ignored.
+//
+//	it := c.NewTableIterator(ctx, "BTC", "BLOCK", params)
+//	for it.Next() {
+//		table := it.Table()
+//		// handle page
+//	}
+//	if err := it.Err(); err != nil {
+//		// handle error
+//	}
+type TableIterator struct {
+	client  *Client
+	ctx     context.Context
+	dbcode  string
+	setcode string
+	params  TableParams
+	table   *Table
+	err     error
+	done    bool
+}
+
+func (c *Client) NewTableIterator(ctx context.Context, dbcode, setcode string, params TableParams) *TableIterator {
+	if params.Format == FormatCSV {
+		params.Format = FormatJSON
+	}
+	return &TableIterator{
+		client:  c,
+		ctx:     ctx,
+		dbcode:  dbcode,
+		setcode: setcode,
+		params:  params,
+	}
+}
+
+// Next fetches the next page and returns false when no more data is
+// available or an error occured.
+func (it *TableIterator) Next() bool {
+	if it.done || it.err != nil {
+		return false
+	}
+	table, err := it.client.GetTable(it.ctx, it.dbcode, it.setcode, it.params)
+	if err != nil {
+		it.err = err
+		return false
+	}
+	it.table = table
+	if len(table.Data) == 0 {
+		it.done = true
+		return false
+	}
+	limit := table.Limit
+	if limit <= 0 {
+		limit = it.params.Limit
+	}
+	if table.Cursor == "" || table.Cursor == it.params.Cursor || limit > 0 && len(table.Data) < limit {
+		it.done = true
+	}
+	if table.Cursor != "" {
+		it.params.Cursor = table.Cursor
+	}
+	return true
+}
+
+// Table returns the current page.
+func (it *TableIterator) Table() *Table {
+	return it.table
+}
+
+// Dataframe returns the current page as dataframe.
+func (it *TableIterator) Dataframe() *Dataframe {
+	if it.table == nil {
+		return nil
+	}
+	return &it.table.Dataframe
+}
+
+// Err returns the first error that occured during iteration.
+func (it *TableIterator) Err() error {
+	return it.err
+}
+
+// Cursor returns the cursor that continues after the current page. Store it
+// to resume iteration later.
+func (it *TableIterator) Cursor() string {
+	return it.params.Cursor
+}
+
+// ForEach calls fn for every row of all remaining pages.
+func (it *TableIterator) ForEach(fn func(r Row) error) error {
+	for it.Next() {
+		if err := it.table.ForEach(fn); err != nil {
+			return err
+		}
+	}
+	return it.err
+}
+
+// SeriesIterator pages through a time-series using series cursors. It works
+// like TableIterator.
+type SeriesIterator struct {
+	client  *Client
+	ctx     context.Context
+	dbcode  string
+	setcode string
+	params  SeriesParams
+	series  *Series
+	err     error
+	done    bool
+}
+
+func (c *Client) NewSeriesIterator(ctx context.Context, dbcode, setcode string, params SeriesParams) *SeriesIterator {
+	return &SeriesIterator{
+		client:  c,
+		ctx:     ctx,
+		dbcode:  dbcode,
+		setcode: setcode,
+		params:  params,
+	}
+}
+
+// Next fetches the next page and returns false when no more data is
+// available or an error occured.
+func (it *SeriesIterator) Next() bool {
+	if it.done || it.err != nil {
+		return false
+	}
+	series, err := it.client.GetSeries(it.ctx, it.dbcode, it.setcode, it.params)
+	if err != nil {
+		it.err = err
+		return false
+	}
+	it.series = series
+	if len(series.Data) == 0 {
+		it.done = true
+		return false
+	}
+	limit := series.Limit
+	if limit <= 0 {
+		limit = it.params.Limit
+	}
+	if series.Cursor == "" || series.Cursor == it.params.Cursor || limit > 0 && len(series.Data) < limit {
+		it.done = true
+	}
+	if series.Cursor != "" {
+		it.params.Cursor = series.Cursor
+	}
+	return true
+}
+
+// Series returns the current page.
+func (it *SeriesIterator) Series() *Series {
+	return it.series
+}
+
+// Dataframe returns the current page as dataframe.
+func (it *SeriesIterator) Dataframe() *Dataframe {
+	if it.series == nil {
+		return nil
+	}
+	return &it.series.Dataframe
+}
+
+// Err returns the first error that occured during iteration.
+func (it *SeriesIterator) Err() error {
+	return it.err
+}
+
+// Cursor returns the cursor that continues after the current page.
+func (it *SeriesIterator) Cursor() string {
+	return it.params.Cursor
+}
+
+// ForEach calls fn for every row of all remaining pages.
+func (it *SeriesIterator) ForEach(fn func(r Row) error) error {
+	for it.Next() {
+		if err := it.series.ForEach(fn); err != nil {
+			return err
+		}
+	}
+	return it.err
+}
+
+// FrameIterator is implemented by TableIterator and SeriesIterator and used by
+// streaming consumers that process one page at a time.
+type FrameIterator interface {
+	Next() bool
+	Dataframe() *Dataframe
+	Err() error
+}
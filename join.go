@@ -0,0 +1,462 @@
+// Copyright (c) 2020 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package blockwatch
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// JoinMode defines which rows a join keeps.
+type JoinMode int
+
+const (
+	JoinInner JoinMode = iota // rows with matching keys on both sides
+	JoinLeft                  // all left rows, matching right rows or null
+	JoinOuter                 // all rows from both sides
+)
+
+func (m JoinMode) String() string {
+	switch m {
+	case JoinInner:
+		return "inner"
+	case JoinLeft:
+		return "left"
+	case JoinOuter:
+		return "outer"
+	default:
+		return "invalid"
+	}
+}
+
+// JoinSuffix is appended to right column codes that conflict with left
+// column codes. When the suffixed code is taken as well, a counter is added,
+// e.g. "price_right2".
+const JoinSuffix = "_right"
+
+// joinPlan describes the output layout of a join.
+type joinPlan struct {
+	left, right  *Dataframe
+	lkeys, rkeys []int // key column positions
+	lcols, rcols []int // non-key column positions
+	fields       []Datafield
+	lvals, rvals [][]interface{} // decoded rows, loaded on demand
+	out          *Dataframe
+	row          []interface{}
+}
+
+func newJoinPlan(left, right *Dataframe, lkeys, rkeys []int, keepRightKeys bool) *joinPlan {
+	p := &joinPlan{
+		left:  left,
+		right: right,
+		lkeys: lkeys,
+		rkeys: rkeys,
+		lvals: make([][]interface{}, len(left.Data)),
+		rvals: make([][]interface{}, len(right.Data)),
+	}
+	isKey := func(keys []int, i int) bool {
+		for _, k := range keys {
+			if k == i {
+				return true
+			}
+		}
+		return false
+	}
+	seen := make(map[string]bool)
+	for _, k := range lkeys {
+		p.fields = append(p.fields, left.Columns[k])
+		seen[left.Columns[k].Code] = true
+	}
+	for i, c := range left.Columns {
+		if isKey(lkeys, i) {
+			continue
+		}
+		p.lcols = append(p.lcols, i)
+		p.fields = append(p.fields, c)
+		seen[c.Code] = true
+	}
+	for i, c := range right.Columns {
+		if !keepRightKeys && isKey(rkeys, i) {
+			continue
+		}
+		p.rcols = append(p.rcols, i)
+		if seen[c.Code] {
+			suffix := JoinSuffix
+			for n := 2; seen[c.Code+suffix]; n++ {
+				suffix = JoinSuffix + strconv.Itoa(n)
+			}
+			c.Code += suffix
+			if c.Name != "" {
+				c.Name += suffix
+			}
+		}
+		seen[c.Code] = true
+		p.fields = append(p.fields, c)
+	}
+	p.out = NewDataframe(p.fields...)
+	p.row = make([]interface{}, len(p.fields))
+	return p
+}
+
+func (p *joinPlan) values(t *Dataframe, cache [][]interface{}, i int) ([]interface{}, error) {
+	if cache[i] == nil {
+		v, err := t.RowValues(i)
+		if err != nil {
+			return nil, err
+		}
+		cache[i] = v
+	}
+	return cache[i], nil
+}
+
+// emit appends a joined row. Negative positions produce null values.
+func (p *joinPlan) emit(l, r int) error {
+	var lv, rv []interface{}
+	var err error
+	if l >= 0 {
+		if lv, err = p.values(p.left, p.lvals, l); err != nil {
+			return err
+		}
+	}
+	if r >= 0 {
+		if rv, err = p.values(p.right, p.rvals, r); err != nil {
+			return err
+		}
+	}
+	n := 0
+	for k := range p.lkeys {
+		switch {
+		case lv != nil:
+			p.row[n] = lv[p.lkeys[k]]
+		case rv != nil:
+			p.row[n] = rv[p.rkeys[k]]
+		default:
+			p.row[n] = nil
+		}
+		n++
+	}
+	for _, c := range p.lcols {
+		p.row[n] = nil
+		if lv != nil {
+			p.row[n] = lv[c]
+		}
+		n++
+	}
+	for _, c := range p.rcols {
+		p.row[n] = nil
+		if rv != nil {
+			p.row[n] = rv[c]
+		}
+		n++
+	}
+	return p.out.Append(p.row...)
+}
+
+// Join joins two dataframes on one or more key columns. Key columns must
+// exist on both sides with compatible types and appear once in the result,
+// followed by all other left and right columns. Right columns whose code
+// conflicts with a left column are renamed with JoinSuffix. Null keys never
+// match.
+//
+// When both inputs are sorted by the key columns a merge join is used,
+// otherwise the right side is hashed. Results of a hash join follow the left
+// row order, unmatched right rows of an outer join are appended at the end.
+func Join(left, right *Dataframe, on []string, how JoinMode) (*Dataframe, error) {
+	if len(on) == 0 {
+		return nil, fmt.Errorf("blockwatch: join requires at least one key column")
+	}
+	if how < JoinInner || how > JoinOuter {
+		return nil, fmt.Errorf("blockwatch: invalid join mode %d", how)
+	}
+	if err := left.initType(nil); err != nil {
+		return nil, err
+	}
+	if err := right.initType(nil); err != nil {
+		return nil, err
+	}
+	lkeys := make([]int, len(on))
+	rkeys := make([]int, len(on))
+	types := make([]FieldType, len(on))
+	canMerge := true
+	for i, name := range on {
+		lkeys[i] = left.columnIndex(name)
+		if lkeys[i] < 0 {
+			return nil, fmt.Errorf("blockwatch: join: missing left column '%s'", name)
+		}
+		rkeys[i] = right.columnIndex(name)
+		if rkeys[i] < 0 {
+			return nil, fmt.Errorf("blockwatch: join: missing right column '%s'", name)
+		}
+		lt, rt := left.Columns[lkeys[i]].Type, right.Columns[rkeys[i]].Type
+		if !joinCompatible(lt, rt) {
+			return nil, fmt.Errorf("blockwatch: join: incompatible types %s and %s for column '%s'", lt, rt, name)
+		}
+		types[i] = lt
+		canMerge = canMerge && lt == rt
+	}
+	lk, err := decodeKeys(left, lkeys)
+	if err != nil {
+		return nil, err
+	}
+	rk, err := decodeKeys(right, rkeys)
+	if err != nil {
+		return nil, err
+	}
+	p := newJoinPlan(left, right, lkeys, rkeys, false)
+	if canMerge && keysSorted(types, lk) && keysSorted(types, rk) {
+		err = mergeJoin(p, types, lk, rk, how)
+	} else {
+		err = hashJoin(p, lk, rk, how)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return p.out, nil
+}
+
+func joinCompatible(a, b FieldType) bool {
+	if a == b {
+		return true
+	}
+	isInt := func(t FieldType) bool { return t == FieldTypeInt64 || t == FieldTypeUint64 }
+	isTime := func(t FieldType) bool { return t == FieldTypeDate || t == FieldTypeDatetime }
+	return isInt(a) && isInt(b) || isTime(a) && isTime(b)
+}
+
+// decodeKeys returns the key values of all rows, or nil for rows with a null
+// key column.
+func decodeKeys(t *Dataframe, cols []int) ([][]interface{}, error) {
+	keys := make([][]interface{}, len(t.Data))
+	for i := range t.Data {
+		k := make([]interface{}, len(cols))
+		for j, c := range cols {
+			if t.IsNullAt(c, i) {
+				k = nil
+				break
+			}
+			v, err := t.FieldAt(c, i)
+			if err != nil {
+				return nil, err
+			}
+			k[j] = v
+		}
+		keys[i] = k
+	}
+	return keys, nil
+}
+
+// keyString returns a hashable representation of a key that is equal for
+// equal values across compatible column types. Like the merge join it treats
+// negative and positive zero as equal.
+func keyString(k []interface{}) string {
+	var b strings.Builder
+	for i, v := range k {
+		if i > 0 {
+			b.WriteByte(0)
+		}
+		switch x := v.(type) {
+		case string:
+			b.WriteString(x)
+		case []byte:
+			b.Write(x)
+		case time.Time:
+			b.WriteString(strconv.FormatInt(x.UnixNano(), 10))
+		case int64:
+			b.WriteString(strconv.FormatInt(x, 10))
+		case uint64:
+			b.WriteString(strconv.FormatUint(x, 10))
+		case float64:
+			if x == 0 {
+				x = 0 // normalize -0
+			}
+			b.WriteString(strconv.FormatFloat(x, 'g', -1, 64))
+		default:
+			fmt.Fprint(&b, x)
+		}
+	}
+	return b.String()
+}
+
+func compareKeys(types []FieldType, a, b []interface{}) int {
+	for i := range a {
+		if c := compareValues(types[i], a[i], b[i]); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// keysSorted returns true when keys are non-null and sorted ascending.
+func keysSorted(types []FieldType, keys [][]interface{}) bool {
+	for _, typ := range types {
+		if typ == FieldTypeBoolean || typ == FieldTypeBytes {
+			return false
+		}
+	}
+	for i := range keys {
+		if keys[i] == nil {
+			return false
+		}
+		if i > 0 && compareKeys(types, keys[i-1], keys[i]) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func hashJoin(p *joinPlan, lk, rk [][]interface{}, how JoinMode) error {
+	index := make(map[string][]int, len(rk))
+	for i, k := range rk {
+		if k == nil {
+			continue
+		}
+		s := keyString(k)
+		index[s] = append(index[s], i)
+	}
+	matched := make([]bool, len(rk))
+	for l, k := range lk {
+		var rows []int
+		if k != nil {
+			rows = index[keyString(k)]
+		}
+		if len(rows) == 0 {
+			if how != JoinInner {
+				if err := p.emit(l, -1); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		for _, r := range rows {
+			matched[r] = true
+			if err := p.emit(l, r); err != nil {
+				return err
+			}
+		}
+	}
+	if how == JoinOuter {
+		for r, ok := range matched {
+			if !ok {
+				if err := p.emit(-1, r); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func mergeJoin(p *joinPlan, types []FieldType, lk, rk [][]interface{}, how JoinMode) error {
+	i, j := 0, 0
+	for i < len(lk) || j < len(rk) {
+		var c int
+		switch {
+		case i == len(lk):
+			c = 1
+		case j == len(rk):
+			c = -1
+		default:
+			c = compareKeys(types, lk[i], rk[j])
+		}
+		switch {
+		case c < 0:
+			if how != JoinInner {
+				if err := p.emit(i, -1); err != nil {
+					return err
+				}
+			}
+			i++
+		case c > 0:
+			if how == JoinOuter {
+				if err := p.emit(-1, j); err != nil {
+					return err
+				}
+			}
+			j++
+		default:
+			i2, j2 := i+1, j+1
+			for i2 < len(lk) && compareKeys(types, lk[i], lk[i2]) == 0 {
+				i2++
+			}
+			for j2 < len(rk) && compareKeys(types, rk[j], rk[j2]) == 0 {
+				j2++
+			}
+			for l := i; l < i2; l++ {
+				for r := j; r < j2; r++ {
+					if err := p.emit(l, r); err != nil {
+						return err
+					}
+				}
+			}
+			i, j = i2, j2
+		}
+	}
+	return nil
+}
+
+// AsOfJoin joins each left row with the last right row whose time column on
+// is at or before the left row's time. With a positive tolerance the right
+// row must not be older than tolerance. Left rows without match get null
+// values. All left columns are kept in left row order, followed by all right
+// columns including the right time column. Right columns whose code
+// conflicts with a left column are renamed with JoinSuffix.
+func AsOfJoin(left, right *Dataframe, on string, tolerance time.Duration) (*Dataframe, error) {
+	if err := left.initType(nil); err != nil {
+		return nil, err
+	}
+	if err := right.initType(nil); err != nil {
+		return nil, err
+	}
+	lcol, rcol := left.columnIndex(on), right.columnIndex(on)
+	if lcol < 0 {
+		return nil, fmt.Errorf("blockwatch: as-of join: missing left column '%s'", on)
+	}
+	if rcol < 0 {
+		return nil, fmt.Errorf("blockwatch: as-of join: missing right column '%s'", on)
+	}
+	for _, typ := range []FieldType{left.Columns[lcol].Type, right.Columns[rcol].Type} {
+		if typ != FieldTypeDate && typ != FieldTypeDatetime {
+			return nil, fmt.Errorf("blockwatch: as-of join: column '%s' must be a time column, got %s", on, typ)
+		}
+	}
+	ltimes, err := left.decodeTimeColumn(lcol, on)
+	if err != nil {
+		return nil, err
+	}
+	rtimes, err := right.decodeTimeColumn(rcol, on)
+	if err != nil {
+		return nil, err
+	}
+
+	// sort right rows by time, null times are ignored
+	ridx := make([]int, 0, len(rtimes))
+	for i := range rtimes {
+		if !right.IsNullAt(rcol, i) {
+			ridx = append(ridx, i)
+		}
+	}
+	sorted := sort.SliceIsSorted(ridx, func(i, j int) bool { return rtimes[ridx[i]].Before(rtimes[ridx[j]]) })
+	if !sorted {
+		sort.SliceStable(ridx, func(i, j int) bool { return rtimes[ridx[i]].Before(rtimes[ridx[j]]) })
+	}
+
+	p := newJoinPlan(left, right, nil, nil, true)
+	for l, t := range ltimes {
+		r := -1
+		if !left.IsNullAt(lcol, l) {
+			// last right row at or before t
+			k := sort.Search(len(ridx), func(k int) bool { return rtimes[ridx[k]].After(t) }) - 1
+			if k >= 0 && (tolerance <= 0 || t.Sub(rtimes[ridx[k]]) <= tolerance) {
+				r = ridx[k]
+			}
+		}
+		if err := p.emit(l, r); err != nil {
+			return nil, err
+		}
+	}
+	return p.out, nil
+}
@@ -0,0 +1,262 @@
+// Copyright (c) 2020 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package blockwatch
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func joinTestFrames(t *testing.T, sorted bool) (*Dataframe, *Dataframe) {
+	left := NewDataframe(
+		Datafield{Code: "id", Type: FieldTypeInt64},
+		Datafield{Name: "Price", Code: "price", Type: FieldTypeFloat64},
+		Datafield{Code: "price_right", Type: FieldTypeFloat64},
+	)
+	right := NewDataframe(
+		Datafield{Code: "id", Type: FieldTypeUint64},
+		Datafield{Name: "Price", Code: "price", Type: FieldTypeFloat64},
+		Datafield{Code: "qty", Type: FieldTypeInt64},
+	)
+	lrows := [][]interface{}{
+		{int64(3), 1.0, 0.1},
+		{int64(1), 2.0, 0.2},
+		{nil, 3.0, 0.3},
+		{int64(2), 4.0, 0.4},
+	}
+	rrows := [][]interface{}{
+		{uint64(2), 20.0, int64(200)},
+		{uint64(4), 40.0, int64(400)},
+		{uint64(2), 21.0, int64(210)},
+		{nil, 50.0, int64(500)},
+	}
+	if sorted {
+		// merge joins require non-null keys
+		lrows = [][]interface{}{lrows[1], lrows[3], lrows[0]}
+		rrows = rrows[:3]
+		rrows[1], rrows[2] = rrows[2], rrows[1]
+		right.Columns[0].Type = FieldTypeInt64
+		for _, r := range rrows {
+			r[0] = int64(r[0].(uint64))
+		}
+	}
+	for _, r := range lrows {
+		if err := left.Append(r...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, r := range rrows {
+		if err := right.Append(r...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return left, right
+}
+
+func TestJoinHash(t *testing.T) {
+	left, right := joinTestFrames(t, false)
+	res, err := Join(left, right, []string{"id"}, JoinOuter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// right codes get a counter when the suffixed code is taken
+	want := []Datafield{
+		{Code: "id", Type: FieldTypeInt64},
+		{Name: "Price", Code: "price", Type: FieldTypeFloat64},
+		{Code: "price_right", Type: FieldTypeFloat64},
+		{Name: "Price_right2", Code: "price_right2", Type: FieldTypeFloat64},
+		{Code: "qty", Type: FieldTypeInt64},
+	}
+	for i, f := range want {
+		if res.Columns[i] != f {
+			t.Errorf("column %d: got %+v, want %+v", i, res.Columns[i], f)
+		}
+	}
+	matched := [][]interface{}{
+		{int64(2), 4.0, 0.4, 20.0, int64(200)},
+		{int64(2), 4.0, 0.4, 21.0, int64(210)},
+	}
+	unmatched := [][]interface{}{
+		{int64(3), 1.0, 0.1, nil, nil},
+		{int64(1), 2.0, 0.2, nil, nil},
+		{nil, 3.0, 0.3, nil, nil},
+	}
+	// hash joins keep the left order and append unmatched right rows
+	checkRows(t, res, append(append(unmatched, matched...),
+		[]interface{}{int64(4), nil, nil, 40.0, int64(400)},
+		[]interface{}{nil, nil, nil, 50.0, int64(500)},
+	))
+
+	res, err = Join(left, right, []string{"id"}, JoinLeft)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkRows(t, res, append(unmatched, matched...))
+
+	res, err = Join(left, right, []string{"id"}, JoinInner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkRows(t, res, matched)
+}
+
+func TestJoinMerge(t *testing.T) {
+	left, right := joinTestFrames(t, true)
+	var tests = []struct {
+		how  JoinMode
+		want [][]interface{}
+	}{
+		{JoinInner, [][]interface{}{
+			{int64(2), 4.0, 0.4, 20.0, int64(200)},
+			{int64(2), 4.0, 0.4, 21.0, int64(210)},
+		}},
+		{JoinLeft, [][]interface{}{
+			{int64(1), 2.0, 0.2, nil, nil},
+			{int64(2), 4.0, 0.4, 20.0, int64(200)},
+			{int64(2), 4.0, 0.4, 21.0, int64(210)},
+			{int64(3), 1.0, 0.1, nil, nil},
+		}},
+		{JoinOuter, [][]interface{}{
+			{int64(1), 2.0, 0.2, nil, nil},
+			{int64(2), 4.0, 0.4, 20.0, int64(200)},
+			{int64(2), 4.0, 0.4, 21.0, int64(210)},
+			{int64(3), 1.0, 0.1, nil, nil},
+			{int64(4), nil, nil, 40.0, int64(400)},
+		}},
+	}
+	for _, test := range tests {
+		res, err := Join(left, right, []string{"id"}, test.how)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkRows(t, res, test.want)
+	}
+}
+
+func TestJoinFloatZero(t *testing.T) {
+	frame := func(vals ...interface{}) *Dataframe {
+		df := NewDataframe(
+			Datafield{Code: "k", Type: FieldTypeFloat64},
+			Datafield{Code: "v", Type: FieldTypeString},
+		)
+		for i := 0; i < len(vals); i += 2 {
+			if err := df.Append(vals[i], vals[i+1]); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return df
+	}
+	negZero := math.Copysign(0, -1)
+	// sorted inputs use the merge join, unsorted inputs the hash join
+	for _, sorted := range []bool{true, false} {
+		left := frame(negZero, "a", 1.0, "b")
+		right := frame(0.0, "x", 1.0, "y")
+		if !sorted {
+			left = frame(1.0, "b", negZero, "a")
+			right = frame(1.0, "y", 0.0, "x")
+		}
+		res, err := Join(left, right, []string{"k"}, JoinInner)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(res.Data) != 2 {
+			t.Errorf("sorted=%t: got %d rows, want 2", sorted, len(res.Data))
+		}
+	}
+}
+
+func TestJoinErrors(t *testing.T) {
+	left, right := joinTestFrames(t, false)
+	other := NewDataframe(Datafield{Code: "id", Type: FieldTypeString})
+	var tests = []struct {
+		right *Dataframe
+		on    []string
+		how   JoinMode
+		want  string
+	}{
+		{right, nil, JoinInner, "at least one key column"},
+		{right, []string{"id"}, JoinMode(9), "invalid join mode"},
+		{right, []string{"price_right"}, JoinInner, "missing right column"},
+		{right, []string{"qty"}, JoinInner, "missing left column"},
+		{other, []string{"id"}, JoinInner, "incompatible types"},
+	}
+	for _, test := range tests {
+		_, err := Join(left, test.right, test.on, test.how)
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%v: got error %v, want %q", test.on, err, test.want)
+		}
+	}
+}
+
+func TestAsOfJoin(t *testing.T) {
+	m := time.Minute
+	at := func(d time.Duration) time.Time { return resampleTime.Add(d) }
+	left := NewDataframe(
+		Datafield{Code: "time", Type: FieldTypeDatetime},
+		Datafield{Code: "v", Type: FieldTypeInt64},
+	)
+	right := NewDataframe(
+		Datafield{Code: "time", Type: FieldTypeDatetime},
+		Datafield{Code: "v", Type: FieldTypeString},
+	)
+	for _, r := range [][]interface{}{
+		{at(0), int64(1)},
+		{at(m), int64(2)},
+		{nil, int64(3)},
+		{at(4 * m), int64(4)},
+		{at(-2 * m), int64(5)},
+	} {
+		if err := left.Append(r...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// unsorted right side
+	for _, r := range [][]interface{}{
+		{at(3 * m), "c"},
+		{at(-m), "a"},
+		{nil, "x"},
+	} {
+		if err := right.Append(r...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	res, err := AsOfJoin(left, right, "time", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	codes := []string{"time", "v", "time_right", "v_right"}
+	for i, c := range res.Columns {
+		if c.Code != codes[i] {
+			t.Errorf("column %d: got %s, want %s", i, c.Code, codes[i])
+		}
+	}
+	checkRows(t, res, [][]interface{}{
+		{at(0), int64(1), at(-m), "a"},
+		{at(m), int64(2), at(-m), "a"},
+		{nil, int64(3), nil, nil},
+		{at(4 * m), int64(4), at(3 * m), "c"},
+		{at(-2 * m), int64(5), nil, nil},
+	})
+
+	res, err = AsOfJoin(left, right, "time", 90*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkRows(t, res, [][]interface{}{
+		{at(0), int64(1), at(-m), "a"},
+		{at(m), int64(2), nil, nil},
+		{nil, int64(3), nil, nil},
+		{at(4 * m), int64(4), at(3 * m), "c"},
+		{at(-2 * m), int64(5), nil, nil},
+	})
+
+	if _, err := AsOfJoin(left, right, "v", 0); err == nil {
+		t.Error("expected error for non-time column")
+	}
+	if _, err := AsOfJoin(left, right, "x", 0); err == nil {
+		t.Error("expected error for missing column")
+	}
+}
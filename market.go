@@ -25,7 +25,7 @@ type Ohlcv struct {
 	High            float64   `json:"high"`
 	Low             float64   `json:"low"`
 	Vwap            float64   `json:"vwap"`
-	Std             float64   `json:"stddev"`
+	Std             float64   `json:"stddev"` // sample std, NaN in bars built locally from one trade
 	Mean            float64   `json:"mean"`
 	TradeCount      int64     `json:"n_trades"`
 	BuyCount        int64     `json:"n_buy"`
@@ -36,4 +36,8 @@ type Ohlcv struct {
 	QuoteVolumeBuy  float64   `json:"vol_buy_quote"`
 	BaseVolumeSell  float64   `json:"vol_sell_base"`
 	QuoteVolumeSell float64   `json:"vol_sell_quote"`
+
+	// time of the first and last trade in bars built locally from trades
+	StartTime time.Time `json:"start_time"`
+	EndTime   time.Time `json:"end_time"`
 }
@@ -0,0 +1,217 @@
+// Copyright (c) 2020 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package blockwatch
+
+import (
+	"encoding/json"
+	"math/rand"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/quick"
+	"time"
+)
+
+var quickConfig = &quick.Config{MaxCount: 500}
+
+func randColumns(r *rand.Rand) []string {
+	var cols []string
+	for _, c := range []string{"time", "open", "close"} {
+		if r.Intn(2) == 0 {
+			cols = append(cols, c)
+		}
+	}
+	return cols
+}
+
+func randFilters(r *rand.Rand) []*Filter {
+	var list []*Filter
+	for i, n := 0, r.Intn(4); i < n; i++ {
+		field := []string{"z", "a", "height", "addr_type"}[r.Intn(4)]
+		mode := FilterMode(r.Intn(int(FilterModeInvalid)))
+		var val string
+		switch mode {
+		case FilterModeRange:
+			val = "1,x y"
+		case FilterModeIn, FilterModeNotIn:
+			val = []string{"1", "1,2,3", "x y,z"}[r.Intn(3)]
+		default:
+			val = []string{"1", "-5", "x y", "1,2", "^0+", "a\"b", "ü"}[r.Intn(7)]
+		}
+		list = append(list, NewFilter(field, mode, val))
+	}
+	return list
+}
+
+func randTime(r *rand.Rand) time.Time {
+	if r.Intn(3) == 0 {
+		return time.Time{}
+	}
+	var nsec int64
+	switch r.Intn(3) {
+	case 1:
+		nsec = int64(r.Intn(1000)) * int64(time.Millisecond)
+	case 2:
+		nsec = r.Int63n(int64(time.Second))
+	}
+	return time.Unix(r.Int63n(4e9), nsec).UTC()
+}
+
+func randTableParams(r *rand.Rand) TableParams {
+	p := TableParams{
+		Columns: randColumns(r),
+		Filter:  randFilters(r),
+		Limit:   r.Intn(1000),
+	}
+	if r.Intn(2) == 0 {
+		p.Cursor = "c" + string(rune('a'+r.Intn(26)))
+	}
+	return p
+}
+
+func randSeriesParams(r *rand.Rand) SeriesParams {
+	p := SeriesParams{
+		Columns:   randColumns(r),
+		Collapse:  []CollapseMode{CollapseInvalid, CollapseOneMinute, CollapseOneHour, CollapseDaily, CollapseMonthly}[r.Intn(5)],
+		Order:     []OrderMode{OrderInvalid, OrderAsc, OrderDesc}[r.Intn(3)],
+		StartDate: randTime(r),
+		EndDate:   randTime(r),
+		Filter:    randFilters(r),
+		Limit:     r.Intn(1000),
+	}
+	switch r.Intn(3) {
+	case 1:
+		p.Cursor = "abc"
+	case 2:
+		p.Cursor = makeSeriesCursor(time.Unix(r.Int63n(4e9), 0), OrderAsc)
+	}
+	return p
+}
+
+func TestTableParamsRoundTrip(t *testing.T) {
+	prop := func(seed int64) bool {
+		p := randTableParams(rand.New(rand.NewSource(seed)))
+
+		// query string keeps all params and the filter order
+		text, err := p.MarshalText()
+		if err != nil {
+			t.Log(err)
+			return false
+		}
+		var p2 TableParams
+		if err := p2.UnmarshalText(text); err != nil {
+			t.Log(string(text), err)
+			return false
+		}
+		if !reflect.DeepEqual(p, p2) {
+			t.Logf("text %s: %#v != %#v", text, p, p2)
+			return false
+		}
+
+		// JSON object including format
+		p.Format = FormatCSV
+		buf, err := json.Marshal(p)
+		if err != nil {
+			t.Log(err)
+			return false
+		}
+		var p3 TableParams
+		if err := json.Unmarshal(buf, &p3); err != nil {
+			t.Log(string(buf), err)
+			return false
+		}
+		if !reflect.DeepEqual(p, p3) {
+			t.Logf("json %s: %#v != %#v", buf, p, p3)
+			return false
+		}
+		return true
+	}
+	if err := quick.Check(prop, quickConfig); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSeriesParamsRoundTrip(t *testing.T) {
+	prop := func(seed int64) bool {
+		p := randSeriesParams(rand.New(rand.NewSource(seed)))
+
+		text, err := p.MarshalText()
+		if err != nil {
+			t.Log(err)
+			return false
+		}
+		var p2 SeriesParams
+		if err := p2.UnmarshalText(text); err != nil {
+			t.Log(string(text), err)
+			return false
+		}
+		if !reflect.DeepEqual(p, p2) {
+			t.Logf("text %s: %#v != %#v", text, p, p2)
+			return false
+		}
+
+		p.Format = FormatCSV
+		buf, err := json.Marshal(p)
+		if err != nil {
+			t.Log(err)
+			return false
+		}
+		if p.StartDate.IsZero() && strings.Contains(string(buf), "start_date") {
+			t.Logf("json %s: zero start_date not omitted", buf)
+			return false
+		}
+		var p3 SeriesParams
+		if err := json.Unmarshal(buf, &p3); err != nil {
+			t.Log(string(buf), err)
+			return false
+		}
+		if !reflect.DeepEqual(p, p3) {
+			t.Logf("json %s: %#v != %#v", buf, p, p3)
+			return false
+		}
+		return true
+	}
+	if err := quick.Check(prop, quickConfig); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestParseParamsValues(t *testing.T) {
+	// url.Values is a map, filters on the same column keep their order
+	p := TableParams{Filter: []*Filter{
+		NewFilter("z", FilterModeGt, "1"),
+		NewFilter("a", FilterModeEqual, "2"),
+		NewFilter("a", FilterModeEqual, "1"),
+	}}
+	p2, err := ParseTableParams(p.Query())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*Filter{p.Filter[1], p.Filter[2], p.Filter[0]}
+	if !reflect.DeepEqual(p2.Filter, want) {
+		t.Errorf("filters %v, want %v", p2.Filter, want)
+	}
+
+	s := SeriesParams{
+		StartDate: time.Date(2020, 1, 2, 3, 4, 5, 6000000, time.UTC),
+		Cursor:    makeSeriesCursor(time.Unix(1577934245, 0), OrderAsc),
+	}
+	s2, err := ParseSeriesParams(s.Query())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(s, s2) {
+		t.Errorf("%#v != %#v", s, s2)
+	}
+
+	// synthetic cursors are only expanded in request URLs
+	u, err := url.Parse(s.Url("BTC", "OHLCV"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q := u.Query(); q.Get("cursor") != "" || q.Get("start_date") == "" {
+		t.Errorf("url %s: cursor not expanded", u)
+	}
+}
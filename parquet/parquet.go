@@ -0,0 +1,248 @@
+// Copyright (c) 2020 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+// Package parquet writes dataframes and paged query results as Apache Parquet
+// files.
+//
+// Columns are named by their code and keep their type. The table below shows
+// how each field type maps to a Parquet type.
+//
+//	string    BYTE_ARRAY (UTF8)
+//	bytes     BYTE_ARRAY
+//	date      INT32 (DATE)
+//	datetime  INT64 (TIMESTAMP millis, UTC)
+//	boolean   BOOLEAN
+//	float64   DOUBLE
+//	int64     INT64 (INT 64 signed)
+//	uint64    INT64 (INT 64 unsigned)
+//
+// Rows are converted with the arrow package. Null values are written as
+// Parquet nulls. Column names are stored in the embedded Arrow schema so that
+// readers which understand it can restore them.
+package parquet
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	pq "github.com/apache/arrow-go/v18/parquet"
+	"github.com/apache/arrow-go/v18/parquet/compress"
+	"github.com/apache/arrow-go/v18/parquet/pqarrow"
+
+	"blockwatch.cc/blockwatch-go"
+	bwarrow "blockwatch.cc/blockwatch-go/arrow"
+)
+
+// DefaultRowGroupSize is the number of rows per row group used when
+// Options.RowGroupSize is not set.
+const DefaultRowGroupSize = 64 * 1024
+
+// ErrNoData is returned when a writer is closed before any dataframe was
+// written, e.g. for an iterator without pages. The schema is unknown in this
+// case, so no file is written.
+var ErrNoData = errors.New("parquet: no data to write")
+
+// Compression selects the codec used for column chunks.
+type Compression int
+
+const (
+	CompressionSnappy Compression = iota
+	CompressionNone
+	CompressionGzip
+	CompressionZstd
+)
+
+func (c Compression) String() string {
+	switch c {
+	case CompressionSnappy:
+		return "snappy"
+	case CompressionNone:
+		return "none"
+	case CompressionGzip:
+		return "gzip"
+	case CompressionZstd:
+		return "zstd"
+	default:
+		return "invalid"
+	}
+}
+
+// ParseCompression returns the compression with name s.
+func ParseCompression(s string) (Compression, error) {
+	switch s {
+	case "snappy", "":
+		return CompressionSnappy, nil
+	case "none", "uncompressed":
+		return CompressionNone, nil
+	case "gzip":
+		return CompressionGzip, nil
+	case "zstd":
+		return CompressionZstd, nil
+	default:
+		return CompressionSnappy, fmt.Errorf("parquet: invalid compression '%s'", s)
+	}
+}
+
+func (c Compression) codec() (compress.Compression, error) {
+	switch c {
+	case CompressionSnappy:
+		return compress.Codecs.Snappy, nil
+	case CompressionNone:
+		return compress.Codecs.Uncompressed, nil
+	case CompressionGzip:
+		return compress.Codecs.Gzip, nil
+	case CompressionZstd:
+		return compress.Codecs.Zstd, nil
+	default:
+		return compress.Codecs.Uncompressed, fmt.Errorf("parquet: invalid compression %d", c)
+	}
+}
+
+// Options configures Parquet output. The zero value writes snappy compressed
+// row groups of DefaultRowGroupSize rows.
+type Options struct {
+	RowGroupSize int         // max rows per row group
+	Compression  Compression // column chunk codec
+}
+
+// Writer writes dataframes into a single Parquet file. The schema is taken
+// from the first dataframe, all further dataframes must have the same
+// columns, e.g. pages of the same query. Rows are buffered until a row group
+// is full, so small pages are combined into row groups of RowGroupSize rows.
+// Close must be called to write the file footer.
+type Writer struct {
+	w    io.Writer
+	opts Options
+	fw   *pqarrow.FileWriter
+	sc   *arrow.Schema
+	cols []blockwatch.Datafield
+	rows int
+	mem  memory.Allocator
+}
+
+// NewWriter creates a Parquet writer on w. The writer does not close w.
+func NewWriter(w io.Writer, opts Options) *Writer {
+	if opts.RowGroupSize <= 0 {
+		opts.RowGroupSize = DefaultRowGroupSize
+	}
+	return &Writer{
+		w:    w,
+		opts: opts,
+		mem:  memory.DefaultAllocator,
+	}
+}
+
+// Rows returns the number of data rows written so far.
+func (w *Writer) Rows() int {
+	return w.rows
+}
+
+// Write appends all rows of a dataframe and creates the file on first use. A
+// dataframe without rows only sets the schema, so that Close writes a valid
+// empty file.
+func (w *Writer) Write(t *blockwatch.Dataframe) error {
+	if w.fw == nil {
+		if err := w.open(t.Columns); err != nil {
+			return err
+		}
+	} else if err := w.checkColumns(t.Columns); err != nil {
+		return err
+	}
+	if len(t.Data) == 0 {
+		return nil
+	}
+	rec, err := bwarrow.NewRecord(w.mem, w.sc, t)
+	if err != nil {
+		return err
+	}
+	defer rec.Release()
+	if err := w.fw.WriteBuffered(rec); err != nil {
+		return fmt.Errorf("parquet: %v", err)
+	}
+	w.rows += len(t.Data)
+	return nil
+}
+
+// Close flushes the last row group and writes the file footer. It returns
+// ErrNoData when nothing was written.
+func (w *Writer) Close() error {
+	if w.fw == nil {
+		return ErrNoData
+	}
+	if err := w.fw.Close(); err != nil {
+		return fmt.Errorf("parquet: %v", err)
+	}
+	return nil
+}
+
+func (w *Writer) open(cols []blockwatch.Datafield) error {
+	schema, err := bwarrow.Schema(cols)
+	if err != nil {
+		return err
+	}
+	codec, err := w.opts.Compression.codec()
+	if err != nil {
+		return err
+	}
+	props := pq.NewWriterProperties(
+		pq.WithAllocator(w.mem),
+		pq.WithMaxRowGroupLength(int64(w.opts.RowGroupSize)),
+		pq.WithCompression(codec),
+	)
+	arrprops := pqarrow.NewArrowWriterProperties(
+		pqarrow.WithAllocator(w.mem),
+		pqarrow.WithStoreSchema(),
+	)
+	// hide Close from the file writer, the caller owns w
+	fw, err := pqarrow.NewFileWriter(schema, struct{ io.Writer }{w.w}, props, arrprops)
+	if err != nil {
+		return fmt.Errorf("parquet: %v", err)
+	}
+	w.fw = fw
+	w.sc = schema
+	w.cols = append([]blockwatch.Datafield(nil), cols...)
+	return nil
+}
+
+func (w *Writer) checkColumns(cols []blockwatch.Datafield) error {
+	if len(cols) != len(w.cols) {
+		return fmt.Errorf("parquet: column count mismatch %d != %d", len(cols), len(w.cols))
+	}
+	for i, c := range cols {
+		if c.Code != w.cols[i].Code || c.Type != w.cols[i].Type {
+			return fmt.Errorf("parquet: column %d mismatch %s(%s) != %s(%s)",
+				i, c.Code, c.Type, w.cols[i].Code, w.cols[i].Type)
+		}
+	}
+	return nil
+}
+
+// Write writes the dataframe as Parquet file to w.
+func Write(w io.Writer, t *blockwatch.Dataframe, opts Options) error {
+	pw := NewWriter(w, opts)
+	if err := pw.Write(t); err != nil {
+		return err
+	}
+	return pw.Close()
+}
+
+// WriteStream writes all pages of an iterator as one Parquet file to w and
+// returns the number of rows written. Only the current page and the current
+// row group are held in memory. Pages with a different column layout than
+// the first page are rejected. When the iterator has no pages, nothing is
+// written and ErrNoData is returned.
+func WriteStream(w io.Writer, it blockwatch.FrameIterator, opts Options) (int, error) {
+	pw := NewWriter(w, opts)
+	for it.Next() {
+		if err := pw.Write(it.Dataframe()); err != nil {
+			return pw.Rows(), err
+		}
+	}
+	if err := it.Err(); err != nil {
+		return pw.Rows(), err
+	}
+	return pw.Rows(), pw.Close()
+}
@@ -0,0 +1,293 @@
+// Copyright (c) 2020 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package parquet
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	pq "github.com/apache/arrow-go/v18/parquet"
+	"github.com/apache/arrow-go/v18/parquet/compress"
+	"github.com/apache/arrow-go/v18/parquet/file"
+	"github.com/apache/arrow-go/v18/parquet/pqarrow"
+	"github.com/apache/arrow-go/v18/parquet/schema"
+
+	"blockwatch.cc/blockwatch-go"
+)
+
+// pages is a frame iterator over a fixed list of dataframes.
+type pages struct {
+	list []*blockwatch.Dataframe
+	n    int
+}
+
+func (p *pages) Next() bool {
+	if p.n >= len(p.list) {
+		return false
+	}
+	p.n++
+	return true
+}
+
+func (p *pages) Dataframe() *blockwatch.Dataframe {
+	return p.list[p.n-1]
+}
+
+func (p *pages) Err() error {
+	return nil
+}
+
+var testColumns = []blockwatch.Datafield{
+	{Name: "Time", Code: "time", Type: blockwatch.FieldTypeDatetime},
+	{Name: "Day", Code: "day", Type: blockwatch.FieldTypeDate},
+	{Name: "Hash", Code: "hash", Type: blockwatch.FieldTypeBytes},
+	{Name: "Note", Code: "note", Type: blockwatch.FieldTypeString},
+	{Name: "Value", Code: "value", Type: blockwatch.FieldTypeFloat64},
+	{Name: "Count", Code: "count", Type: blockwatch.FieldTypeUint64},
+	{Name: "Delta", Code: "delta", Type: blockwatch.FieldTypeInt64},
+	{Name: "Flag", Code: "flag", Type: blockwatch.FieldTypeBoolean},
+}
+
+var testTime = time.Date(2020, 1, 2, 3, 4, 5, 6000000, time.UTC)
+
+// testPage returns a page of n rows starting at row offset. Every third row
+// is null in all columns except time.
+func testPage(t *testing.T, offset, n int) *blockwatch.Dataframe {
+	df := blockwatch.NewDataframe(testColumns...)
+	for i := offset; i < offset+n; i++ {
+		ts := testTime.Add(time.Duration(i) * time.Hour)
+		var err error
+		if i%3 == 2 {
+			err = df.Append(ts, nil, nil, nil, nil, nil, nil, nil)
+		} else {
+			err = df.Append(
+				ts,
+				ts.Truncate(24*time.Hour),
+				[]byte{byte(i), 0xab},
+				"note,"+string(rune('a'+i%26)),
+				float64(i)+0.5,
+				1<<63+uint64(i),
+				int64(-i),
+				i%2 == 0,
+			)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return df
+}
+
+func TestWriteStream(t *testing.T) {
+	codecs := map[Compression]compress.Compression{
+		CompressionSnappy: compress.Codecs.Snappy,
+		CompressionNone:   compress.Codecs.Uncompressed,
+		CompressionGzip:   compress.Codecs.Gzip,
+		CompressionZstd:   compress.Codecs.Zstd,
+	}
+	for c, codec := range codecs {
+		t.Run(c.String(), func(t *testing.T) {
+			var buf bytes.Buffer
+			it := &pages{list: []*blockwatch.Dataframe{
+				testPage(t, 0, 7),
+				testPage(t, 7, 0),
+				testPage(t, 7, 7),
+				testPage(t, 14, 3),
+			}}
+			n, err := WriteStream(&buf, it, Options{RowGroupSize: 5, Compression: c})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != 17 {
+				t.Fatalf("wrote %d rows, want 17", n)
+			}
+			checkFile(t, buf.Bytes(), 17, 5, codec)
+		})
+	}
+}
+
+func checkFile(t *testing.T, data []byte, rows, groupSize int, codec compress.Compression) {
+	t.Helper()
+	r, err := file.NewParquetReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	// row groups
+	if r.NumRows() != int64(rows) {
+		t.Errorf("file has %d rows, want %d", r.NumRows(), rows)
+	}
+	if want := (rows + groupSize - 1) / groupSize; r.NumRowGroups() != want {
+		t.Errorf("file has %d row groups, want %d", r.NumRowGroups(), want)
+	}
+	for i := 0; i < r.NumRowGroups(); i++ {
+		rg := r.MetaData().RowGroup(i)
+		want := groupSize
+		if i == r.NumRowGroups()-1 {
+			want = rows - i*groupSize
+		}
+		if rg.NumRows() != int64(want) {
+			t.Errorf("row group %d has %d rows, want %d", i, rg.NumRows(), want)
+		}
+		for j := 0; j < rg.NumColumns(); j++ {
+			cc, err := rg.ColumnChunk(j)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cc.Compression() != codec {
+				t.Errorf("row group %d column %d: compression %s, want %s", i, j, cc.Compression(), codec)
+			}
+		}
+	}
+
+	// physical and logical types
+	types := []struct {
+		phys pq.Type
+		lt   schema.LogicalType
+	}{
+		{pq.Types.Int64, schema.NewTimestampLogicalType(true, schema.TimeUnitMillis)},
+		{pq.Types.Int32, schema.DateLogicalType{}},
+		{pq.Types.ByteArray, schema.NoLogicalType{}},
+		{pq.Types.ByteArray, schema.StringLogicalType{}},
+		{pq.Types.Double, schema.NoLogicalType{}},
+		{pq.Types.Int64, schema.NewIntLogicalType(64, false)},
+		{pq.Types.Int64, schema.NewIntLogicalType(64, true)},
+		{pq.Types.Boolean, schema.NoLogicalType{}},
+	}
+	sc := r.MetaData().Schema
+	if sc.NumColumns() != len(types) {
+		t.Fatalf("file has %d columns, want %d", sc.NumColumns(), len(types))
+	}
+	for i, typ := range types {
+		c := sc.Column(i)
+		if c.Name() != testColumns[i].Code {
+			t.Errorf("column %d: name %s, want %s", i, c.Name(), testColumns[i].Code)
+		}
+		if c.PhysicalType() != typ.phys || !c.LogicalType().Equals(typ.lt) {
+			t.Errorf("column %d: type %s %s, want %s %s", i, c.PhysicalType(), c.LogicalType(), typ.phys, typ.lt)
+		}
+	}
+
+	// values and nulls
+	tbl, err := pqarrow.ReadTable(context.Background(), bytes.NewReader(data), nil, pqarrow.ArrowReadProperties{}, memory.DefaultAllocator)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tbl.Release()
+	for i, c := range testColumns {
+		if v, _ := tbl.Schema().Field(i).Metadata.GetValue("name"); v != c.Name {
+			t.Errorf("column %d: name metadata %q, want %q", i, v, c.Name)
+		}
+	}
+	want := testPage(t, 0, rows)
+	for col := range testColumns {
+		var row int
+		for _, chunk := range tbl.Column(col).Data().Chunks() {
+			for k := 0; k < chunk.Len(); k, row = k+1, row+1 {
+				checkValue(t, chunk, k, want, col, row)
+			}
+		}
+		if row != rows {
+			t.Errorf("column %d has %d rows, want %d", col, row, rows)
+		}
+	}
+}
+
+func checkValue(t *testing.T, arr arrow.Array, k int, want *blockwatch.Dataframe, col, row int) {
+	t.Helper()
+	if want.IsNullAt(col, row) {
+		if !arr.IsNull(k) {
+			t.Errorf("row %d column %d: got %s, want null", row, col, arr.ValueStr(k))
+		}
+		return
+	}
+	if arr.IsNull(k) {
+		t.Errorf("row %d column %d: got null", row, col)
+		return
+	}
+	v, err := want.FieldAt(col, row)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ok bool
+	switch a := arr.(type) {
+	case *array.Timestamp:
+		ok = a.Value(k).ToTime(arrow.Millisecond).Equal(v.(time.Time))
+	case *array.Date32:
+		ok = a.Value(k).ToTime().Equal(v.(time.Time))
+	case *array.Binary:
+		ok = bytes.Equal(a.Value(k), v.([]byte))
+	case *array.String:
+		ok = a.Value(k) == v.(string)
+	case *array.Float64:
+		ok = a.Value(k) == v.(float64)
+	case *array.Uint64:
+		ok = a.Value(k) == v.(uint64)
+	case *array.Int64:
+		ok = a.Value(k) == v.(int64)
+	case *array.Boolean:
+		ok = a.Value(k) == v.(bool)
+	default:
+		t.Fatalf("column %d: unexpected array type %T", col, arr)
+	}
+	if !ok {
+		t.Errorf("row %d column %d: got %s, want %v", row, col, arr.ValueStr(k), v)
+	}
+}
+
+func TestWriteEmpty(t *testing.T) {
+	// an iterator without pages has no schema
+	var buf bytes.Buffer
+	if n, err := WriteStream(&buf, &pages{}, Options{}); err != ErrNoData || n != 0 {
+		t.Errorf("got %d, %v, want ErrNoData", n, err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("wrote %d bytes without data", buf.Len())
+	}
+
+	// a dataframe without rows writes a valid empty file
+	if err := Write(&buf, testPage(t, 0, 0), Options{}); err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, buf.Bytes(), 0, DefaultRowGroupSize, compress.Codecs.Snappy)
+}
+
+func TestWriteErrors(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf, Options{})
+	if err := w.Write(testPage(t, 0, 2)); err != nil {
+		t.Fatal(err)
+	}
+	sel, err := testPage(t, 0, 2).Select("time")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Write(sel); err == nil {
+		t.Error("expected column mismatch error")
+	}
+	if err := Write(&buf, blockwatch.NewDataframe(blockwatch.Datafield{Code: "x"}), Options{}); err == nil {
+		t.Error("expected unsupported type error")
+	}
+	if err := Write(&buf, testPage(t, 0, 1), Options{Compression: Compression(-1)}); err == nil {
+		t.Error("expected invalid compression error")
+	}
+	for _, s := range []string{"", "snappy", "none", "gzip", "zstd"} {
+		c, err := ParseCompression(s)
+		if err != nil {
+			t.Error(err)
+		}
+		if s != "" && c.String() != s {
+			t.Errorf("parse %s: got %s", s, c)
+		}
+	}
+	if _, err := ParseCompression("lzo"); err == nil {
+		t.Error("expected invalid compression error")
+	}
+}
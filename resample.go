@@ -0,0 +1,295 @@
+// Copyright (c) 2020 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package blockwatch
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Window assigns timestamps to time buckets. Truncate returns the start of
+// the bucket containing t in time zone loc, Next returns the start of the
+// following bucket. CollapseMode and Interval implement Window.
+type Window interface {
+	Truncate(t time.Time, loc *time.Location) time.Time
+	Next(t time.Time) time.Time
+}
+
+// Interval is a fixed size window such as 2h or 10s. Intervals that evenly
+// divide a day are aligned to midnight in the requested time zone, all other
+// intervals are aligned to 1970-01-01 00:00 wall clock time in that zone
+// using the zone offset in effect at t, i.e. to the UNIX epoch only in UTC.
+type Interval time.Duration
+
+func (d Interval) String() string {
+	return time.Duration(d).String()
+}
+
+func (d Interval) Truncate(t time.Time, loc *time.Location) time.Time {
+	if loc == nil {
+		loc = time.UTC
+	}
+	t = t.In(loc)
+	dur := time.Duration(d)
+	if dur <= 0 {
+		return t
+	}
+	if dur <= 24*time.Hour && (24*time.Hour)%dur == 0 {
+		y, m, dd := t.Date()
+		day := time.Date(y, m, dd, 0, 0, 0, 0, loc)
+		return day.Add(t.Sub(day) / dur * dur)
+	}
+	_, offset := t.Zone()
+	ns := t.UnixNano() + int64(offset)*int64(time.Second)
+	r := ns % int64(dur)
+	if r < 0 {
+		r += int64(dur)
+	}
+	return t.Add(-time.Duration(r))
+}
+
+func (d Interval) Next(t time.Time) time.Time {
+	if d <= 0 {
+		return t
+	}
+	return d.Truncate(t, t.Location()).Add(time.Duration(d))
+}
+
+type offsetWindow struct {
+	w      Window
+	offset time.Duration
+}
+
+// OffsetWindow shifts all bucket boundaries of w by offset. Use it to bucket
+// by trading days that start at a fixed local time, e.g.
+// OffsetWindow(CollapseDaily, 17*time.Hour).
+func OffsetWindow(w Window, offset time.Duration) Window {
+	return offsetWindow{w: w, offset: offset}
+}
+
+func (o offsetWindow) Truncate(t time.Time, loc *time.Location) time.Time {
+	return o.w.Truncate(t.Add(-o.offset), loc).Add(o.offset)
+}
+
+func (o offsetWindow) Next(t time.Time) time.Time {
+	return o.w.Next(o.w.Truncate(t.Add(-o.offset), t.Location())).Add(o.offset)
+}
+
+// ResampleRules maps output column codes to aggregation rules.
+type ResampleRules map[string]AggRule
+
+// OhlcvResampleRules are the default rules for market OHLCV columns. They
+// match the aggregations the API uses when collapsing OHLCV series.
+var OhlcvResampleRules = ResampleRules{
+	"open":           {Func: AggFirst},
+	"close":          {Func: AggLast},
+	"high":           {Func: AggMax},
+	"low":            {Func: AggMin},
+	"vwap":           {Func: AggVwap, Weight: "vol_base"},
+	"stddev":         {Func: AggStd, Weight: "n_trades", Mean: "mean"},
+	"mean":           {Func: AggWeightedMean, Weight: "n_trades"},
+	"n_trades":       {Func: AggSum},
+	"n_buy":          {Func: AggSum},
+	"n_sell":         {Func: AggSum},
+	"vol_base":       {Func: AggSum},
+	"vol_quote":      {Func: AggSum},
+	"vol_buy_base":   {Func: AggSum},
+	"vol_buy_quote":  {Func: AggSum},
+	"vol_sell_base":  {Func: AggSum},
+	"vol_sell_quote": {Func: AggSum},
+}
+
+// Resample downsamples a series into buckets defined by w in UTC. See
+// ResampleIn for details.
+func (s *Series) Resample(w Window, rules ResampleRules) (*Series, error) {
+	return s.ResampleIn(w, time.UTC, rules)
+}
+
+// ResampleIn downsamples a series into buckets defined by w in time zone loc.
+// Each output row's time is the bucket start, all other columns are
+// aggregated according to rules. When rules is nil, OhlcvResampleRules are
+// used for known columns and all other columns keep their last value. When
+// rules is not nil, only the time column and columns listed in rules are
+// returned. Empty buckets are skipped. The output keeps the series order.
+func (s *Series) ResampleIn(w Window, loc *time.Location, rules ResampleRules) (*Series, error) {
+	tcol := s.TimeColumn()
+	if tcol < 0 {
+		return nil, fmt.Errorf("blockwatch: missing time column")
+	}
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	// select output columns and rules
+	type outCol struct {
+		name   string
+		rule   AggRule
+		isTime bool
+	}
+	outs := make([]outCol, 0, len(s.Columns))
+	seen := make(map[string]bool)
+	for i, c := range s.Columns {
+		if i == tcol {
+			outs = append(outs, outCol{name: c.Code, isTime: true})
+			continue
+		}
+		rule, ok := rules[c.Code]
+		if rules == nil {
+			if rule, ok = OhlcvResampleRules[c.Code]; !ok {
+				rule, ok = AggRule{Func: AggLast}, true
+			}
+		}
+		if !ok {
+			continue
+		}
+		seen[c.Code] = true
+		outs = append(outs, outCol{name: c.Code, rule: rule})
+	}
+	extra := make([]string, 0)
+	for name := range rules {
+		if !seen[name] && name != s.Columns[tcol].Code {
+			extra = append(extra, name)
+		}
+	}
+	sort.Strings(extra)
+	for _, name := range extra {
+		outs = append(outs, outCol{name: name, rule: rules[name]})
+	}
+
+	// decode source columns
+	cache := make(map[string][]interface{})
+	load := func(name string) ([]interface{}, error) {
+		if name == "" {
+			return nil, nil
+		}
+		if v, ok := cache[name]; ok {
+			return v, nil
+		}
+		v, err := s.ColumnValues(name)
+		if err != nil {
+			return nil, err
+		}
+		cache[name] = v
+		return v, nil
+	}
+	type aggCol struct {
+		typ                  FieldType
+		vals, weights, means []interface{}
+	}
+	aggs := make([]aggCol, len(outs))
+	fields := make([]Datafield, len(outs))
+	for i, o := range outs {
+		if o.isTime {
+			fields[i] = s.Columns[tcol]
+			continue
+		}
+		src := o.rule.source(o.name)
+		col := s.columnIndex(src)
+		if col < 0 {
+			return nil, fmt.Errorf("blockwatch: resample column '%s': missing source column '%s'", o.name, src)
+		}
+		typ := s.Columns[col].Type
+		if err := o.rule.check(typ); err != nil {
+			return nil, fmt.Errorf("blockwatch: resample column '%s': %v", o.name, err)
+		}
+		var err error
+		a := aggCol{typ: typ}
+		if a.vals, err = load(src); err != nil {
+			return nil, err
+		}
+		switch o.rule.Func {
+		case AggWeightedMean, AggVwap, AggStd:
+			// missing weight columns fall back to unweighted aggregation
+			if wc := o.rule.weight(); s.columnIndex(wc) >= 0 {
+				if a.weights, err = load(wc); err != nil {
+					return nil, err
+				}
+			}
+			if mc := o.rule.Mean; s.columnIndex(mc) >= 0 {
+				if a.means, err = load(mc); err != nil {
+					return nil, err
+				}
+			}
+		}
+		aggs[i] = a
+		fields[i] = Datafield{
+			Name: s.fieldName(src, o.name),
+			Code: o.name,
+			Type: o.rule.resultType(typ),
+		}
+	}
+
+	// sort rows by time
+	times, err := s.decodeTimeColumn(tcol, s.Columns[tcol].Code)
+	if err != nil {
+		return nil, err
+	}
+	idx := make([]int, len(times))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(i, j int) bool { return times[idx[i]].Before(times[idx[j]]) })
+
+	// aggregate buckets
+	out := NewDataframe(fields...)
+	row := make([]interface{}, len(fields))
+	for i := 0; i < len(idx); {
+		if s.IsNullAt(tcol, idx[i]) {
+			i++
+			continue
+		}
+		start := w.Truncate(times[idx[i]], loc)
+		end := w.Next(start)
+		j := i + 1
+		for j < len(idx) && times[idx[j]].Before(end) {
+			j++
+		}
+		for k, o := range outs {
+			if o.isTime {
+				row[k] = start
+				continue
+			}
+			a := aggs[k]
+			row[k] = aggregate(o.rule.Func, a.typ, a.vals, idx[i:j], a.weights, a.means)
+		}
+		if err := out.Append(row...); err != nil {
+			return nil, err
+		}
+		i = j
+	}
+
+	res := &Series{
+		Dataframe: *out,
+		Order:     OrderAsc,
+		Count:     len(out.Data),
+	}
+	if m, ok := w.(CollapseMode); ok {
+		res.Collapse = m
+	}
+	if s.Order == OrderDesc {
+		res.Order = OrderDesc
+		for i, j := 0, len(res.Data)-1; i < j; i, j = i+1, j-1 {
+			res.Data[i], res.Data[j] = res.Data[j], res.Data[i]
+		}
+	}
+	if n, col := len(res.Data), res.TimeColumn(); n > 0 {
+		first, _ := res.decodeTimeAt(col, 0, res.Columns[col].Code)
+		last, _ := res.decodeTimeAt(col, n-1, res.Columns[col].Code)
+		if first.After(last) {
+			first, last = last, first
+		}
+		res.StartDate, res.EndDate = first, last
+	}
+	return res, nil
+}
+
+// fieldName returns the display name of column code or def when the column
+// does not exist or has no name.
+func (t *Dataframe) fieldName(code, def string) string {
+	if i := t.columnIndex(code); i >= 0 && t.Columns[i].Name != "" && code == def {
+		return t.Columns[i].Name
+	}
+	return def
+}
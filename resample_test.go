@@ -0,0 +1,284 @@
+// Copyright (c) 2020 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package blockwatch
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var resampleTime = time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)
+
+// newTestSeries returns an ascending series with the given columns. The
+// first value of each row is the time offset from resampleTime.
+func newTestSeries(t *testing.T, cols []Datafield, rows [][]interface{}) *Series {
+	t.Helper()
+	df := NewDataframe(cols...)
+	for _, r := range rows {
+		vals := append([]interface{}{resampleTime.Add(r[0].(time.Duration))}, r[1:]...)
+		if err := df.Append(vals...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return &Series{Dataframe: *df, Order: OrderAsc}
+}
+
+func ohlcvTestSeries(t *testing.T) *Series {
+	cols := []Datafield{
+		{Code: "time", Type: FieldTypeDatetime},
+		{Name: "Open", Code: "open", Type: FieldTypeFloat64},
+		{Code: "high", Type: FieldTypeFloat64},
+		{Code: "low", Type: FieldTypeFloat64},
+		{Code: "close", Type: FieldTypeFloat64},
+		{Code: "vol_base", Type: FieldTypeFloat64},
+		{Code: "n_trades", Type: FieldTypeUint64},
+		{Code: "vwap", Type: FieldTypeFloat64},
+		{Code: "mean", Type: FieldTypeFloat64},
+		{Code: "stddev", Type: FieldTypeFloat64},
+		{Code: "foo", Type: FieldTypeInt64},
+	}
+	m := time.Minute
+	return newTestSeries(t, cols, [][]interface{}{
+		{0 * m, 10.0, 12.0, 9.0, 11.0, 1.0, uint64(2), 10.5, 10.5, 1.0, int64(1)},
+		{1 * m, 11.0, 13.0, 10.0, 12.0, 3.0, uint64(1), 12.0, 12.0, nil, int64(2)},
+		{3 * m, 12.0, 12.0, 8.0, 9.0, nil, uint64(3), 9.5, 9.5, 0.5, int64(3)},
+		{5 * m, 9.0, 10.0, 7.0, 8.0, 2.0, uint64(1), 8.0, 8.0, nil, int64(4)},
+		{9 * m, 8.0, 15.0, 8.0, 14.0, 2.0, uint64(2), 14.0, 13.0, 2.0, nil},
+	})
+}
+
+func checkRows(t *testing.T, df *Dataframe, want [][]interface{}) {
+	t.Helper()
+	if len(df.Data) != len(want) {
+		t.Fatalf("got %d rows, want %d", len(df.Data), len(want))
+	}
+	for i, w := range want {
+		got, err := df.RowValues(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != len(w) {
+			t.Fatalf("row %d: got %d values, want %d", i, len(got), len(w))
+		}
+		for j := range w {
+			if !equalValue(got[j], w[j]) {
+				t.Errorf("row %d col %s: got %v, want %v", i, df.Columns[j].Code, got[j], w[j])
+			}
+		}
+	}
+}
+
+func equalValue(a, b interface{}) bool {
+	if x, ok := a.(float64); ok {
+		y, ok := b.(float64)
+		return ok && (math.Abs(x-y) < 1e-9 || math.IsNaN(x) && math.IsNaN(y))
+	}
+	if x, ok := a.(time.Time); ok {
+		y, ok := b.(time.Time)
+		return ok && x.Equal(y)
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func TestResampleOhlcv(t *testing.T) {
+	s := ohlcvTestSeries(t)
+	res, err := s.Resample(CollapseFiveMinutes, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	codes := make([]string, len(res.Columns))
+	for i, c := range res.Columns {
+		codes[i] = c.Code
+	}
+	wantCodes := []string{"time", "open", "high", "low", "close", "vol_base", "n_trades", "vwap", "mean", "stddev", "foo"}
+	if !reflect.DeepEqual(codes, wantCodes) {
+		t.Fatalf("got columns %v, want %v", codes, wantCodes)
+	}
+	if res.Columns[1].Name != "Open" || res.Columns[6].Type != FieldTypeUint64 {
+		t.Errorf("column metadata not kept: %v", res.Columns)
+	}
+	checkRows(t, &res.Dataframe, [][]interface{}{
+		{
+			resampleTime, 10.0, 13.0, 8.0, 9.0, 4.0, uint64(6),
+			(10.5*1 + 12*3) / 4.0,         // vwap weighted by vol_base, null weight skipped
+			(10.5*2 + 12*1 + 9.5*3) / 6.0, // mean weighted by n_trades
+			math.Sqrt(1.275),              // stddev pooled over 2+1+3 trades
+			int64(3),
+		},
+		{
+			resampleTime.Add(5 * time.Minute), 9.0, 15.0, 7.0, 14.0, 4.0, uint64(3),
+			(8.0*2 + 14*2) / 4.0,
+			(8.0*1 + 13*2) / 3.0,
+			math.Sqrt(31.0 / 3.0),
+			int64(4), // last non-null value
+		},
+	})
+	if res.Collapse != CollapseFiveMinutes || res.Order != OrderAsc || res.Count != 2 {
+		t.Errorf("got collapse %s order %s count %d", res.Collapse, res.Order, res.Count)
+	}
+	if !res.StartDate.Equal(resampleTime) || !res.EndDate.Equal(resampleTime.Add(5*time.Minute)) {
+		t.Errorf("got range %s..%s", res.StartDate, res.EndDate)
+	}
+
+	// OHLCV rules are consistent with resampling in one or two steps
+	twice, err := res.Resample(CollapseFifteenMinutes, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	once, err := s.Resample(CollapseFifteenMinutes, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkRows(t, &twice.Dataframe, [][]interface{}{mustRowValues(t, &once.Dataframe, 0)})
+
+	// descending input keeps its order
+	desc := *s
+	desc.Order = OrderDesc
+	desc.Data = nil
+	for i := len(s.Data) - 1; i >= 0; i-- {
+		desc.Data = append(desc.Data, s.Data[i])
+	}
+	dres, err := desc.Resample(CollapseFiveMinutes, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dres.Order != OrderDesc || len(dres.Data) != 2 ||
+		!reflect.DeepEqual(dres.Data[0], res.Data[1]) || !reflect.DeepEqual(dres.Data[1], res.Data[0]) {
+		t.Errorf("descending: got %s", dres.Data)
+	}
+}
+
+func mustRowValues(t *testing.T, df *Dataframe, row int) []interface{} {
+	t.Helper()
+	v, err := df.RowValues(row)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestResampleRules(t *testing.T) {
+	s := ohlcvTestSeries(t)
+	res, err := s.Resample(Interval(10*time.Minute), ResampleRules{
+		"close": {Func: AggMedian},
+		"cnt":   {Func: AggCount, Source: "vol_base"},
+		"std":   {Func: AggStd, Source: "close"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Collapse != CollapseInvalid {
+		t.Errorf("interval window set collapse %s", res.Collapse)
+	}
+	if n := len(res.Columns); n != 4 || res.Columns[2].Code != "cnt" || res.Columns[2].Type != FieldTypeInt64 {
+		t.Fatalf("got columns %v", res.Columns)
+	}
+	// sample std of 11, 12, 9, 8, 14
+	checkRows(t, &res.Dataframe, [][]interface{}{
+		{resampleTime, 11.0, int64(4), math.Sqrt(5.7)},
+	})
+
+	for _, rules := range []ResampleRules{
+		{"x": {Func: AggSum}},
+		{"open": {Func: "nope"}},
+		{"foo": {Func: AggVwap, Source: "time"}},
+	} {
+		if _, err := s.Resample(CollapseOneHour, rules); err == nil {
+			t.Errorf("%v: expected error", rules)
+		}
+	}
+	noTime := &Series{Dataframe: *NewDataframe(Datafield{Code: "x", Type: FieldTypeFloat64})}
+	if _, err := noTime.Resample(CollapseOneHour, nil); err == nil {
+		t.Error("expected missing time column error")
+	}
+}
+
+func TestResampleIn(t *testing.T) {
+	cols := []Datafield{
+		{Code: "time", Type: FieldTypeDatetime},
+		{Code: "vol_base", Type: FieldTypeFloat64},
+	}
+	h := time.Hour
+	s := newTestSeries(t, cols, [][]interface{}{
+		{17 * h, 1.0},
+		{18*h + 30*time.Minute, 2.0}, // local midnight in +05:30
+		{19 * h, 4.0},
+		{41 * h, 8.0},
+		{43 * h, 16.0},
+	})
+	ist := time.FixedZone("IST", 5*3600+1800)
+	local := func(d, hh, mm int) time.Time {
+		return time.Date(2020, 1, d, hh, mm, 0, 0, ist)
+	}
+	var tests = []struct {
+		w    Window
+		loc  *time.Location
+		want [][]interface{}
+	}{
+		{CollapseDaily, nil, [][]interface{}{
+			{resampleTime, 7.0},
+			{resampleTime.Add(24 * h), 24.0},
+		}},
+		{CollapseDaily, ist, [][]interface{}{
+			{local(2, 0, 0), 1.0},
+			{local(3, 0, 0), 14.0},
+			{local(4, 0, 0), 16.0},
+		}},
+		// trading days starting at 17:00 UTC
+		{OffsetWindow(CollapseDaily, 17*h), nil, [][]interface{}{
+			{resampleTime.Add(17 * h), 7.0},
+			{resampleTime.Add(41 * h), 24.0},
+		}},
+		// 7h does not divide a day and aligns to the local epoch
+		{Interval(7 * h), nil, [][]interface{}{
+			{resampleTime.Add(14 * h), 7.0},
+			{resampleTime.Add(35 * h), 8.0},
+			{resampleTime.Add(42 * h), 16.0},
+		}},
+		{Interval(7 * h), ist, [][]interface{}{
+			{local(2, 21, 0), 7.0},
+			{local(3, 18, 0), 24.0},
+		}},
+	}
+	for _, test := range tests {
+		res, err := s.ResampleIn(test.w, test.loc, ResampleRules{"vol_base": {Func: AggSum}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkRows(t, &res.Dataframe, test.want)
+	}
+}
+
+func TestIntervalTruncate(t *testing.T) {
+	ist := time.FixedZone("IST", 5*3600+1800)
+	var tests = []struct {
+		d    Interval
+		in   time.Time
+		loc  *time.Location
+		want time.Time
+	}{
+		{Interval(2 * time.Hour), time.Date(2020, 1, 2, 3, 59, 0, 0, time.UTC), nil, time.Date(2020, 1, 2, 2, 0, 0, 0, time.UTC)},
+		{Interval(2 * time.Hour), time.Date(2020, 1, 2, 3, 59, 0, 0, ist), ist, time.Date(2020, 1, 2, 2, 0, 0, 0, ist)},
+		{Interval(10 * time.Second), time.Date(2020, 1, 2, 3, 4, 59, 999, time.UTC), nil, time.Date(2020, 1, 2, 3, 4, 50, 0, time.UTC)},
+		// 18263 days and 10 hours after the epoch, 438322 = 62617*7 + 3
+		{Interval(7 * time.Hour), time.Date(2020, 1, 2, 10, 0, 0, 0, ist), ist, time.Date(2020, 1, 2, 7, 0, 0, 0, ist)},
+		// the same instant is 4:30 UTC, 438316.5 = 62616*7 + 4.5
+		{Interval(7 * time.Hour), time.Date(2020, 1, 2, 10, 0, 0, 0, ist), nil, time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{Interval(7 * time.Hour), time.Date(1969, 12, 31, 20, 0, 0, 0, time.UTC), nil, time.Date(1969, 12, 31, 17, 0, 0, 0, time.UTC)},
+		{Interval(0), time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC), nil, time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)},
+	}
+	for _, test := range tests {
+		got := test.d.Truncate(test.in, test.loc)
+		if !got.Equal(test.want) {
+			t.Errorf("%s %s: got %s, want %s", test.d, test.in, got, test.want)
+		}
+		if test.d > 0 {
+			if next := test.d.Next(got); !next.Equal(got.Add(time.Duration(test.d))) {
+				t.Errorf("%s next %s: got %s", test.d, got, next)
+			}
+		}
+	}
+}
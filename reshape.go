@@ -0,0 +1,271 @@
+// Copyright (c) 2020 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package blockwatch
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Melt turns a wide dataframe into long format. Each input row produces one
+// output row per value column that holds the id columns, the value column
+// code in a string column varName and the value in a column valueName.
+// Output rows keep the input row order. Without valueCols all columns except
+// idCols are melted, varName and valueName default to "variable" and
+// "value".
+//
+// Value columns must share a type, numeric columns of different types are
+// converted to float64 when any of them is float64 and to int64 otherwise.
+// An error is returned when a uint64 value does not fit int64. Id columns
+// keep their name and type. Value column names and types are not kept, pass
+// the original columns to Pivot to restore them.
+func (t *Dataframe) Melt(idCols, valueCols []string, varName, valueName string) (*Dataframe, error) {
+	if err := t.initType(nil); err != nil {
+		return nil, err
+	}
+	if varName == "" {
+		varName = "variable"
+	}
+	if valueName == "" {
+		valueName = "value"
+	}
+	ids := make([]int, len(idCols))
+	isID := make(map[int]bool)
+	for i, name := range idCols {
+		ids[i] = t.columnIndex(name)
+		if ids[i] < 0 {
+			return nil, fmt.Errorf("blockwatch: melt: missing id column '%s'", name)
+		}
+		isID[ids[i]] = true
+	}
+	vars := make([]int, 0, len(t.Columns))
+	if len(valueCols) == 0 {
+		for i := range t.Columns {
+			if !isID[i] {
+				vars = append(vars, i)
+			}
+		}
+	}
+	for _, name := range valueCols {
+		col := t.columnIndex(name)
+		if col < 0 {
+			return nil, fmt.Errorf("blockwatch: melt: missing value column '%s'", name)
+		}
+		vars = append(vars, col)
+	}
+	if len(vars) == 0 {
+		return nil, fmt.Errorf("blockwatch: melt requires at least one value column")
+	}
+	typ, err := t.meltType(vars)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := make([]Datafield, 0, len(ids)+2)
+	for _, c := range ids {
+		fields = append(fields, t.Columns[c])
+	}
+	for _, f := range fields {
+		if f.Code == varName || f.Code == valueName {
+			return nil, fmt.Errorf("blockwatch: melt: output column '%s' conflicts with id column", f.Code)
+		}
+	}
+	fields = append(fields,
+		Datafield{Name: varName, Code: varName, Type: FieldTypeString},
+		Datafield{Name: valueName, Code: valueName, Type: typ},
+	)
+	out := NewDataframe(fields...)
+	out.Data = make([]json.RawMessage, 0, len(t.Data)*len(vars))
+	row := make([]interface{}, len(fields))
+	for i := range t.Data {
+		vals, err := t.RowValues(i)
+		if err != nil {
+			return nil, err
+		}
+		for j, c := range ids {
+			row[j] = vals[c]
+		}
+		for _, c := range vars {
+			v := vals[c]
+			if v != nil && t.Columns[c].Type != typ {
+				if v = convertExprValue(typ, v); v == nil {
+					return nil, fmt.Errorf("blockwatch: melt: value %v of column '%s' at row %d does not fit %s", vals[c], t.Columns[c].Code, i, typ)
+				}
+			}
+			row[len(ids)] = t.Columns[c].Code
+			row[len(ids)+1] = v
+			if err := out.Append(row...); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return out, nil
+}
+
+// meltType returns the common type of all value columns.
+func (t *Dataframe) meltType(cols []int) (FieldType, error) {
+	typ := t.Columns[cols[0]].Type
+	for _, c := range cols[1:] {
+		next := t.Columns[c].Type
+		switch true {
+		case next == typ:
+		case isTimeType(next) && isTimeType(typ):
+			typ = FieldTypeDatetime
+		case isNumericType(next) && isNumericType(typ):
+			if next == FieldTypeFloat64 || typ == FieldTypeFloat64 {
+				typ = FieldTypeFloat64
+			} else {
+				typ = FieldTypeInt64
+			}
+		default:
+			return FieldTypeUndefined, fmt.Errorf("blockwatch: melt: value column '%s' has type %s, expected %s", t.Columns[c].Code, next, typ)
+		}
+	}
+	return typ, nil
+}
+
+// Pivot turns a long dataframe into wide format. Output rows are the
+// distinct values of the index columns, output columns are the index columns
+// followed by one column per distinct value of the columns column in order of
+// first appearance. Cells hold the values column aggregated with agg, or
+// null when no row matches. Rows with null in the columns column are
+// skipped.
+//
+// Output column codes and names are the formatted values of the columns
+// column. Without agg each index and column combination must be unique and
+// values keep their type, otherwise the type follows the aggregation.
+//
+// Optional fields describe output columns by code, e.g. the columns of a
+// dataframe before Melt. Matching output columns take the field name and,
+// without agg, the field type, so a melted dataframe pivots back to its
+// original columns. An error is returned when a value does not fit the field
+// type.
+func (t *Dataframe) Pivot(index []string, columns, values string, agg AggFunc, fields ...Datafield) (*Dataframe, error) {
+	if err := t.initType(nil); err != nil {
+		return nil, err
+	}
+	g := t.GroupBy(index...)
+	if g.err != nil {
+		return nil, fmt.Errorf("blockwatch: pivot: %v", g.err)
+	}
+	kc := t.columnIndex(columns)
+	if kc < 0 {
+		return nil, fmt.Errorf("blockwatch: pivot: missing column '%s'", columns)
+	}
+	vc := t.columnIndex(values)
+	if vc < 0 {
+		return nil, fmt.Errorf("blockwatch: pivot: missing column '%s'", values)
+	}
+	rule := AggRule{Func: agg}
+	typ := t.Columns[vc].Type
+	if agg != "" {
+		if err := rule.check(typ); err != nil {
+			return nil, fmt.Errorf("blockwatch: pivot: %v", err)
+		}
+		typ = rule.resultType(typ)
+	}
+	vals, err := t.columnValues(vc)
+	if err != nil {
+		return nil, err
+	}
+	var weights []interface{}
+	if wc := t.columnIndex(rule.weight()); wc >= 0 {
+		if weights, err = t.columnValues(wc); err != nil {
+			return nil, err
+		}
+	}
+	keys, err := t.columnValues(kc)
+	if err != nil {
+		return nil, err
+	}
+
+	meta := make(map[string]Datafield, len(fields))
+	for _, f := range fields {
+		meta[f.Code] = f
+	}
+
+	// assign output columns in order of first appearance
+	fields = make([]Datafield, 0, len(g.cols))
+	for _, c := range g.cols {
+		fields = append(fields, t.Columns[c])
+	}
+	slots := make(map[string]int)
+	for _, k := range keys {
+		if k == nil {
+			continue
+		}
+		code := formatSummaryValue(k)
+		if _, ok := slots[code]; ok {
+			continue
+		}
+		for _, f := range fields[:len(g.cols)] {
+			if f.Code == code {
+				return nil, fmt.Errorf("blockwatch: pivot: column '%s' conflicts with index column", code)
+			}
+		}
+		f := Datafield{Name: code, Code: code, Type: typ}
+		if m, ok := meta[code]; ok {
+			if m.Name != "" {
+				f.Name = m.Name
+			}
+			if agg == "" && m.Type != typ {
+				if !joinCompatible(m.Type, typ) && !(isNumericType(m.Type) && isNumericType(typ)) {
+					return nil, fmt.Errorf("blockwatch: pivot: column '%s' has type %s, cannot convert to %s", code, typ, m.Type)
+				}
+				f.Type = m.Type
+			}
+		}
+		slots[code] = len(fields)
+		fields = append(fields, f)
+	}
+
+	out := NewDataframe(fields...)
+	row := make([]interface{}, len(fields))
+	cells := make([][]int, len(fields))
+	for _, rows := range g.groups {
+		for j, c := range g.cols {
+			row[j] = nil
+			if !t.IsNullAt(c, rows[0]) {
+				v, err := t.FieldAt(c, rows[0])
+				if err != nil {
+					return nil, err
+				}
+				row[j] = v
+			}
+		}
+		for j := range cells {
+			cells[j] = cells[j][:0]
+		}
+		for _, i := range rows {
+			if keys[i] == nil {
+				continue
+			}
+			j := slots[formatSummaryValue(keys[i])]
+			if agg == "" && len(cells[j]) > 0 {
+				return nil, fmt.Errorf("blockwatch: pivot: duplicate entries for column '%s' at row %d, use an aggregation", fields[j].Code, i)
+			}
+			cells[j] = append(cells[j], i)
+		}
+		for j := len(g.cols); j < len(fields); j++ {
+			switch true {
+			case len(cells[j]) == 0:
+				row[j] = nil
+			case agg == "":
+				v := vals[cells[j][0]]
+				if v != nil && fields[j].Type != typ {
+					if v = convertExprValue(fields[j].Type, v); v == nil {
+						return nil, fmt.Errorf("blockwatch: pivot: value %v at row %d does not fit %s column '%s'", vals[cells[j][0]], cells[j][0], fields[j].Type, fields[j].Code)
+					}
+				}
+				row[j] = v
+			default:
+				row[j] = aggregate(agg, t.Columns[vc].Type, vals, cells[j], weights, nil)
+			}
+		}
+		if err := out.Append(row...); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
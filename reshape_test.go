@@ -0,0 +1,179 @@
+// Copyright (c) 2020 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package blockwatch
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func reshapeTestFrame(t *testing.T) *Dataframe {
+	return &newTestSeries(t, []Datafield{
+		{Name: "Time", Code: "time", Type: FieldTypeDatetime},
+		{Name: "Alpha", Code: "a", Type: FieldTypeInt64},
+		{Name: "Beta", Code: "b", Type: FieldTypeUint64},
+		{Name: "Gamma", Code: "c", Type: FieldTypeFloat64},
+	}, [][]interface{}{
+		{time.Duration(0), int64(1), uint64(2), 0.5},
+		{time.Hour, nil, uint64(3), 1.5},
+	}).Dataframe
+}
+
+func TestMeltPivot(t *testing.T) {
+	wide := reshapeTestFrame(t)
+	t0, t1 := resampleTime, resampleTime.Add(time.Hour)
+	long, err := wide.Melt([]string{"time"}, nil, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Datafield{
+		{Name: "Time", Code: "time", Type: FieldTypeDatetime},
+		{Name: "variable", Code: "variable", Type: FieldTypeString},
+		{Name: "value", Code: "value", Type: FieldTypeFloat64},
+	}
+	for i, f := range want {
+		if long.Columns[i] != f {
+			t.Errorf("column %d: got %+v, want %+v", i, long.Columns[i], f)
+		}
+	}
+	checkRows(t, long, [][]interface{}{
+		{t0, "a", 1.0},
+		{t0, "b", 2.0},
+		{t0, "c", 0.5},
+		{t1, "a", nil},
+		{t1, "b", 3.0},
+		{t1, "c", 1.5},
+	})
+
+	// the original columns restore names and types
+	back, err := long.Pivot([]string{"time"}, "variable", "value", "", wide.Columns...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, f := range wide.Columns {
+		if back.Columns[i] != f {
+			t.Errorf("column %d: got %+v, want %+v", i, back.Columns[i], f)
+		}
+	}
+	checkRows(t, back, [][]interface{}{
+		{t0, int64(1), uint64(2), 0.5},
+		{t1, nil, uint64(3), 1.5},
+	})
+
+	// without fields codes are used as names and the long type is kept
+	back, err = long.Pivot([]string{"time"}, "variable", "value", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f := back.Columns[2]; f != (Datafield{Name: "b", Code: "b", Type: FieldTypeFloat64}) {
+		t.Errorf("got field %+v", f)
+	}
+
+	// a subset of value columns with custom names
+	long, err = wide.Melt([]string{"time"}, []string{"b", "a"}, "var", "val")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if long.Columns[2].Type != FieldTypeInt64 {
+		t.Errorf("got value type %s, want int64", long.Columns[2].Type)
+	}
+	checkRows(t, long, [][]interface{}{
+		{t0, "b", int64(2)},
+		{t0, "a", int64(1)},
+		{t1, "b", int64(3)},
+		{t1, "a", nil},
+	})
+}
+
+func TestPivotAgg(t *testing.T) {
+	long := NewDataframe(
+		Datafield{Code: "day", Type: FieldTypeInt64},
+		Datafield{Code: "kind", Type: FieldTypeString},
+		Datafield{Code: "value", Type: FieldTypeInt64},
+	)
+	for _, r := range [][]interface{}{
+		{int64(1), "in", int64(5)},
+		{int64(1), "out", int64(2)},
+		{int64(1), "in", int64(3)},
+		{int64(2), nil, int64(9)},
+		{int64(2), "out", int64(4)},
+	} {
+		if err := long.Append(r...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := long.Pivot([]string{"day"}, "kind", "value", ""); err == nil || !strings.Contains(err.Error(), "duplicate entries for column 'in'") {
+		t.Errorf("got error %v", err)
+	}
+	// with an aggregation fields only provide names
+	res, err := long.Pivot([]string{"day"}, "kind", "value", AggMean,
+		Datafield{Name: "Inflow", Code: "in", Type: FieldTypeInt64})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f := res.Columns[1]; f != (Datafield{Name: "Inflow", Code: "in", Type: FieldTypeFloat64}) {
+		t.Errorf("got field %+v", f)
+	}
+	// rows with a null column value are skipped
+	checkRows(t, res, [][]interface{}{
+		{int64(1), 4.0, 2.0},
+		{int64(2), nil, 4.0},
+	})
+}
+
+func TestReshapeErrors(t *testing.T) {
+	wide := reshapeTestFrame(t)
+	big := NewDataframe(
+		Datafield{Code: "a", Type: FieldTypeInt64},
+		Datafield{Code: "b", Type: FieldTypeUint64},
+	)
+	if err := big.Append(int64(1), uint64(math.MaxUint64)); err != nil {
+		t.Fatal(err)
+	}
+	long, err := wide.Melt([]string{"time"}, nil, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tests = []struct {
+		fn   func() error
+		want string
+	}{
+		{func() error { _, err := wide.Melt([]string{"x"}, nil, "", ""); return err }, "missing id column 'x'"},
+		{func() error { _, err := wide.Melt(nil, []string{"x"}, "", ""); return err }, "missing value column 'x'"},
+		{func() error { _, err := wide.Melt([]string{"time", "a", "b", "c"}, nil, "", ""); return err }, "at least one value column"},
+		{func() error { _, err := wide.Melt([]string{"time"}, nil, "time", ""); return err }, "conflicts with id column"},
+		{func() error { _, err := wide.Melt([]string{"a"}, nil, "", ""); return err }, "column 'b' has type uint64, expected datetime"},
+		{func() error { _, err := big.Melt(nil, nil, "", ""); return err }, "does not fit int64"},
+		{func() error { _, err := long.Pivot([]string{"x"}, "variable", "value", ""); return err }, "missing column 'x'"},
+		{func() error { _, err := long.Pivot([]string{"time"}, "x", "value", ""); return err }, "missing column 'x'"},
+		{func() error { _, err := long.Pivot([]string{"time"}, "variable", "value", "foo"); return err }, "unknown aggregation"},
+		{func() error {
+			_, err := long.Pivot([]string{"time"}, "variable", "value", "", Datafield{Code: "c", Type: FieldTypeInt64})
+			return err
+		}, "value 0.5 at row 2 does not fit int64 column 'c'"},
+		{func() error {
+			_, err := long.Pivot([]string{"time"}, "variable", "value", "", Datafield{Code: "a", Type: FieldTypeString})
+			return err
+		}, "cannot convert to string"},
+	}
+	for i, test := range tests {
+		if err := test.fn(); err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%d: got error %v, want %q", i, err, test.want)
+		}
+	}
+	// pivot columns must not collide with index columns
+	conflict := NewDataframe(
+		Datafield{Code: "x", Type: FieldTypeString},
+		Datafield{Code: "k", Type: FieldTypeString},
+		Datafield{Code: "v", Type: FieldTypeInt64},
+	)
+	if err := conflict.Append("a", "x", int64(1)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conflict.Pivot([]string{"x"}, "k", "v", ""); err == nil || !strings.Contains(err.Error(), "conflicts with index column") {
+		t.Errorf("got error %v", err)
+	}
+}
@@ -0,0 +1,461 @@
+// Copyright (c) 2020 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package blockwatch
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// RollingWindow defines the rows that contribute to a rolling statistic at
+// each row. Exactly one of Rows, Duration or Buckets should be set.
+//
+// Rows is a count based window of the current and the preceding rows.
+// Duration is a time based window that contains all rows with a timestamp in
+// (t-Duration, t]. Buckets is a calendar aware window that contains the
+// current and the preceding Buckets-1 collapse buckets as defined by
+// Collapse, which defaults to the series collapse mode.
+//
+// MinPeriods is the minimum number of non-null values in a window required
+// for a result, it defaults to Rows for count based windows and to 1
+// otherwise.
+type RollingWindow struct {
+	Rows       int           `json:"rows,omitempty"`
+	Duration   time.Duration `json:"duration,omitempty"`
+	Buckets    int           `json:"buckets,omitempty"`
+	Collapse   CollapseMode  `json:"collapse,omitempty"`
+	MinPeriods int           `json:"min_periods,omitempty"`
+}
+
+func (w RollingWindow) String() string {
+	switch {
+	case w.Duration > 0:
+		return w.Duration.String()
+	case w.Buckets > 0:
+		return fmt.Sprintf("%d*%s", w.Buckets, w.Collapse)
+	default:
+		return fmt.Sprintf("%d", w.Rows)
+	}
+}
+
+func (w RollingWindow) check() error {
+	var n int
+	if w.Rows > 0 {
+		n++
+	}
+	if w.Duration > 0 {
+		n++
+	}
+	if w.Buckets > 0 {
+		n++
+		if !w.Collapse.HasStep() {
+			return fmt.Errorf("blockwatch: rolling window of %d buckets requires a collapse mode", w.Buckets)
+		}
+	}
+	if n != 1 {
+		return fmt.Errorf("blockwatch: rolling window requires one of rows, duration or buckets")
+	}
+	return nil
+}
+
+// Float64Column is a computed column. Null values are represented as NaN.
+// Use Dataframe.AddColumn to attach it to a dataframe.
+type Float64Column struct {
+	Field  Datafield
+	Values []float64
+}
+
+// AddTo adds or replaces the column in dataframe t.
+func (c *Float64Column) AddTo(t *Dataframe) error {
+	return t.AddColumn(c.Field, c.Values)
+}
+
+// Rolling computes rolling statistics over a numeric column. Rows are
+// processed in time order when the dataframe has a time column. Results are
+// returned in row order.
+type Rolling struct {
+	name   string
+	field  Datafield
+	window RollingWindow
+	vals   []float64   // values in processing order, NaN for null
+	times  []time.Time // timestamps in processing order or nil
+	idx    []int       // processing order to row position
+	start  []int       // window start for each position
+	minp   int
+	loc    *time.Location // time zone of bucket boundaries
+}
+
+// Rolling prepares rolling statistics over column name with collapse buckets
+// in UTC. See RollingIn for details.
+func (t *Dataframe) Rolling(name string, w RollingWindow) (*Rolling, error) {
+	return t.RollingIn(name, w, time.UTC)
+}
+
+// RollingIn prepares rolling statistics over column name. Time based and
+// bucket based windows require a time column. Bucket based windows align
+// collapse buckets in time zone loc, so that e.g. daily buckets start at
+// local midnight.
+func (t *Dataframe) RollingIn(name string, w RollingWindow, loc *time.Location) (*Rolling, error) {
+	if err := w.check(); err != nil {
+		return nil, err
+	}
+	if loc == nil {
+		loc = time.UTC
+	}
+	if err := t.initType(nil); err != nil {
+		return nil, err
+	}
+	col := t.columnIndex(name)
+	if col < 0 {
+		return nil, fmt.Errorf("blockwatch: missing column '%s'", name)
+	}
+	switch t.Columns[col].Type {
+	case FieldTypeFloat64, FieldTypeInt64, FieldTypeUint64:
+	default:
+		return nil, fmt.Errorf("blockwatch: rolling statistics are unsupported on %s column '%s'", t.Columns[col].Type, name)
+	}
+	raw, err := t.columnValues(col)
+	if err != nil {
+		return nil, err
+	}
+
+	// process rows in time order
+	r := &Rolling{
+		name:   name,
+		field:  t.Columns[col],
+		window: w,
+		idx:    make([]int, len(raw)),
+		vals:   make([]float64, len(raw)),
+		start:  make([]int, len(raw)),
+		minp:   w.MinPeriods,
+		loc:    loc,
+	}
+	for i := range r.idx {
+		r.idx[i] = i
+	}
+	if tcol := t.timeColumn(); tcol >= 0 {
+		times, err := t.decodeTimeColumn(tcol, t.Columns[tcol].Code)
+		if err != nil {
+			return nil, err
+		}
+		sort.SliceStable(r.idx, func(i, j int) bool { return times[r.idx[i]].Before(times[r.idx[j]]) })
+		r.times = make([]time.Time, len(times))
+		for k, i := range r.idx {
+			r.times[k] = times[i]
+		}
+	} else if w.Duration > 0 || w.Buckets > 0 {
+		return nil, fmt.Errorf("blockwatch: rolling window %s requires a time column", w)
+	}
+	for k, i := range r.idx {
+		if f, ok := toFloat64(raw[i]); ok {
+			r.vals[k] = f
+		} else {
+			r.vals[k] = math.NaN()
+		}
+	}
+	if r.minp <= 0 {
+		r.minp = 1
+		if w.Rows > 0 {
+			r.minp = w.Rows
+		}
+	}
+
+	// compute window start positions
+	switch {
+	case w.Rows > 0:
+		for k := range r.start {
+			if s := k - w.Rows + 1; s > 0 {
+				r.start[k] = s
+			}
+		}
+	case w.Duration > 0:
+		var s int
+		for k, t := range r.times {
+			lb := t.Add(-w.Duration)
+			for s < k && !r.times[s].After(lb) {
+				s++
+			}
+			r.start[k] = s
+		}
+	default:
+		var (
+			s      int
+			bucket time.Time
+			lb     time.Time
+		)
+		for k, t := range r.times {
+			if b := w.Collapse.Truncate(t, loc); !b.Equal(bucket) || k == 0 {
+				bucket, lb = b, b
+				for n := 1; n < w.Buckets; n++ {
+					lb = w.Collapse.Prev(lb)
+				}
+			}
+			for s < k && r.times[s].Before(lb) {
+				s++
+			}
+			r.start[k] = s
+		}
+	}
+	return r, nil
+}
+
+// Rolling prepares rolling statistics over column name with collapse buckets
+// in UTC. See RollingIn for details.
+func (s *Series) Rolling(name string, w RollingWindow) (*Rolling, error) {
+	return s.RollingIn(name, w, time.UTC)
+}
+
+// RollingIn prepares rolling statistics over column name with collapse
+// buckets in time zone loc. Bucket based windows without collapse mode use
+// the series collapse mode.
+func (s *Series) RollingIn(name string, w RollingWindow, loc *time.Location) (*Rolling, error) {
+	if w.Buckets > 0 && w.Collapse == CollapseInvalid {
+		w.Collapse = s.Collapse
+	}
+	return s.Dataframe.RollingIn(name, w, loc)
+}
+
+// result maps values from processing order back to row order.
+func (r *Rolling) result(fn string, vals []float64) *Float64Column {
+	out := make([]float64, len(vals))
+	for k, i := range r.idx {
+		out[i] = vals[k]
+	}
+	name := r.field.Name
+	if name == "" {
+		name = r.name
+	}
+	return &Float64Column{
+		Field: Datafield{
+			Name: fmt.Sprintf("%s %s(%s)", name, fn, r.window),
+			Code: r.name + "_" + fn,
+			Type: FieldTypeFloat64,
+		},
+		Values: out,
+	}
+}
+
+// Count returns the number of non-null values in each window. Like all other
+// statistics windows with less than MinPeriods values are null.
+func (r *Rolling) Count() *Float64Column {
+	res := make([]float64, len(r.vals))
+	var n int
+	for k := range r.vals {
+		if !math.IsNaN(r.vals[k]) {
+			n++
+		}
+		if k > 0 {
+			for s := r.start[k-1]; s < r.start[k]; s++ {
+				if !math.IsNaN(r.vals[s]) {
+					n--
+				}
+			}
+		}
+		if n < r.minp {
+			res[k] = math.NaN()
+			continue
+		}
+		res[k] = float64(n)
+	}
+	return r.result("count", res)
+}
+
+// moments computes rolling sum, mean and sample variance in a single pass.
+// Values are shifted by the first non-null value to limit cancellation.
+func (r *Rolling) moments(fn func(n int, sum, sum2, shift float64) float64) []float64 {
+	res := make([]float64, len(r.vals))
+	shift := math.NaN()
+	for _, v := range r.vals {
+		if !math.IsNaN(v) {
+			shift = v
+			break
+		}
+	}
+	var (
+		n         int
+		sum, sum2 float64
+	)
+	for k, v := range r.vals {
+		if !math.IsNaN(v) {
+			d := v - shift
+			sum += d
+			sum2 += d * d
+			n++
+		}
+		if k > 0 {
+			for s := r.start[k-1]; s < r.start[k]; s++ {
+				if v := r.vals[s]; !math.IsNaN(v) {
+					d := v - shift
+					sum -= d
+					sum2 -= d * d
+					n--
+				}
+			}
+		}
+		if n < r.minp || n == 0 {
+			res[k] = math.NaN()
+			continue
+		}
+		res[k] = fn(n, sum, sum2, shift)
+	}
+	return res
+}
+
+// Sum returns the sum of each window.
+func (r *Rolling) Sum() *Float64Column {
+	return r.result("sum", r.moments(func(n int, sum, _, shift float64) float64 {
+		return sum + float64(n)*shift
+	}))
+}
+
+// Mean returns the arithmetic mean of each window.
+func (r *Rolling) Mean() *Float64Column {
+	return r.result("mean", r.moments(func(n int, sum, _, shift float64) float64 {
+		return sum/float64(n) + shift
+	}))
+}
+
+// Std returns the sample standard deviation of each window. Windows with
+// less than two values are null.
+func (r *Rolling) Std() *Float64Column {
+	return r.result("std", r.moments(func(n int, sum, sum2, _ float64) float64 {
+		if n < 2 {
+			return math.NaN()
+		}
+		mean := sum / float64(n)
+		return math.Sqrt(math.Max(0, (sum2-float64(n)*mean*mean)/float64(n-1)))
+	}))
+}
+
+// Min returns the minimum of each window.
+func (r *Rolling) Min() *Float64Column {
+	return r.result("min", r.extreme(func(a, b float64) bool { return a <= b }))
+}
+
+// Max returns the maximum of each window.
+func (r *Rolling) Max() *Float64Column {
+	return r.result("max", r.extreme(func(a, b float64) bool { return a >= b }))
+}
+
+// extreme computes rolling minima or maxima with a monotonic queue.
+func (r *Rolling) extreme(dominates func(a, b float64) bool) []float64 {
+	res := make([]float64, len(r.vals))
+	queue := make([]int, 0)
+	var n int
+	for k, v := range r.vals {
+		if !math.IsNaN(v) {
+			for len(queue) > 0 && dominates(v, r.vals[queue[len(queue)-1]]) {
+				queue = queue[:len(queue)-1]
+			}
+			queue = append(queue, k)
+			n++
+		}
+		if k > 0 {
+			for s := r.start[k-1]; s < r.start[k]; s++ {
+				if !math.IsNaN(r.vals[s]) {
+					n--
+				}
+			}
+		}
+		for len(queue) > 0 && queue[0] < r.start[k] {
+			queue = queue[1:]
+		}
+		if n < r.minp || len(queue) == 0 {
+			res[k] = math.NaN()
+			continue
+		}
+		res[k] = r.vals[queue[0]]
+	}
+	return res
+}
+
+// Median returns the median of each window.
+func (r *Rolling) Median() *Float64Column {
+	return r.result("median", r.quantile(0.5))
+}
+
+// Quantile returns the q-th quantile (0 <= q <= 1) of each window using
+// linear interpolation between closest ranks.
+func (r *Rolling) Quantile(q float64) *Float64Column {
+	return r.result(fmt.Sprintf("q%g", q*100), r.quantile(q))
+}
+
+func (r *Rolling) quantile(q float64) []float64 {
+	res := make([]float64, len(r.vals))
+	buf := make([]float64, 0)
+	for k := range r.vals {
+		buf = buf[:0]
+		for _, v := range r.vals[r.start[k] : k+1] {
+			if !math.IsNaN(v) {
+				buf = append(buf, v)
+			}
+		}
+		if len(buf) < r.minp || len(buf) == 0 {
+			res[k] = math.NaN()
+			continue
+		}
+		sort.Float64s(buf)
+		res[k] = quantileSorted(buf, q)
+	}
+	return res
+}
+
+// quantileSorted returns the q-th quantile of sorted values using linear
+// interpolation between closest ranks.
+func quantileSorted(vals []float64, q float64) float64 {
+	if len(vals) == 0 || math.IsNaN(q) {
+		return math.NaN()
+	}
+	q = math.Min(1, math.Max(0, q))
+	pos := q * float64(len(vals)-1)
+	lo := int(math.Floor(pos))
+	hi := int(math.Ceil(pos))
+	return vals[lo] + (pos-float64(lo))*(vals[hi]-vals[lo])
+}
+
+// EWMA returns the exponentially weighted moving average. Count based
+// windows use a smoothing factor of 2/(Rows+1). Time based windows use
+// Duration as half-life so that irregular row spacing is respected. Bucket
+// windows use Buckets as half-life and measure row spacing in calendar
+// buckets of the collapse mode. Null values are skipped and the result
+// starts after MinPeriods values.
+func (r *Rolling) EWMA() *Float64Column {
+	res := make([]float64, len(r.vals))
+	alpha := 2 / float64(r.window.Rows+1)
+	var (
+		avg  float64
+		n    int
+		last time.Time
+	)
+	for k, v := range r.vals {
+		if !math.IsNaN(v) {
+			switch {
+			case n == 0:
+				avg = v
+			case r.window.Duration > 0:
+				dt := r.times[k].Sub(last)
+				a := 1 - math.Exp(-math.Ln2*float64(dt)/float64(r.window.Duration))
+				avg += a * (v - avg)
+			case r.window.Buckets > 0:
+				dt := r.window.Collapse.Steps(last, r.times[k], r.loc)
+				a := 1 - math.Exp(-math.Ln2*float64(dt)/float64(r.window.Buckets))
+				avg += a * (v - avg)
+			default:
+				avg += alpha * (v - avg)
+			}
+			n++
+			if r.times != nil {
+				last = r.times[k]
+			}
+		}
+		if n < r.minp || n == 0 {
+			res[k] = math.NaN()
+			continue
+		}
+		res[k] = avg
+	}
+	return r.result("ewma", res)
+}
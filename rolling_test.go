@@ -0,0 +1,207 @@
+// Copyright (c) 2020 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package blockwatch
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+var nan = math.NaN()
+
+// rollingTestSeries has irregular rows over a week with a null value.
+func rollingTestSeries(t *testing.T) *Series {
+	h := time.Hour
+	return newTestSeries(t, []Datafield{
+		{Code: "time", Type: FieldTypeDatetime},
+		{Name: "Value", Code: "value", Type: FieldTypeInt64},
+		{Code: "name", Type: FieldTypeString},
+	}, [][]interface{}{
+		{0 * h, int64(1), "a"},
+		{1 * h, int64(2), "b"},
+		{2 * h, nil, "c"},
+		{5 * h, int64(4), "d"},
+		{24 * h, int64(8), "e"},
+		{30 * h, int64(16), "f"},
+		{96 * h, int64(32), "g"}, // Monday 2020-01-06
+	})
+}
+
+func checkFloats(t *testing.T, name string, got *Float64Column, want []float64) {
+	t.Helper()
+	if len(got.Values) != len(want) {
+		t.Fatalf("%s: got %d values, want %d", name, len(got.Values), len(want))
+	}
+	for i := range want {
+		if !equalValue(got.Values[i], want[i]) {
+			t.Errorf("%s: got %v, want %v", name, got.Values, want)
+			return
+		}
+	}
+}
+
+func TestRollingRows(t *testing.T) {
+	s := rollingTestSeries(t)
+	r, err := s.Rolling("value", RollingWindow{Rows: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// MinPeriods defaults to the window size
+	checkFloats(t, "count", r.Count(), []float64{nan, nan, nan, nan, nan, 3, 3})
+	checkFloats(t, "sum", r.Sum(), []float64{nan, nan, nan, nan, nan, 28, 56})
+	checkFloats(t, "mean", r.Mean(), []float64{nan, nan, nan, nan, nan, 28.0 / 3, 56.0 / 3})
+	checkFloats(t, "std", r.Std(), []float64{nan, nan, nan, nan, nan, math.Sqrt(112.0 / 3), math.Sqrt(448.0 / 3)})
+	checkFloats(t, "min", r.Min(), []float64{nan, nan, nan, nan, nan, 4, 8})
+	checkFloats(t, "max", r.Max(), []float64{nan, nan, nan, nan, nan, 16, 32})
+	checkFloats(t, "median", r.Median(), []float64{nan, nan, nan, nan, nan, 8, 16})
+	checkFloats(t, "ewma", r.EWMA(), []float64{nan, nan, nan, 2.75, 5.375, 10.6875, 21.34375})
+
+	c := r.Sum()
+	if c.Field.Code != "value_sum" || c.Field.Name != "Value sum(3)" || c.Field.Type != FieldTypeFloat64 {
+		t.Errorf("got field %+v", c.Field)
+	}
+
+	r, err = s.Rolling("value", RollingWindow{Rows: 3, MinPeriods: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkFloats(t, "count", r.Count(), []float64{1, 2, 2, 2, 2, 3, 3})
+	checkFloats(t, "sum", r.Sum(), []float64{1, 3, 3, 6, 12, 28, 56})
+	checkFloats(t, "std", r.Std(), []float64{nan, math.Sqrt(0.5), math.Sqrt(0.5), math.Sqrt(2), math.Sqrt(8), math.Sqrt(112.0 / 3), math.Sqrt(448.0 / 3)})
+	checkFloats(t, "min", r.Min(), []float64{1, 1, 1, 2, 4, 4, 8})
+	checkFloats(t, "q25", r.Quantile(0.25), []float64{1, 1.25, 1.25, 2.5, 5, 6, 12})
+	checkFloats(t, "ewma", r.EWMA(), []float64{1, 1.5, 1.5, 2.75, 5.375, 10.6875, 21.34375})
+}
+
+func TestRollingDuration(t *testing.T) {
+	s := rollingTestSeries(t)
+	r, err := s.Rolling("value", RollingWindow{Duration: 24 * time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// windows are (t-24h, t]
+	checkFloats(t, "count", r.Count(), []float64{1, 2, 2, 3, 3, 2, 1})
+	checkFloats(t, "sum", r.Sum(), []float64{1, 3, 3, 7, 14, 24, 32})
+	checkFloats(t, "max", r.Max(), []float64{1, 2, 2, 4, 8, 16, 32})
+
+	r, err = s.Rolling("value", RollingWindow{Duration: 24 * time.Hour, MinPeriods: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkFloats(t, "count", r.Count(), []float64{nan, 2, 2, 3, 3, 2, nan})
+	checkFloats(t, "sum", r.Sum(), []float64{nan, 3, 3, 7, 14, 24, nan})
+
+	// half-life of one hour
+	r, err = s.Rolling("value", RollingWindow{Duration: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e3 := 1.5 + (1-math.Pow(2, -4))*(4-1.5)
+	e4 := e3 + (1-math.Pow(2, -19))*(8-e3)
+	e5 := e4 + (1-math.Pow(2, -6))*(16-e4)
+	e6 := e5 + (1-math.Pow(2, -66))*(32-e5)
+	checkFloats(t, "ewma", r.EWMA(), []float64{1, 1.5, 1.5, e3, e4, e5, e6})
+
+	// rows are processed in time order and returned in row order
+	rev := *s
+	rev.Data = nil
+	for i := len(s.Data) - 1; i >= 0; i-- {
+		rev.Data = append(rev.Data, s.Data[i])
+	}
+	r, err = rev.Rolling("value", RollingWindow{Duration: 24 * time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkFloats(t, "reversed sum", r.Sum(), []float64{32, 24, 14, 7, 3, 3, 1})
+}
+
+func TestRollingBuckets(t *testing.T) {
+	s := rollingTestSeries(t)
+	var tests = []struct {
+		w    RollingWindow
+		loc  *time.Location
+		sum  []float64
+		ewma []float64
+	}{
+		{
+			w:   RollingWindow{Buckets: 2, Collapse: CollapseDaily},
+			sum: []float64{1, 3, 3, 7, 15, 31, 32},
+		},
+		{
+			// the last row starts a new ISO week
+			w:   RollingWindow{Buckets: 1, Collapse: CollapseWeekly},
+			sum: []float64{1, 3, 3, 7, 15, 31, 32},
+		},
+		{
+			// days start at 05:00 UTC
+			w:   RollingWindow{Buckets: 1, Collapse: CollapseDaily},
+			loc: time.FixedZone("EST", -5*3600),
+			sum: []float64{1, 3, 3, 4, 12, 16, 32},
+			// half-life of one day, steps counted in local days
+			ewma: []float64{1, 1, 1, 2.5, 2.5, 9.25, 9.25 + 0.75*(32-9.25)},
+		},
+		{
+			w:    RollingWindow{Buckets: 1, Collapse: CollapseDaily},
+			ewma: []float64{1, 1, 1, 1, 4.5, 4.5, 4.5 + 0.875*27.5},
+		},
+	}
+	for _, test := range tests {
+		r, err := s.RollingIn("value", test.w, test.loc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if test.sum != nil {
+			checkFloats(t, test.w.String()+" sum", r.Sum(), test.sum)
+		}
+		if test.ewma != nil {
+			checkFloats(t, test.w.String()+" ewma", r.EWMA(), test.ewma)
+		}
+	}
+
+	// the series collapse mode is the default
+	s.Collapse = CollapseDaily
+	r, err := s.Rolling("value", RollingWindow{Buckets: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkFloats(t, "series collapse sum", r.Sum(), tests[0].sum)
+	s.Collapse = CollapseNone
+	if _, err := s.Rolling("value", RollingWindow{Buckets: 2}); err == nil {
+		t.Error("expected error for bucket window without collapse mode")
+	}
+}
+
+func TestRollingErrors(t *testing.T) {
+	s := rollingTestSeries(t)
+	for _, w := range []RollingWindow{
+		{},
+		{Rows: 2, Duration: time.Hour},
+		{Buckets: 2},
+	} {
+		if _, err := s.Dataframe.Rolling("value", w); err == nil {
+			t.Errorf("%+v: expected invalid window error", w)
+		}
+	}
+	if _, err := s.Rolling("nope", RollingWindow{Rows: 2}); err == nil {
+		t.Error("expected missing column error")
+	}
+	if _, err := s.Rolling("name", RollingWindow{Rows: 2}); err == nil {
+		t.Error("expected unsupported type error")
+	}
+	df := NewDataframe(Datafield{Code: "value", Type: FieldTypeFloat64})
+	for _, v := range []float64{1, 2, 3} {
+		if err := df.Append(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := df.Rolling("value", RollingWindow{Duration: time.Hour}); err == nil {
+		t.Error("expected missing time column error")
+	}
+	r, err := df.Rolling("value", RollingWindow{Rows: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkFloats(t, "no time sum", r.Sum(), []float64{nan, 3, 5})
+}
@@ -7,6 +7,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/url"
 	"strconv"
 	"strings"
@@ -21,6 +22,7 @@ type Series struct {
 	EndDate   time.Time    `json:"end_date"`
 	Limit     int          `json:"limit"`
 	Count     int          `json:"count"`
+	Cursor    string       `json:"cursor"`
 	Error     *Error       `json:"error"`
 }
 
@@ -34,6 +36,7 @@ func (s *Series) UnmarshalJSON(data []byte) error {
 		End      int64        `json:"end_date"`
 		Limit    int          `json:"limit"`
 		Count    int          `json:"count"`
+		Cursor   string       `json:"cursor"`
 		Error    *Error       `json:"error"`
 	}{}
 	if err := json.Unmarshal(data, &series); err != nil {
@@ -46,43 +49,160 @@ func (s *Series) UnmarshalJSON(data []byte) error {
 	s.EndDate = time.Unix(0, series.End*1000000).UTC()
 	s.Limit = series.Limit
 	s.Count = series.Count
+	s.Cursor = series.Cursor
 	s.Error = series.Error
 	return nil
 }
 
 type SeriesParams struct {
-	Columns   []string
-	Collapse  CollapseMode
-	Order     OrderMode
-	StartDate time.Time
-	EndDate   time.Time
-	Limit     int
-	Format    string
-	Filter    []*Filter
+	Columns   []string     `json:"columns,omitempty"`
+	Collapse  CollapseMode `json:"collapse,omitempty"`
+	Order     OrderMode    `json:"order,omitempty"`
+	StartDate time.Time    `json:"start_date,omitempty"`
+	EndDate   time.Time    `json:"end_date,omitempty"`
+	Limit     int          `json:"limit,omitempty"`
+	Cursor    string       `json:"cursor,omitempty"`
+	Format    string       `json:"format,omitempty"`
+	Filter    []*Filter    `json:"filter,omitempty"`
+}
+
+// ParseSeriesParams is the inverse of SeriesParams.Query. It rebuilds series
+// query parameters from URL query values. All keys other than columns,
+// collapse, order, start_date, end_date, cursor and limit are parsed as
+// filters. Because url.Values does not keep the order of keys, filters on
+// different columns are returned sorted by key, use UnmarshalText to keep
+// their order. Format is not part of a URL query and must be set separately.
+func ParseSeriesParams(q url.Values) (SeriesParams, error) {
+	return parseSeriesQuery(sortedQueryList(q))
+}
+
+func parseSeriesQuery(q queryList) (SeriesParams, error) {
+	p := SeriesParams{}
+	for _, kv := range q {
+		k, v := kv[0], kv[1]
+		var err error
+		switch k {
+		case "columns":
+			if v != "" {
+				p.Columns = append(p.Columns, strings.Split(v, ",")...)
+			}
+		case "collapse":
+			p.Collapse, err = ParseCollapseMode(v)
+		case "order":
+			p.Order, err = ParseOrderMode(v)
+		case "start_date":
+			p.StartDate, err = parseTimeValue(v)
+		case "end_date":
+			p.EndDate, err = parseTimeValue(v)
+		case "cursor":
+			p.Cursor = v
+		case "limit":
+			p.Limit, err = strconv.Atoi(v)
+			if err != nil {
+				err = fmt.Errorf("invalid limit '%s': %v", v, err)
+			}
+		default:
+			var f *Filter
+			f, err = ParseFilter(k, v)
+			if err == nil {
+				p.Filter = append(p.Filter, f)
+			}
+		}
+		if err != nil {
+			return p, err
+		}
+	}
+	return p, nil
+}
+
+// MarshalText encodes params as URL query string with filters in their
+// original order. Encoders that use encoding.TextMarshaler, like most YAML
+// packages, store params in this form.
+func (p SeriesParams) MarshalText() ([]byte, error) {
+	return []byte(p.query().Encode()), nil
+}
+
+func (p *SeriesParams) UnmarshalText(data []byte) error {
+	q, err := parseQueryList(string(data))
+	if err != nil {
+		return err
+	}
+	pp, err := parseSeriesQuery(q)
+	if err != nil {
+		return err
+	}
+	*p = pp
+	return nil
+}
+
+// MarshalJSON encodes params as JSON object. Without it params would be
+// encoded as query string because they implement encoding.TextMarshaler.
+// Zero dates are omitted.
+func (p SeriesParams) MarshalJSON() ([]byte, error) {
+	type alias SeriesParams
+	v := struct {
+		alias
+		StartDate *time.Time `json:"start_date,omitempty"`
+		EndDate   *time.Time `json:"end_date,omitempty"`
+	}{
+		alias: alias(p),
+	}
+	if !p.StartDate.IsZero() {
+		v.StartDate = &p.StartDate
+	}
+	if !p.EndDate.IsZero() {
+		v.EndDate = &p.EndDate
+	}
+	return json.Marshal(v)
+}
+
+// UnmarshalJSON accepts both, a JSON object and a query string.
+func (p *SeriesParams) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		return p.UnmarshalText([]byte(s))
+	}
+	type alias SeriesParams
+	var a alias
+	if err := json.Unmarshal(data, &a); err != nil {
+		return err
+	}
+	*p = SeriesParams(a)
+	return nil
 }
 
 func (p SeriesParams) Query() url.Values {
-	q := url.Values{}
+	return p.query().Values()
+}
+
+func (p SeriesParams) query() queryList {
+	q := make(queryList, 0)
 	if len(p.Columns) > 0 && p.Columns[0] != "" {
 		q.Add("columns", strings.Join(p.Columns, ","))
 	}
 	if p.Collapse.IsValid() {
 		q.Add("collapse", p.Collapse.String())
 	}
+	if p.Cursor != "" {
+		q.Add("cursor", p.Cursor)
+	}
 	if p.Order.IsValid() {
 		q.Add("order", p.Order.String())
 	}
 	if !p.StartDate.IsZero() {
-		q.Add("start_date", p.StartDate.Format(time.RFC3339))
+		q.Add("start_date", p.StartDate.UTC().Format(time.RFC3339Nano))
 	}
 	if !p.EndDate.IsZero() {
-		q.Add("end_date", p.EndDate.Format(time.RFC3339))
+		q.Add("end_date", p.EndDate.UTC().Format(time.RFC3339Nano))
 	}
 	for _, v := range p.Filter {
 		if v == nil {
 			continue
 		}
-		v.AppendQuery(q)
+		q.Add(v.queryKey(), v.Value)
 	}
 	if p.Limit > 0 {
 		q.Add("limit", strconv.Itoa(p.Limit))
@@ -90,6 +210,38 @@ func (p SeriesParams) Query() url.Values {
 	return q
 }
 
+// resolveCursor translates a synthetic cursor into a time range that
+// continues right after the last row of the previous result. Other cursors
+// are sent to the API unchanged.
+func (p SeriesParams) resolveCursor() SeriesParams {
+	ts, order, ok := parseSeriesCursor(p.Cursor)
+	if !ok {
+		return p
+	}
+	p.Cursor = ""
+	// timestamps have millisecond precision, so the next row is at least
+	// one millisecond after or before the last row
+	switch order {
+	case OrderAsc:
+		start := ts.Add(time.Millisecond)
+		if p.Collapse.HasStep() {
+			// continue at the next calendar aligned bucket
+			start = p.Collapse.Next(ts)
+		}
+		if start.After(p.StartDate) {
+			p.StartDate = start
+		}
+	case OrderDesc:
+		if end := ts.Add(-time.Millisecond); p.EndDate.IsZero() || end.Before(p.EndDate) {
+			p.EndDate = end
+		}
+	}
+	if !p.Order.IsValid() {
+		p.Order = order
+	}
+	return p
+}
+
 func (p SeriesParams) Url(db, set string) string {
 	if p.Format == "" {
 		p.Format = "json"
@@ -98,19 +250,140 @@ func (p SeriesParams) Url(db, set string) string {
 		db,
 		set,
 		p.Format,
-		p.Query().Encode(),
+		p.resolveCursor().query().Encode(),
 	)
 }
 
+// GetSeries fetches time-series rows. With Format set to FormatCSV the
+// response is requested as CSV and parsed with column types from cached
+// dataset metadata, series properties are taken from params.
 func (c *Client) GetSeries(ctx context.Context, dbcode, setcode string, params SeriesParams) (*Series, error) {
+	if c.validate {
+		if err := c.ValidateSeriesParams(ctx, dbcode, setcode, params); err != nil {
+			return nil, err
+		}
+	}
 	v := &Series{}
-	err := c.Get(ctx, params.Url(dbcode, setcode), nil, v)
-	if err != nil {
+	if params.Format == FormatCSV {
+		t, err := c.getCSV(ctx, params.Url(dbcode, setcode), dbcode, setcode)
+		if err != nil {
+			return nil, err
+		}
+		v = &Series{
+			Dataframe: *t,
+			Collapse:  params.Collapse,
+			Order:     params.Order,
+			StartDate: params.StartDate,
+			EndDate:   params.EndDate,
+			Limit:     params.Limit,
+			Count:     len(t.Data),
+		}
+	} else if err := c.Get(ctx, params.Url(dbcode, setcode), nil, v); err != nil {
 		return nil, err
 	}
 	// process streaming error
 	if v.Error != nil {
 		return v, v.Error
 	}
+	// synthesize a cursor when the API does not provide one
+	if v.Cursor == "" {
+		v.Cursor = v.makeCursor(params)
+	}
 	return v, nil
 }
+
+// GetSeriesRaw writes the unparsed response of a series query in
+// params.Format to w, e.g. to save CSV files. w is closed after the response
+// has been copied when it implements io.WriteCloser.
+func (c *Client) GetSeriesRaw(ctx context.Context, dbcode, setcode string, params SeriesParams, w io.Writer) error {
+	if c.validate {
+		if err := c.ValidateSeriesParams(ctx, dbcode, setcode, params); err != nil {
+			return err
+		}
+	}
+	return c.Get(ctx, params.Url(dbcode, setcode), formatHeaders(params.Format), w)
+}
+
+// StreamSeries fetches series rows as CSV and calls fn for each row while
+// the response is read. params.Format is ignored.
+func (c *Client) StreamSeries(ctx context.Context, dbcode, setcode string, params SeriesParams, fn func(r Row) error) error {
+	if c.validate {
+		if err := c.ValidateSeriesParams(ctx, dbcode, setcode, params); err != nil {
+			return err
+		}
+	}
+	params.Format = FormatCSV
+	return c.streamCSV(ctx, params.Url(dbcode, setcode), dbcode, setcode, fn)
+}
+
+// Synthetic series cursors encode order and timestamp of the last row in a
+// result. SeriesParams.Url translates them into start_date or end_date so
+// that series can be paged just like tables. Query keeps them unchanged, so
+// params still round trip through ParseSeriesParams.
+const seriesCursorPrefix = "time:"
+
+func makeSeriesCursor(ts time.Time, order OrderMode) string {
+	return seriesCursorPrefix + order.String() + ":" + strconv.FormatInt(ts.UnixMilli(), 10)
+}
+
+func parseSeriesCursor(s string) (time.Time, OrderMode, bool) {
+	if !strings.HasPrefix(s, seriesCursorPrefix) {
+		return time.Time{}, OrderInvalid, false
+	}
+	fields := strings.Split(strings.TrimPrefix(s, seriesCursorPrefix), ":")
+	if len(fields) != 2 {
+		return time.Time{}, OrderInvalid, false
+	}
+	order, err := ParseOrderMode(fields[0])
+	if err != nil {
+		return time.Time{}, OrderInvalid, false
+	}
+	ms, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return time.Time{}, OrderInvalid, false
+	}
+	return time.UnixMilli(ms).UTC(), order, true
+}
+
+// makeCursor returns a synthetic cursor pointing past the last row when the
+// result was truncated at the limit. Results with less rows than the limit
+// are complete and get no cursor. When the limit is unknown a cursor is
+// returned for every non-empty result.
+func (s *Series) makeCursor(params SeriesParams) string {
+	limit := s.Limit
+	if limit <= 0 {
+		limit = params.Limit
+	}
+	if len(s.Data) == 0 || limit > 0 && len(s.Data) < limit {
+		return ""
+	}
+	ts, err := s.LastTime()
+	if err != nil {
+		return ""
+	}
+	order := s.Order
+	if !order.IsValid() {
+		order = params.Order
+	}
+	if !order.IsValid() {
+		order = OrderDesc
+	}
+	return makeSeriesCursor(ts, order)
+}
+
+// TimeColumn returns the index of the series time column.
+func (s *Series) TimeColumn() int {
+	return s.timeColumn()
+}
+
+// LastTime returns the timestamp of the last row in a series.
+func (s *Series) LastTime() (time.Time, error) {
+	col := s.TimeColumn()
+	if col < 0 {
+		return time.Time{}, fmt.Errorf("blockwatch: missing time column")
+	}
+	if len(s.Data) == 0 {
+		return time.Time{}, fmt.Errorf("blockwatch: empty series")
+	}
+	return s.decodeTimeAt(col, len(s.Data)-1, s.Columns[col].Code)
+}
@@ -0,0 +1,187 @@
+// Copyright (c) 2020 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package blockwatch
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestSeriesCursor(t *testing.T) {
+	var tests = []struct {
+		ts    time.Time
+		order OrderMode
+		want  string
+	}{
+		{time.Unix(1577934245, 6000000), OrderAsc, "time:asc:1577934245006"},
+		{time.Unix(1577934245, 6999999), OrderDesc, "time:desc:1577934245006"},
+		{time.Unix(0, 0), OrderAsc, "time:asc:0"},
+		// before 1970 sub-millisecond parts are truncated towards the past
+		{time.Unix(-1, 500000), OrderAsc, "time:asc:-1000"},
+		{time.Unix(-2, 999999999), OrderDesc, "time:desc:-1001"},
+	}
+	for _, test := range tests {
+		c := makeSeriesCursor(test.ts, test.order)
+		if c != test.want {
+			t.Errorf("%s: got %s, want %s", test.ts, c, test.want)
+		}
+		ts, order, ok := parseSeriesCursor(c)
+		if !ok || order != test.order || !ts.Equal(time.UnixMilli(test.ts.UnixMilli())) {
+			t.Errorf("%s: parsed %s %s %t", c, ts, order, ok)
+		}
+	}
+	for _, c := range []string{"", "abc", "time:", "time:asc", "time:x:1", "time:asc:x", "time:asc:1:2"} {
+		if _, _, ok := parseSeriesCursor(c); ok {
+			t.Errorf("%q: parsed as synthetic cursor", c)
+		}
+	}
+}
+
+func TestResolveCursor(t *testing.T) {
+	ts := time.Date(2020, 1, 2, 10, 0, 0, 0, time.UTC)
+	later := ts.Add(24 * time.Hour)
+	earlier := ts.Add(-24 * time.Hour)
+	var tests = []struct {
+		name string
+		in   SeriesParams
+		want SeriesParams
+	}{
+		{
+			name: "api cursor",
+			in:   SeriesParams{Cursor: "abc", StartDate: ts},
+			want: SeriesParams{Cursor: "abc", StartDate: ts},
+		},
+		{
+			name: "asc",
+			in:   SeriesParams{Cursor: makeSeriesCursor(ts, OrderAsc), StartDate: earlier},
+			want: SeriesParams{Order: OrderAsc, StartDate: ts.Add(time.Millisecond)},
+		},
+		{
+			name: "asc keeps later start",
+			in:   SeriesParams{Cursor: makeSeriesCursor(ts, OrderAsc), StartDate: later},
+			want: SeriesParams{Order: OrderAsc, StartDate: later},
+		},
+		{
+			name: "asc collapse",
+			in:   SeriesParams{Cursor: makeSeriesCursor(ts, OrderAsc), Collapse: CollapseOneHour},
+			want: SeriesParams{Order: OrderAsc, Collapse: CollapseOneHour, StartDate: ts.Add(time.Hour)},
+		},
+		{
+			name: "desc",
+			in:   SeriesParams{Cursor: makeSeriesCursor(ts, OrderDesc), StartDate: earlier},
+			want: SeriesParams{Order: OrderDesc, StartDate: earlier, EndDate: ts.Add(-time.Millisecond)},
+		},
+		{
+			name: "desc keeps earlier end",
+			in:   SeriesParams{Cursor: makeSeriesCursor(ts, OrderDesc), EndDate: earlier},
+			want: SeriesParams{Order: OrderDesc, EndDate: earlier},
+		},
+		{
+			name: "explicit order",
+			in:   SeriesParams{Cursor: makeSeriesCursor(ts, OrderDesc), Order: OrderAsc},
+			want: SeriesParams{Order: OrderAsc, EndDate: ts.Add(-time.Millisecond)},
+		},
+	}
+	for _, test := range tests {
+		got := test.in.resolveCursor()
+		if got.Cursor != test.want.Cursor || got.Order != test.want.Order || got.Collapse != test.want.Collapse ||
+			!got.StartDate.Equal(test.want.StartDate) || !got.EndDate.Equal(test.want.EndDate) {
+			t.Errorf("%s: got %+v, want %+v", test.name, got, test.want)
+		}
+		// Query keeps the cursor, Url resolves it
+		if q := test.in.Query(); q.Get("cursor") != test.in.Cursor {
+			t.Errorf("%s: query cursor %q, want %q", test.name, q.Get("cursor"), test.in.Cursor)
+		}
+		if u, want := test.in.Url("BTC", "BLOCK"), got.Url("BTC", "BLOCK"); u != want {
+			t.Errorf("%s: url %s, want %s", test.name, u, want)
+		}
+	}
+}
+
+func TestMakeCursor(t *testing.T) {
+	ts := time.Date(2020, 1, 2, 10, 0, 0, 0, time.UTC)
+	series := func(n, limit int, order OrderMode) *Series {
+		df := NewDataframe(
+			Datafield{Code: "value", Type: FieldTypeFloat64},
+			Datafield{Code: "time", Type: FieldTypeDatetime},
+		)
+		for i := 0; i < n; i++ {
+			if err := df.Append(float64(i), ts.Add(time.Duration(i)*time.Hour)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return &Series{Dataframe: *df, Limit: limit, Order: order}
+	}
+	last := ts.Add(2 * time.Hour)
+	var tests = []struct {
+		name   string
+		s      *Series
+		params SeriesParams
+		want   string
+	}{
+		{"empty", series(0, 0, OrderAsc), SeriesParams{}, ""},
+		{"complete", series(3, 5, OrderAsc), SeriesParams{}, ""},
+		{"complete by params", series(3, 0, OrderAsc), SeriesParams{Limit: 5}, ""},
+		{"truncated", series(3, 3, OrderAsc), SeriesParams{}, makeSeriesCursor(last, OrderAsc)},
+		{"truncated by params", series(3, 0, OrderAsc), SeriesParams{Limit: 3}, makeSeriesCursor(last, OrderAsc)},
+		{"unknown limit", series(3, 0, OrderAsc), SeriesParams{}, makeSeriesCursor(last, OrderAsc)},
+		{"order from params", series(3, 0, OrderInvalid), SeriesParams{Order: OrderAsc}, makeSeriesCursor(last, OrderAsc)},
+		{"default order", series(3, 0, OrderInvalid), SeriesParams{}, makeSeriesCursor(last, OrderDesc)},
+	}
+	for _, test := range tests {
+		if got := test.s.makeCursor(test.params); got != test.want {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+	}
+
+	// without time column there is no cursor
+	df := NewDataframe(Datafield{Code: "value", Type: FieldTypeFloat64})
+	if err := df.Append(1.0); err != nil {
+		t.Fatal(err)
+	}
+	if c := (&Series{Dataframe: *df}).makeCursor(SeriesParams{}); c != "" {
+		t.Errorf("got cursor %q without time column", c)
+	}
+}
+
+func TestGetSeriesPaging(t *testing.T) {
+	t0 := time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC).UnixMilli()
+	var starts []string
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("cursor") != "" {
+			t.Errorf("synthetic cursor sent to API: %s", r.URL)
+		}
+		starts = append(starts, q.Get("start_date"))
+		// the server returns two hourly rows from start_date
+		ts := t0
+		if s := q.Get("start_date"); s != "" {
+			d, err := time.Parse(time.RFC3339Nano, s)
+			if err != nil {
+				t.Error(err)
+			}
+			ts = d.UnixMilli()
+		}
+		fmt.Fprintf(w, `{"columns":[{"code":"time","type":"datetime"}],"data":[[%d],[%d]],"order":"asc","limit":2}`,
+			ts, ts+3600000)
+	})
+	params := SeriesParams{Collapse: CollapseOneHour, Order: OrderAsc, Limit: 2}
+	for i := 0; i < 3; i++ {
+		s, err := c.GetSeries(context.Background(), "BTC", "BLOCK", params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s.Cursor == "" {
+			t.Fatal("missing cursor on truncated result")
+		}
+		params.Cursor = s.Cursor
+	}
+	want := []string{"", "2020-01-02T02:00:00Z", "2020-01-02T04:00:00Z"}
+	if fmt.Sprint(starts) != fmt.Sprint(want) {
+		t.Errorf("got start dates %v, want %v", starts, want)
+	}
+}
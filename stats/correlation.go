@@ -0,0 +1,148 @@
+// Copyright (c) 2020 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package stats
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"blockwatch.cc/blockwatch-go"
+)
+
+// Matrix is a symmetric matrix of pairwise statistics between series.
+// Labels are the series names.
+type Matrix struct {
+	Labels []string    `json:"labels"`
+	Values [][]float64 `json:"values"`
+}
+
+// At returns the value for the series with labels a and b, or NaN when a
+// label is unknown.
+func (m *Matrix) At(a, b string) float64 {
+	i, j := m.index(a), m.index(b)
+	if i < 0 || j < 0 {
+		return math.NaN()
+	}
+	return m.Values[i][j]
+}
+
+func (m *Matrix) index(label string) int {
+	for i, l := range m.Labels {
+		if l == label {
+			return i
+		}
+	}
+	return -1
+}
+
+// Dataframe returns the matrix as a dataframe with a label column and one
+// float64 column per series, e.g. for printing or exporting.
+func (m *Matrix) Dataframe() (*blockwatch.Dataframe, error) {
+	fields := make([]blockwatch.Datafield, 0, len(m.Labels)+1)
+	fields = append(fields, blockwatch.Datafield{Name: "Series", Code: "series", Type: blockwatch.FieldTypeString})
+	for _, l := range m.Labels {
+		fields = append(fields, blockwatch.Datafield{Name: l, Code: l, Type: blockwatch.FieldTypeFloat64})
+	}
+	t := blockwatch.NewDataframe(fields...)
+	row := make([]interface{}, len(fields))
+	for i, l := range m.Labels {
+		row[0] = l
+		for j, v := range m.Values[i] {
+			row[j+1] = v
+		}
+		if err := t.Append(row...); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+// Covariance returns the sample covariance matrix of series values, e.g.
+// returns. Pairs are matched by timestamp and rows where either value is NaN
+// are skipped, so each entry uses all rows both series have in common. Pairs
+// with less than two common rows are NaN.
+func Covariance(series ...*Series) (*Matrix, error) {
+	return pairwise(series, false)
+}
+
+// Correlation returns the Pearson correlation matrix of series values with
+// the same pairwise handling of gaps as Covariance.
+func Correlation(series ...*Series) (*Matrix, error) {
+	return pairwise(series, true)
+}
+
+func pairwise(series []*Series, corr bool) (*Matrix, error) {
+	if len(series) == 0 {
+		return nil, fmt.Errorf("stats: at least one series is required")
+	}
+	m := &Matrix{
+		Labels: make([]string, len(series)),
+		Values: make([][]float64, len(series)),
+	}
+	index := make([]map[time.Time]int, len(series))
+	for i, s := range series {
+		m.Labels[i] = s.Name
+		if m.Labels[i] == "" {
+			m.Labels[i] = strconv.Itoa(i)
+		}
+		if m.index(m.Labels[i]) < i {
+			return nil, fmt.Errorf("stats: duplicate series name '%s'", m.Labels[i])
+		}
+		index[i] = make(map[time.Time]int, len(s.Times))
+		for k, t := range s.Times {
+			index[i][t.UTC()] = k
+		}
+		m.Values[i] = make([]float64, len(series))
+	}
+	for i, a := range series {
+		for j := i; j < len(series); j++ {
+			b := series[j]
+			x := make([]float64, 0, len(a.Values))
+			y := make([]float64, 0, len(a.Values))
+			for k, t := range a.Times {
+				l, ok := index[j][t.UTC()]
+				if !ok || math.IsNaN(a.Values[k]) || math.IsNaN(b.Values[l]) {
+					continue
+				}
+				x = append(x, a.Values[k])
+				y = append(y, b.Values[l])
+			}
+			v := covariance(x, y, corr)
+			m.Values[i][j], m.Values[j][i] = v, v
+		}
+	}
+	return m, nil
+}
+
+// covariance returns the sample covariance or the correlation of two
+// vectors of equal length.
+func covariance(x, y []float64, corr bool) float64 {
+	n := len(x)
+	if n < 2 {
+		return math.NaN()
+	}
+	var mx, my float64
+	for i := range x {
+		mx += x[i]
+		my += y[i]
+	}
+	mx /= float64(n)
+	my /= float64(n)
+	var sxy, sxx, syy float64
+	for i := range x {
+		dx, dy := x[i]-mx, y[i]-my
+		sxy += dx * dy
+		sxx += dx * dx
+		syy += dy * dy
+	}
+	if !corr {
+		return sxy / float64(n-1)
+	}
+	if sxx == 0 || syy == 0 {
+		return math.NaN()
+	}
+	return sxy / math.Sqrt(sxx*syy)
+}
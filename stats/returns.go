@@ -0,0 +1,177 @@
+// Copyright (c) 2020 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package stats
+
+import (
+	"math"
+	"time"
+)
+
+// ReturnKind selects simple or logarithmic returns.
+type ReturnKind int
+
+const (
+	SimpleReturn ReturnKind = iota // p1/p0 - 1
+	LogReturn                      // ln(p1/p0)
+)
+
+func (k ReturnKind) String() string {
+	switch k {
+	case SimpleReturn:
+		return "simple"
+	case LogReturn:
+		return "log"
+	default:
+		return "invalid"
+	}
+}
+
+// ReturnSeries holds returns for each row of a price series. The first row
+// and rows without a valid return are NaN. Periods is the number of collapse
+// periods each return spans, or zero for NaN returns.
+type ReturnSeries struct {
+	Series
+	Kind    ReturnKind
+	Periods []int
+}
+
+// Returns computes period returns from a price series. Gaps are handled as
+// defined by mode. Returns from non-positive prices are NaN.
+func (s *Series) Returns(kind ReturnKind, mode GapMode) *ReturnSeries {
+	r := &ReturnSeries{
+		Series:  *s.derive(),
+		Kind:    kind,
+		Periods: make([]int, len(s.Values)),
+	}
+	last := -1
+	for i, v := range s.Values {
+		if math.IsNaN(v) {
+			continue
+		}
+		if last >= 0 {
+			k := s.periods(s.Times[last], s.Times[i])
+			if k < 1 {
+				k = 1
+			}
+			p := s.Values[last]
+			if (mode != GapNull || (last == i-1 && k == 1)) && p > 0 && v > 0 {
+				if kind == LogReturn {
+					r.Values[i] = math.Log(v / p)
+				} else {
+					r.Values[i] = v/p - 1
+				}
+				r.Periods[i] = k
+			}
+		}
+		last = i
+	}
+	return r
+}
+
+// Wealth returns the growth of one unit invested at the first row. NaN
+// returns leave wealth unchanged.
+func (r *ReturnSeries) Wealth() *Series {
+	res := r.derive()
+	w := 1.0
+	for i, v := range r.Values {
+		if !math.IsNaN(v) {
+			if r.Kind == LogReturn {
+				w *= math.Exp(v)
+			} else {
+				w *= 1 + v
+			}
+		}
+		res.Values[i] = w
+	}
+	return res
+}
+
+// Cumulative returns the compounded return since the first row. Log returns
+// are summed, so cumulative log returns stay in log space. Returns lost to
+// gaps with GapNull are not included.
+func (r *ReturnSeries) Cumulative() *Series {
+	res := r.derive()
+	var c float64
+	for i, v := range r.Values {
+		if !math.IsNaN(v) {
+			if r.Kind == LogReturn {
+				c += v
+			} else {
+				c = (1+c)*(1+v) - 1
+			}
+		}
+		res.Values[i] = c
+	}
+	return res
+}
+
+// Drawdown returns the relative decline of each value from the running
+// maximum, e.g. -0.25 for a price 25% below its previous high. Use it on
+// prices or on ReturnSeries.Wealth. NaN values stay NaN.
+func (s *Series) Drawdown() *Series {
+	res := s.derive()
+	peak := math.NaN()
+	for i, v := range s.Values {
+		if math.IsNaN(v) {
+			continue
+		}
+		if math.IsNaN(peak) || v > peak {
+			peak = v
+		}
+		if peak > 0 {
+			res.Values[i] = v/peak - 1
+		}
+	}
+	return res
+}
+
+// Drawdown describes the largest decline of a series. Depth is the relative
+// decline from Peak to Trough and is zero or negative. Recovery is the first
+// time the series reached the peak value again, or zero when it did not
+// recover.
+type Drawdown struct {
+	Depth    float64   `json:"depth"`
+	Peak     time.Time `json:"peak"`
+	Trough   time.Time `json:"trough"`
+	Recovery time.Time `json:"recovery"`
+}
+
+// Duration returns the time from peak to recovery, or zero when the series
+// did not recover.
+func (d Drawdown) Duration() time.Duration {
+	if d.Recovery.IsZero() {
+		return 0
+	}
+	return d.Recovery.Sub(d.Peak)
+}
+
+// MaxDrawdown returns the largest drawdown of a series.
+func (s *Series) MaxDrawdown() Drawdown {
+	var (
+		dd   Drawdown
+		peak = -1 // row of the running maximum
+		best = -1 // peak row of the largest drawdown
+	)
+	for i, v := range s.Values {
+		if math.IsNaN(v) {
+			continue
+		}
+		if peak < 0 || v >= s.Values[peak] {
+			if best >= 0 && dd.Recovery.IsZero() && best == peak && v >= s.Values[best] {
+				dd.Recovery = s.Times[i]
+			}
+			peak = i
+			continue
+		}
+		if p := s.Values[peak]; p > 0 && v/p-1 < dd.Depth {
+			dd = Drawdown{
+				Depth:  v/p - 1,
+				Peak:   s.Times[peak],
+				Trough: s.Times[i],
+			}
+			best = peak
+		}
+	}
+	return dd
+}
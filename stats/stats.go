@@ -0,0 +1,192 @@
+// Copyright (c) 2020 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+// Package stats implements return, drawdown, volatility and correlation
+// statistics on numeric time-series columns.
+//
+// Statistics work on Series values which hold timestamps, float64 values and
+// the collapse mode of the source data. Null values are represented as NaN.
+// Missing collapse buckets and null values are gaps. How returns treat gaps
+// is selected explicitly with a GapMode. Volatility is annualized from the
+// collapse mode assuming markets that trade around the clock.
+package stats
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"blockwatch.cc/blockwatch-go"
+)
+
+// Series is a numeric time series in chronological order.
+type Series struct {
+	Name     string
+	Collapse blockwatch.CollapseMode
+	Times    []time.Time
+	Values   []float64
+}
+
+// FromSeries extracts a numeric column from a series. Rows are returned in
+// chronological order and null values become NaN.
+func FromSeries(s *blockwatch.Series, col string) (*Series, error) {
+	tc := s.TimeColumn()
+	if tc < 0 {
+		return nil, fmt.Errorf("stats: missing time column")
+	}
+	times, err := s.ColumnValues(s.Columns[tc].Code)
+	if err != nil {
+		return nil, err
+	}
+	vals, err := s.ColumnValues(col)
+	if err != nil {
+		return nil, err
+	}
+	res := &Series{
+		Name:     col,
+		Collapse: s.Collapse,
+		Times:    make([]time.Time, len(times)),
+		Values:   make([]float64, len(vals)),
+	}
+	for i, v := range times {
+		t, ok := v.(time.Time)
+		if !ok {
+			return nil, fmt.Errorf("stats: null time at row %d", i)
+		}
+		res.Times[i] = t
+	}
+	for i, v := range vals {
+		switch x := v.(type) {
+		case nil:
+			res.Values[i] = math.NaN()
+		case float64:
+			res.Values[i] = x
+		case int64:
+			res.Values[i] = float64(x)
+		case uint64:
+			res.Values[i] = float64(x)
+		default:
+			return nil, fmt.Errorf("stats: column '%s' is not numeric", col)
+		}
+	}
+	if !sort.IsSorted(res) {
+		sort.Stable(res)
+	}
+	return res, nil
+}
+
+// FromDataframe extracts a numeric column from a dataframe with a time
+// column, e.g. the result of blockwatch.AlignSeries. collapse is the bucket
+// size of the data.
+func FromDataframe(t *blockwatch.Dataframe, col string, collapse blockwatch.CollapseMode) (*Series, error) {
+	return FromSeries(&blockwatch.Series{Dataframe: *t, Collapse: collapse}, col)
+}
+
+// Len, Less and Swap implement sort.Interface to order rows by time.
+func (s *Series) Len() int           { return len(s.Times) }
+func (s *Series) Less(i, j int) bool { return s.Times[i].Before(s.Times[j]) }
+func (s *Series) Swap(i, j int) {
+	s.Times[i], s.Times[j] = s.Times[j], s.Times[i]
+	s.Values[i], s.Values[j] = s.Values[j], s.Values[i]
+}
+
+// derive returns an empty series with the same name, collapse mode and
+// times as s.
+func (s *Series) derive() *Series {
+	res := &Series{
+		Name:     s.Name,
+		Collapse: s.Collapse,
+		Times:    s.Times,
+		Values:   make([]float64, len(s.Values)),
+	}
+	for i := range res.Values {
+		res.Values[i] = math.NaN()
+	}
+	return res
+}
+
+// Valid returns the number of non-NaN values.
+func (s *Series) Valid() int {
+	var n int
+	for _, v := range s.Values {
+		if !math.IsNaN(v) {
+			n++
+		}
+	}
+	return n
+}
+
+// periods returns the number of collapse buckets between two timestamps.
+// Modes without step count every row as one period.
+func (s *Series) periods(from, to time.Time) int {
+	m := s.Collapse
+	if !m.HasStep() {
+		return 1
+	}
+	return m.Steps(from, to, from.Location())
+}
+
+// PeriodsPerYear returns the number of collapse buckets per year. Modes
+// without step estimate the frequency from the average row spacing.
+func (s *Series) PeriodsPerYear() float64 {
+	if s.Collapse.HasStep() {
+		return PeriodsPerYear(s.Collapse)
+	}
+	n := len(s.Times)
+	if n < 2 {
+		return math.NaN()
+	}
+	span := s.Times[n-1].Sub(s.Times[0])
+	if span <= 0 {
+		return math.NaN()
+	}
+	return float64(n-1) * float64(year) / float64(span)
+}
+
+// year is the average Gregorian calendar year.
+const year = time.Duration(365.2425 * 24 * float64(time.Hour))
+
+// PeriodsPerYear returns the number of collapse buckets in an average
+// calendar year, e.g. 365.2425 for daily and 12 for monthly data. Markets are
+// assumed to trade around the clock. Modes without step return NaN.
+func PeriodsPerYear(m blockwatch.CollapseMode) float64 {
+	switch m {
+	case blockwatch.CollapseMonthly:
+		return 12
+	case blockwatch.CollapseQuarterly:
+		return 4
+	case blockwatch.CollapseAnnual:
+		return 1
+	}
+	if !m.HasStep() {
+		return math.NaN()
+	}
+	return float64(year) / float64(m.Duration())
+}
+
+// GapMode defines how returns are computed across gaps, i.e. missing
+// collapse buckets and null values.
+type GapMode int
+
+const (
+	// GapSpan computes returns from the last valid value across gaps. Such
+	// returns span multiple periods and are scaled by the square root of the
+	// number of periods when estimating volatility.
+	GapSpan GapMode = iota
+
+	// GapNull sets returns adjacent to a gap to NaN so that every return
+	// covers exactly one period.
+	GapNull
+)
+
+func (m GapMode) String() string {
+	switch m {
+	case GapSpan:
+		return "span"
+	case GapNull:
+		return "null"
+	default:
+		return "invalid"
+	}
+}
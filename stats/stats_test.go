@@ -0,0 +1,263 @@
+// Copyright (c) 2020 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package stats
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"blockwatch.cc/blockwatch-go"
+)
+
+var day0 = time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)
+
+func days(n ...int) []time.Time {
+	res := make([]time.Time, len(n))
+	for i, d := range n {
+		res[i] = day0.AddDate(0, 0, d)
+	}
+	return res
+}
+
+func near(a, b float64) bool {
+	return math.IsNaN(a) && math.IsNaN(b) || math.Abs(a-b) <= 1e-9*math.Max(1, math.Abs(b))
+}
+
+func checkValues(t *testing.T, name string, got, want []float64) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("%s: got %d values, want %d", name, len(got), len(want))
+	}
+	for i := range want {
+		if !near(got[i], want[i]) {
+			t.Errorf("%s: got %v, want %v", name, got, want)
+			return
+		}
+	}
+}
+
+func TestPeriodsPerYear(t *testing.T) {
+	var tests = []struct {
+		mode blockwatch.CollapseMode
+		want float64
+	}{
+		{blockwatch.CollapseOneMinute, 525949.2},
+		{blockwatch.CollapseFiveMinutes, 105189.84},
+		{blockwatch.CollapseOneHour, 8765.82},
+		{blockwatch.CollapseTwelveHours, 730.485},
+		{blockwatch.CollapseDaily, 365.2425},
+		{blockwatch.CollapseWeekly, 52.1775},
+		{blockwatch.CollapseMonthly, 12},
+		{blockwatch.CollapseQuarterly, 4},
+		{blockwatch.CollapseAnnual, 1},
+		{blockwatch.CollapseThirtyMinutes, 17531.64},
+		{blockwatch.CollapseNone, math.NaN()},
+	}
+	for _, test := range tests {
+		if got := PeriodsPerYear(test.mode); !near(got, test.want) {
+			t.Errorf("%s: got %v, want %v", test.mode, got, test.want)
+		}
+	}
+
+	// without step the frequency follows the row spacing
+	s := &Series{Collapse: blockwatch.CollapseNone, Times: []time.Time{day0, day0.Add(12 * time.Hour), day0.Add(24 * time.Hour)}}
+	if got := s.PeriodsPerYear(); !near(got, 730.485) {
+		t.Errorf("row spacing: got %v, want 730.485", got)
+	}
+	s.Times = s.Times[:1]
+	if got := s.PeriodsPerYear(); !math.IsNaN(got) {
+		t.Errorf("single row: got %v, want NaN", got)
+	}
+
+	if got := AnnualizeVolatility(0.01, blockwatch.CollapseDaily); !near(got, 0.01*math.Sqrt(365.2425)) {
+		t.Errorf("annualize: got %v", got)
+	}
+	if got := ScaleVolatility(0.8, blockwatch.CollapseAnnual, blockwatch.CollapseMonthly); !near(got, 0.8/math.Sqrt(12)) {
+		t.Errorf("scale: got %v", got)
+	}
+}
+
+// gapSeries has daily prices with a null value and a missing day.
+func gapSeries() *Series {
+	return &Series{
+		Name:     "price",
+		Collapse: blockwatch.CollapseDaily,
+		Times:    days(0, 1, 2, 4, 5),
+		Values:   []float64{100, 110, math.NaN(), 99, 108.9},
+	}
+}
+
+func TestReturns(t *testing.T) {
+	nan := math.NaN()
+	s := gapSeries()
+
+	// the return into day 4 spans three days
+	r := s.Returns(SimpleReturn, GapSpan)
+	checkValues(t, "span", r.Values, []float64{nan, 0.1, nan, -0.1, 0.1})
+	if want := []int{0, 1, 0, 3, 1}; len(r.Periods) != 5 || r.Periods[3] != want[3] || r.Periods[1] != 1 || r.Periods[0] != 0 {
+		t.Errorf("span periods: got %v, want %v", r.Periods, want)
+	}
+	checkValues(t, "wealth", r.Wealth().Values, []float64{1, 1.1, 1.1, 0.99, 1.089})
+	checkValues(t, "cumulative", r.Cumulative().Values, []float64{0, 0.1, 0.1, -0.01, 0.089})
+
+	// single period returns are unscaled, the three day return is divided
+	// by sqrt(3)
+	x := []float64{0.1, -0.1 / math.Sqrt(3), 0.1}
+	mean := (x[0] + x[1] + x[2]) / 3
+	var ss float64
+	for _, v := range x {
+		ss += (v - mean) * (v - mean)
+	}
+	want := math.Sqrt(ss/2) * math.Sqrt(365.2425)
+	if got := r.RealizedVolatility(); !near(got, want) {
+		t.Errorf("span volatility: got %v, want %v", got, want)
+	}
+	checkValues(t, "rolling volatility", r.Volatility(4).Values, []float64{nan, nan, nan, nan, want})
+
+	r = s.Returns(SimpleReturn, GapNull)
+	checkValues(t, "null", r.Values, []float64{nan, 0.1, nan, nan, 0.1})
+	if got := r.RealizedVolatility(); got != 0 {
+		t.Errorf("null volatility: got %v, want 0", got)
+	}
+
+	r = s.Returns(LogReturn, GapSpan)
+	checkValues(t, "log", r.Values, []float64{nan, math.Log(1.1), nan, math.Log(0.9), math.Log(1.1)})
+	checkValues(t, "log wealth", r.Wealth().Values, []float64{1, 1.1, 1.1, 0.99, 1.089})
+	checkValues(t, "log cumulative", r.Cumulative().Values, []float64{0, math.Log(1.1), math.Log(1.1), math.Log(0.99), math.Log(1.089)})
+
+	// non-positive prices have no return
+	s.Values = []float64{100, 0, 50, 55, -1}
+	checkValues(t, "non-positive", s.Returns(SimpleReturn, GapSpan).Values, []float64{nan, nan, nan, 0.1, nan})
+}
+
+func TestMaxDrawdown(t *testing.T) {
+	var tests = []struct {
+		name     string
+		vals     []float64
+		depth    float64
+		peak     int
+		trough   int
+		recovery int // -1 without recovery
+	}{
+		{"recovered", []float64{100, 120, 90, 60, 100, 120, 130, 80}, -0.5, 1, 3, 5},
+		{"not recovered", []float64{100, 50, math.NaN(), 80}, -0.5, 0, 1, -1},
+		{"deeper after recovery", []float64{100, 90, 100, 50}, -0.5, 2, 3, -1},
+		{"rising", []float64{1, 2, 3}, 0, -1, -1, -1},
+	}
+	for _, test := range tests {
+		n := make([]int, len(test.vals))
+		for i := range n {
+			n[i] = i
+		}
+		s := &Series{Collapse: blockwatch.CollapseDaily, Times: days(n...), Values: test.vals}
+		dd := s.MaxDrawdown()
+		at := func(i int) time.Time {
+			if i < 0 {
+				return time.Time{}
+			}
+			return s.Times[i]
+		}
+		if !near(dd.Depth, test.depth) || !dd.Peak.Equal(at(test.peak)) || !dd.Trough.Equal(at(test.trough)) || !dd.Recovery.Equal(at(test.recovery)) {
+			t.Errorf("%s: got %+v", test.name, dd)
+		}
+		if want := at(test.recovery).Sub(at(test.peak)); test.recovery >= 0 && dd.Duration() != want {
+			t.Errorf("%s: got duration %v, want %v", test.name, dd.Duration(), want)
+		}
+		if test.recovery < 0 && dd.Duration() != 0 {
+			t.Errorf("%s: got duration %v without recovery", test.name, dd.Duration())
+		}
+	}
+
+	s := &Series{Times: days(0, 1, 2), Values: []float64{100, 120, 90}}
+	checkValues(t, "drawdown", s.Drawdown().Values, []float64{0, 0, -0.25})
+}
+
+func TestCorrelation(t *testing.T) {
+	nan := math.NaN()
+	a := &Series{Name: "a", Times: days(0, 1, 2, 3, 4), Values: []float64{1, 2, 3, 4, 5}}
+	// matched by timestamp, the NaN row is skipped
+	b := &Series{Name: "b", Times: days(1, 2, 3, 4, 5), Values: []float64{2, 4, 6, nan, 10}}
+	c := &Series{Name: "c", Times: days(0, 1, 2, 3, 4), Values: []float64{5, 4, 3, 2, 1}}
+	d := &Series{Times: days(4, 9), Values: []float64{1, 2}}
+
+	corr, err := Correlation(a, b, c, d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cov, err := Covariance(a, b, c, d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tests = []struct {
+		x, y      string
+		corr, cov float64
+	}{
+		{"a", "a", 1, 2.5},
+		{"a", "b", 1, 2},
+		{"b", "a", 1, 2},
+		{"a", "c", -1, -2.5},
+		{"b", "c", -1, -2},
+		{"b", "b", 1, 35.0 / 3},
+		// a single common row has no covariance
+		{"a", "3", nan, nan},
+		{"3", "3", 1, 0.5},
+		{"a", "x", nan, nan},
+	}
+	for _, test := range tests {
+		if got := corr.At(test.x, test.y); !near(got, test.corr) {
+			t.Errorf("corr(%s, %s): got %v, want %v", test.x, test.y, got, test.corr)
+		}
+		if got := cov.At(test.x, test.y); !near(got, test.cov) {
+			t.Errorf("cov(%s, %s): got %v, want %v", test.x, test.y, got, test.cov)
+		}
+	}
+
+	df, err := corr.Dataframe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(df.Data) != 4 || len(df.Columns) != 5 || df.Columns[4].Code != "3" {
+		t.Errorf("got dataframe %+v", df.Columns)
+	}
+	if v, err := df.FieldAt(3, 1); err != nil || v != -1.0 {
+		t.Errorf("got %v %v", v, err)
+	}
+
+	if _, err := Correlation(); err == nil {
+		t.Error("expected error without series")
+	}
+	if _, err := Correlation(a, &Series{Name: "a"}); err == nil {
+		t.Error("expected error for duplicate names")
+	}
+}
+
+func TestFromSeries(t *testing.T) {
+	df := blockwatch.NewDataframe(
+		blockwatch.Datafield{Code: "time", Type: blockwatch.FieldTypeDatetime},
+		blockwatch.Datafield{Code: "v", Type: blockwatch.FieldTypeInt64},
+		blockwatch.Datafield{Code: "s", Type: blockwatch.FieldTypeString},
+	)
+	for _, r := range [][]interface{}{
+		{day0.AddDate(0, 0, 2), int64(3), "c"},
+		{day0, nil, "a"},
+		{day0.AddDate(0, 0, 1), int64(2), "b"},
+	} {
+		if err := df.Append(r...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s, err := FromDataframe(df, "v", blockwatch.CollapseDaily)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// rows are sorted by time, nulls become NaN
+	checkValues(t, "values", s.Values, []float64{math.NaN(), 2, 3})
+	if !s.Times[0].Equal(day0) || s.Name != "v" || s.Collapse != blockwatch.CollapseDaily || s.Valid() != 2 {
+		t.Errorf("got %+v", s)
+	}
+	if _, err := FromDataframe(df, "s", blockwatch.CollapseDaily); err == nil {
+		t.Error("expected error for string column")
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright (c) 2020 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package stats
+
+import (
+	"math"
+
+	"blockwatch.cc/blockwatch-go"
+)
+
+// normalized returns the return at row i scaled to a single period and
+// whether it is valid.
+func (r *ReturnSeries) normalized(i int) (float64, bool) {
+	v := r.Values[i]
+	if math.IsNaN(v) || r.Periods[i] < 1 {
+		return 0, false
+	}
+	if r.Periods[i] > 1 {
+		v /= math.Sqrt(float64(r.Periods[i]))
+	}
+	return v, true
+}
+
+// Volatility returns the annualized rolling standard deviation of returns
+// over the last window rows. Rows are NaN until window rows are available
+// and when the window contains less than two valid returns.
+func (r *ReturnSeries) Volatility(window int) *Series {
+	res := r.derive()
+	if window < 2 {
+		return res
+	}
+	scale := math.Sqrt(r.PeriodsPerYear())
+	var n int
+	var sum, sum2 float64
+	for i := range r.Values {
+		if v, ok := r.normalized(i); ok {
+			n++
+			sum += v
+			sum2 += v * v
+		}
+		if i >= window {
+			if v, ok := r.normalized(i - window); ok {
+				n--
+				sum -= v
+				sum2 -= v * v
+			}
+		}
+		if i < window || n < 2 {
+			continue
+		}
+		mean := sum / float64(n)
+		variance := math.Max(0, (sum2-float64(n)*mean*mean)/float64(n-1))
+		res.Values[i] = math.Sqrt(variance) * scale
+	}
+	return res
+}
+
+// RealizedVolatility returns the annualized sample standard deviation of all
+// valid returns, or NaN with less than two valid returns.
+func (r *ReturnSeries) RealizedVolatility() float64 {
+	vals := make([]float64, 0, len(r.Values))
+	for i := range r.Values {
+		if v, ok := r.normalized(i); ok {
+			vals = append(vals, v)
+		}
+	}
+	if len(vals) < 2 {
+		return math.NaN()
+	}
+	var mean, sum2 float64
+	for _, v := range vals {
+		mean += v
+	}
+	mean /= float64(len(vals))
+	for _, v := range vals {
+		sum2 += (v - mean) * (v - mean)
+	}
+	return math.Sqrt(sum2/float64(len(vals)-1)) * math.Sqrt(r.PeriodsPerYear())
+}
+
+// AnnualizeVolatility scales a per-period standard deviation of returns at
+// collapse mode m to one year.
+func AnnualizeVolatility(std float64, m blockwatch.CollapseMode) float64 {
+	return std * math.Sqrt(PeriodsPerYear(m))
+}
+
+// ScaleVolatility converts a volatility from one horizon to another, e.g.
+// from annual to daily with ScaleVolatility(v, CollapseAnnual, CollapseDaily).
+func ScaleVolatility(vol float64, from, to blockwatch.CollapseMode) float64 {
+	return vol * math.Sqrt(PeriodsPerYear(from)/PeriodsPerYear(to))
+}
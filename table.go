@@ -5,7 +5,9 @@ package blockwatch
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"net/url"
 	"strconv"
 	"strings"
@@ -20,15 +22,102 @@ type Table struct {
 }
 
 type TableParams struct {
-	Columns []string
-	Cursor  string
-	Limit   int
-	Filter  []*Filter
-	Format  string
+	Columns []string  `json:"columns,omitempty"`
+	Cursor  string    `json:"cursor,omitempty"`
+	Limit   int       `json:"limit,omitempty"`
+	Filter  []*Filter `json:"filter,omitempty"`
+	Format  string    `json:"format,omitempty"`
+}
+
+// ParseTableParams is the inverse of TableParams.Query. It rebuilds table
+// query parameters from URL query values. All keys other than columns, cursor
+// and limit are parsed as filters. Because url.Values does not keep the order
+// of keys, filters on different columns are returned sorted by key, use
+// UnmarshalText to keep their order. Format is not part of a URL query and
+// must be set separately.
+func ParseTableParams(q url.Values) (TableParams, error) {
+	return parseTableQuery(sortedQueryList(q))
+}
+
+func parseTableQuery(q queryList) (TableParams, error) {
+	p := TableParams{}
+	for _, kv := range q {
+		k, v := kv[0], kv[1]
+		switch k {
+		case "columns":
+			if v != "" {
+				p.Columns = append(p.Columns, strings.Split(v, ",")...)
+			}
+		case "cursor":
+			p.Cursor = v
+		case "limit":
+			l, err := strconv.Atoi(v)
+			if err != nil {
+				return p, fmt.Errorf("invalid limit '%s': %v", v, err)
+			}
+			p.Limit = l
+		default:
+			f, err := ParseFilter(k, v)
+			if err != nil {
+				return p, err
+			}
+			p.Filter = append(p.Filter, f)
+		}
+	}
+	return p, nil
+}
+
+// MarshalText encodes params as URL query string with filters in their
+// original order. Encoders that use encoding.TextMarshaler, like most YAML
+// packages, store params in this form.
+func (p TableParams) MarshalText() ([]byte, error) {
+	return []byte(p.query().Encode()), nil
+}
+
+func (p *TableParams) UnmarshalText(data []byte) error {
+	q, err := parseQueryList(string(data))
+	if err != nil {
+		return err
+	}
+	pp, err := parseTableQuery(q)
+	if err != nil {
+		return err
+	}
+	*p = pp
+	return nil
+}
+
+// MarshalJSON encodes params as JSON object. Without it params would be
+// encoded as query string because they implement encoding.TextMarshaler.
+func (p TableParams) MarshalJSON() ([]byte, error) {
+	type alias TableParams
+	return json.Marshal(alias(p))
+}
+
+// UnmarshalJSON accepts both, a JSON object and a query string.
+func (p *TableParams) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		return p.UnmarshalText([]byte(s))
+	}
+	type alias TableParams
+	var a alias
+	if err := json.Unmarshal(data, &a); err != nil {
+		return err
+	}
+	*p = TableParams(a)
+	return nil
 }
 
 func (p TableParams) Query() url.Values {
-	q := url.Values{}
+	return p.query().Values()
+}
+
+func (p TableParams) query() queryList {
+	q := make(queryList, 0)
 	if len(p.Columns) > 0 && p.Columns[0] != "" {
 		q.Add("columns", strings.Join(p.Columns, ","))
 	}
@@ -36,7 +125,7 @@ func (p TableParams) Query() url.Values {
 		if v == nil {
 			continue
 		}
-		v.AppendQuery(q)
+		q.Add(v.queryKey(), v.Value)
 	}
 	if p.Cursor != "" {
 		q.Add("cursor", p.Cursor)
@@ -55,11 +144,30 @@ func (p TableParams) Url(db, set string) string {
 		db,
 		set,
 		p.Format,
-		p.Query().Encode(),
+		p.query().Encode(),
 	)
 }
 
+// GetTable fetches table rows. With Format set to FormatCSV the response is
+// requested as CSV and parsed with column types from cached dataset metadata.
+// CSV responses carry no cursor, so table iterators fetch JSON pages instead.
 func (c *Client) GetTable(ctx context.Context, dbcode, setcode string, params TableParams) (*Table, error) {
+	if c.validate {
+		if err := c.ValidateTableParams(ctx, dbcode, setcode, params); err != nil {
+			return nil, err
+		}
+	}
+	if params.Format == FormatCSV {
+		t, err := c.getCSV(ctx, params.Url(dbcode, setcode), dbcode, setcode)
+		if err != nil {
+			return nil, err
+		}
+		return &Table{
+			Dataframe: *t,
+			Limit:     params.Limit,
+			Count:     len(t.Data),
+		}, nil
+	}
 	v := &Table{}
 	err := c.Get(ctx, params.Url(dbcode, setcode), nil, v)
 	if err != nil {
@@ -72,10 +180,27 @@ func (c *Client) GetTable(ctx context.Context, dbcode, setcode string, params Ta
 	return v, nil
 }
 
-// TODO
-// func (c *Client) StreamTable(ctx context.Context, params TableParams, fn func(r Row) error) error {
-//  // slower, but from stdlib
-//  // https://stackoverflow.com/questions/31794355/stream-large-json
-//  // fetch chunks, stream-decode them and loop until limit is reached
-// 	return nil
-// }
+// GetTableRaw writes the unparsed response of a table query in params.Format
+// to w, e.g. to save CSV files. w is closed after the response has been
+// copied when it implements io.WriteCloser.
+func (c *Client) GetTableRaw(ctx context.Context, dbcode, setcode string, params TableParams, w io.Writer) error {
+	if c.validate {
+		if err := c.ValidateTableParams(ctx, dbcode, setcode, params); err != nil {
+			return err
+		}
+	}
+	return c.Get(ctx, params.Url(dbcode, setcode), formatHeaders(params.Format), w)
+}
+
+// StreamTable fetches table rows as CSV and calls fn for each row while the
+// response is read, so large results are never held in memory at once.
+// params.Format is ignored.
+func (c *Client) StreamTable(ctx context.Context, dbcode, setcode string, params TableParams, fn func(r Row) error) error {
+	if c.validate {
+		if err := c.ValidateTableParams(ctx, dbcode, setcode, params); err != nil {
+			return err
+		}
+	}
+	params.Format = FormatCSV
+	return c.streamCSV(ctx, params.Url(dbcode, setcode), dbcode, setcode, fn)
+}
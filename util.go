@@ -5,22 +5,136 @@ package blockwatch
 
 import (
 	"bytes"
+	"net/url"
+	"sort"
+	"strings"
 )
 
 func indexByteColumnN(b []byte, sep byte, n int) (int, int) {
 	var start int
 	// find the n-th start offset
 	for ; start != -1 && n > 0; n-- {
-		n := bytes.IndexByte(b[start:], sep)
+		n := indexByteUnquoted(b[start:], sep)
 		if n == -1 {
 			return -1, 0
 		}
 		start += n + 1
 	}
 	// find the next offset
-	end := bytes.IndexByte(b[start:], sep)
+	end := indexByteUnquoted(b[start:], sep)
 	if end < 0 {
 		return start, len(b) + 1
 	}
 	return start, end + start
 }
+
+// indexByteUnquoted works like bytes.IndexByte, but skips over JSON strings
+// so that separators inside string values are ignored.
+func indexByteUnquoted(b []byte, sep byte) int {
+	// fast path for values without strings
+	i := bytes.IndexByte(b, sep)
+	if i < 0 || bytes.IndexByte(b[:i], '"') < 0 {
+		return i
+	}
+	var quoted bool
+	for i := 0; i < len(b); i++ {
+		switch c := b[i]; {
+		case quoted && c == '\\':
+			i++
+		case c == '"':
+			quoted = !quoted
+		case !quoted && c == sep:
+			return i
+		}
+	}
+	return -1
+}
+
+// splitColumns splits a JSON array body into columns, separators inside
+// string values are ignored.
+func splitColumns(b []byte, sep byte) [][]byte {
+	cols := make([][]byte, 0)
+	for {
+		i := indexByteUnquoted(b, sep)
+		if i < 0 {
+			return append(cols, b)
+		}
+		cols = append(cols, b[:i])
+		b = b[i+1:]
+	}
+}
+
+// queryList is a list of URL query parameters. Unlike url.Values it keeps
+// the order in which parameters were added, so that encoded params list
+// filters in their original order.
+type queryList [][2]string
+
+func (l *queryList) Add(key, value string) {
+	*l = append(*l, [2]string{key, value})
+}
+
+// Values returns the parameters as url.Values. Values of the same key keep
+// their order.
+func (l queryList) Values() url.Values {
+	q := url.Values{}
+	for _, v := range l {
+		q.Add(v[0], v[1])
+	}
+	return q
+}
+
+// Encode encodes parameters in URL query format without sorting keys.
+func (l queryList) Encode() string {
+	var b strings.Builder
+	for i, v := range l {
+		if i > 0 {
+			b.WriteByte('&')
+		}
+		b.WriteString(url.QueryEscape(v[0]))
+		b.WriteByte('=')
+		b.WriteString(url.QueryEscape(v[1]))
+	}
+	return b.String()
+}
+
+// parseQueryList parses a URL query string and keeps the order of
+// parameters.
+func parseQueryList(s string) (queryList, error) {
+	l := make(queryList, 0)
+	for _, kv := range strings.Split(s, "&") {
+		if kv == "" {
+			continue
+		}
+		k, v := kv, ""
+		if i := strings.IndexByte(kv, '='); i >= 0 {
+			k, v = kv[:i], kv[i+1:]
+		}
+		key, err := url.QueryUnescape(k)
+		if err != nil {
+			return nil, err
+		}
+		val, err := url.QueryUnescape(v)
+		if err != nil {
+			return nil, err
+		}
+		l.Add(key, val)
+	}
+	return l, nil
+}
+
+// sortedQueryList returns url.Values as query list sorted by key. Values of
+// the same key keep their order.
+func sortedQueryList(q url.Values) queryList {
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	l := make(queryList, 0, len(q))
+	for _, k := range keys {
+		for _, v := range q[k] {
+			l.Add(k, v)
+		}
+	}
+	return l
+}
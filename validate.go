@@ -0,0 +1,289 @@
+// Copyright (c) 2020 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package blockwatch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	DatasetTypeTable  = "table"
+	DatasetTypeSeries = "series"
+)
+
+// ValidationError is returned when a query parameter does not match the
+// dataset metadata. Param names the offending query parameter (e.g. columns,
+// filter, collapse), Field the offending column if any.
+type ValidationError struct {
+	Dataset string
+	Param   string
+	Field   string
+	Value   string
+	Reason  string
+}
+
+func (e *ValidationError) Error() string {
+	s := fmt.Sprintf("blockwatch: invalid parameter '%s'", e.Param)
+	if e.Field != "" {
+		s += fmt.Sprintf(" column '%s'", e.Field)
+	}
+	if e.Value != "" {
+		s += fmt.Sprintf(" value '%s'", e.Value)
+	}
+	if e.Dataset != "" {
+		s += fmt.Sprintf(" for dataset %s", e.Dataset)
+	}
+	return s + ": " + e.Reason
+}
+
+// ValidationErrors is a list of all validation failures found in a single
+// set of query parameters.
+type ValidationErrors []*ValidationError
+
+func (e ValidationErrors) Error() string {
+	switch len(e) {
+	case 0:
+		return ""
+	case 1:
+		return e[0].Error()
+	default:
+		s := make([]string, len(e))
+		for i, v := range e {
+			s[i] = v.Error()
+		}
+		return strings.Join(s, "; ")
+	}
+}
+
+// IsValidationError returns all validation failures when err is or wraps
+// ValidationErrors or a single *ValidationError.
+func IsValidationError(err error) (ValidationErrors, bool) {
+	var errs ValidationErrors
+	if errors.As(err, &errs) {
+		return errs, true
+	}
+	var e *ValidationError
+	if errors.As(err, &e) {
+		return ValidationErrors{e}, true
+	}
+	return nil, false
+}
+
+// EnableValidation turns pre-flight validation of TableParams and SeriesParams
+// on or off. When enabled, GetTable and GetSeries check params against cached
+// dataset metadata and fail with ValidationErrors before sending a request.
+func (c *Client) EnableValidation(enable bool) {
+	c.validate = enable
+}
+
+// CachedDataset returns dataset metadata from the client's cache and fetches
+// it from the API on first use.
+func (c *Client) CachedDataset(ctx context.Context, dbcode, setcode string) (*Dataset, error) {
+	key := dbcode + "/" + setcode
+	c.metaLock.RLock()
+	set, ok := c.meta[key]
+	c.metaLock.RUnlock()
+	if ok {
+		return set, nil
+	}
+	set, err := c.GetDataset(ctx, dbcode, setcode)
+	if err != nil {
+		return nil, err
+	}
+	c.metaLock.Lock()
+	c.meta[key] = set
+	c.metaLock.Unlock()
+	return set, nil
+}
+
+// PurgeDatasetCache removes all cached dataset metadata.
+func (c *Client) PurgeDatasetCache() {
+	c.metaLock.Lock()
+	c.meta = make(map[string]*Dataset)
+	c.metaLock.Unlock()
+}
+
+func (c *Client) ValidateTableParams(ctx context.Context, dbcode, setcode string, params TableParams) error {
+	set, err := c.CachedDataset(ctx, dbcode, setcode)
+	if err != nil {
+		return err
+	}
+	return set.ValidateTableParams(params)
+}
+
+func (c *Client) ValidateSeriesParams(ctx context.Context, dbcode, setcode string, params SeriesParams) error {
+	set, err := c.CachedDataset(ctx, dbcode, setcode)
+	if err != nil {
+		return err
+	}
+	return set.ValidateSeriesParams(params)
+}
+
+// ValidateTableParams checks table query parameters against dataset metadata.
+func (d *Dataset) ValidateTableParams(p TableParams) error {
+	var errs ValidationErrors
+	if d.Type != "" && !strings.EqualFold(d.Type, DatasetTypeTable) {
+		errs = append(errs, d.newError("dataset", "", d.Type, "dataset is not a table"))
+	}
+	errs = append(errs, d.validateColumns(p.Columns)...)
+	errs = append(errs, d.validateFilters(p.Filter)...)
+	if p.Limit < 0 {
+		errs = append(errs, d.newError("limit", "", strconv.Itoa(p.Limit), "limit must not be negative"))
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// ValidateSeriesParams checks time-series query parameters against dataset
+// metadata.
+func (d *Dataset) ValidateSeriesParams(p SeriesParams) error {
+	var errs ValidationErrors
+	if d.Type != "" && !strings.EqualFold(d.Type, DatasetTypeSeries) {
+		reason := "dataset is not a time-series"
+		if p.Collapse.IsValid() && p.Collapse != CollapseNone {
+			errs = append(errs, d.newError("collapse", "", p.Collapse.String(), reason))
+		} else {
+			errs = append(errs, d.newError("dataset", "", d.Type, reason))
+		}
+	}
+	errs = append(errs, d.validateColumns(p.Columns)...)
+	errs = append(errs, d.validateFilters(p.Filter)...)
+	if p.Limit < 0 {
+		errs = append(errs, d.newError("limit", "", strconv.Itoa(p.Limit), "limit must not be negative"))
+	}
+	if !p.StartDate.IsZero() && !p.EndDate.IsZero() && p.EndDate.Before(p.StartDate) {
+		errs = append(errs, d.newError("end_date", "", p.EndDate.String(), "end date is before start date"))
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func (d *Dataset) column(code string) (Datafield, bool) {
+	for _, v := range d.Columns {
+		if v.Code == code {
+			return v, true
+		}
+	}
+	return Datafield{}, false
+}
+
+func (d *Dataset) isFilterable(code string) bool {
+	for _, v := range d.FilterFields {
+		if v == code {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *Dataset) newError(param, field, value, reason string) *ValidationError {
+	var code string
+	if d.Database != "" || d.Dataset != "" {
+		code = d.Database + "/" + d.Dataset
+	}
+	return &ValidationError{
+		Dataset: code,
+		Param:   param,
+		Field:   field,
+		Value:   value,
+		Reason:  reason,
+	}
+}
+
+func (d *Dataset) validateColumns(cols []string) ValidationErrors {
+	var errs ValidationErrors
+	for _, v := range cols {
+		if v == "" {
+			continue
+		}
+		if _, ok := d.column(v); !ok {
+			errs = append(errs, d.newError("columns", v, "", "unknown column"))
+		}
+	}
+	return errs
+}
+
+func (d *Dataset) validateFilters(filters []*Filter) ValidationErrors {
+	var errs ValidationErrors
+	for _, f := range filters {
+		if f == nil {
+			continue
+		}
+		field, ok := d.column(f.Field)
+		switch true {
+		case !ok:
+			errs = append(errs, d.newError("filter", f.Field, f.Value, "unknown column"))
+		case !d.isFilterable(f.Field):
+			errs = append(errs, d.newError("filter", f.Field, f.Value, "column is not filterable"))
+		case f.Mode < FilterModeEqual || f.Mode >= FilterModeInvalid:
+			errs = append(errs, d.newError("filter", f.Field, f.Value, "invalid filter mode"))
+		default:
+			if err := validateFilterValue(field.Type, f); err != nil {
+				errs = append(errs, d.newError("filter", f.Field, f.Value, err.Error()))
+			}
+		}
+	}
+	return errs
+}
+
+// validateFilterValue checks whether a filter mode is supported by a column
+// type and whether the filter value can be parsed as the column type.
+func validateFilterValue(typ FieldType, f *Filter) error {
+	switch f.Mode {
+	case FilterModeRegexp:
+		if typ != FieldTypeString {
+			return fmt.Errorf("mode %s is unsupported on %s columns", f.Mode, typ)
+		}
+		return nil
+	case FilterModeGt, FilterModeGte, FilterModeLt, FilterModeLte, FilterModeRange:
+		if typ == FieldTypeBoolean || typ == FieldTypeBytes {
+			return fmt.Errorf("mode %s is unsupported on %s columns", f.Mode, typ)
+		}
+	}
+	vals := []string{f.Value}
+	switch f.Mode {
+	case FilterModeIn, FilterModeNotIn:
+		vals = strings.Split(f.Value, ",")
+	case FilterModeRange:
+		vals = strings.Split(f.Value, ",")
+		if len(vals) != 2 {
+			return fmt.Errorf("range needs exactly two values")
+		}
+	}
+	for _, v := range vals {
+		if err := validateFieldValue(typ, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateFieldValue(typ FieldType, v string) error {
+	var err error
+	switch typ {
+	case FieldTypeInt64:
+		_, err = strconv.ParseInt(v, 10, 64)
+	case FieldTypeUint64:
+		_, err = strconv.ParseUint(v, 10, 64)
+	case FieldTypeFloat64:
+		_, err = strconv.ParseFloat(v, 64)
+	case FieldTypeBoolean:
+		_, err = strconv.ParseBool(v)
+	default:
+		// strings, bytes and time values are checked by the server
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("value '%s' is not of type %s", v, typ)
+	}
+	return nil
+}
@@ -0,0 +1,282 @@
+// Copyright (c) 2020 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package blockwatch
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestClient returns a client that sends all requests to handler.
+func newTestClient(t *testing.T, handler http.HandlerFunc) *Client {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	c, err := NewClient("test", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.baseURL, err = url.Parse(srv.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func testDataset(typ string) *Dataset {
+	return &Dataset{
+		Database: "BTC",
+		Dataset:  "BLOCK",
+		Type:     typ,
+		Columns: []Datafield{
+			{Code: "time", Type: FieldTypeDatetime},
+			{Code: "height", Type: FieldTypeUint64},
+			{Code: "hash", Type: FieldTypeBytes},
+			{Code: "is_orphan", Type: FieldTypeBoolean},
+			{Code: "name", Type: FieldTypeString},
+			{Code: "price", Type: FieldTypeFloat64},
+		},
+		FilterFields: []string{"time", "height", "is_orphan", "name", "price"},
+	}
+}
+
+// validationErrors returns param:field pairs of all validation errors.
+func validationErrors(t *testing.T, err error) []string {
+	t.Helper()
+	if err == nil {
+		return nil
+	}
+	errs, ok := IsValidationError(err)
+	if !ok {
+		t.Fatalf("unexpected error type %T: %v", err, err)
+	}
+	res := make([]string, len(errs))
+	for i, e := range errs {
+		res[i] = e.Param + ":" + e.Field
+	}
+	return res
+}
+
+func TestValidateTableParams(t *testing.T) {
+	var tests = []struct {
+		name   string
+		typ    string
+		params TableParams
+		want   []string
+	}{
+		{
+			name: "valid",
+			typ:  DatasetTypeTable,
+			params: TableParams{
+				Columns: []string{"time", "height"},
+				Filter: []*Filter{
+					NewFilter("height", FilterModeGt, "5"),
+					NewFilter("height", FilterModeIn, "1,2,3"),
+					NewFilter("price", FilterModeRange, "1.5,2"),
+					NewFilter("name", FilterModeRegexp, "^a"),
+					NewFilter("is_orphan", FilterModeEqual, "true"),
+				},
+				Limit: 10,
+			},
+		},
+		{
+			name:   "unknown column",
+			typ:    DatasetTypeTable,
+			params: TableParams{Columns: []string{"time", "nope"}},
+			want:   []string{"columns:nope"},
+		},
+		{
+			name: "filters",
+			typ:  DatasetTypeTable,
+			params: TableParams{Filter: []*Filter{
+				NewFilter("nope", FilterModeEqual, "1"),
+				NewFilter("hash", FilterModeEqual, "ab"),
+				NewFilter("height", FilterModeEqual, "abc"),
+				NewFilter("height", FilterModeRegexp, "^1"),
+				NewFilter("price", FilterModeRange, "1"),
+				NewFilter("is_orphan", FilterModeGt, "true"),
+				NewFilter("height", FilterModeInvalid, "1"),
+			}},
+			want: []string{
+				"filter:nope", "filter:hash", "filter:height", "filter:height",
+				"filter:price", "filter:is_orphan", "filter:height",
+			},
+		},
+		{
+			name:   "limit",
+			typ:    DatasetTypeTable,
+			params: TableParams{Limit: -1},
+			want:   []string{"limit:"},
+		},
+		{
+			name:   "type",
+			typ:    DatasetTypeSeries,
+			params: TableParams{Columns: []string{"nope"}},
+			want:   []string{"dataset:", "columns:nope"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := testDataset(test.typ).ValidateTableParams(test.params)
+			got := validationErrors(t, err)
+			if strings.Join(got, " ") != strings.Join(test.want, " ") {
+				t.Errorf("got %v, want %v (%v)", got, test.want, err)
+			}
+		})
+	}
+}
+
+func TestValidateSeriesParams(t *testing.T) {
+	start := time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)
+	var tests = []struct {
+		name   string
+		typ    string
+		params SeriesParams
+		want   []string
+	}{
+		{
+			name: "valid",
+			typ:  DatasetTypeSeries,
+			params: SeriesParams{
+				Columns:   []string{"time", "price"},
+				Collapse:  CollapseOneHour,
+				StartDate: start,
+				EndDate:   start.Add(time.Hour),
+				Filter:    []*Filter{NewFilter("price", FilterModeGte, "1")},
+			},
+		},
+		{
+			name:   "dates",
+			typ:    DatasetTypeSeries,
+			params: SeriesParams{StartDate: start, EndDate: start.Add(-time.Hour), Limit: -5},
+			want:   []string{"limit:", "end_date:"},
+		},
+		{
+			name:   "collapse on table",
+			typ:    DatasetTypeTable,
+			params: SeriesParams{Collapse: CollapseDaily},
+			want:   []string{"collapse:"},
+		},
+		{
+			name:   "table",
+			typ:    DatasetTypeTable,
+			params: SeriesParams{},
+			want:   []string{"dataset:"},
+		},
+		{
+			name:   "unknown type",
+			typ:    "",
+			params: SeriesParams{Filter: []*Filter{NewFilter("price", FilterModeIn, "1,x")}},
+			want:   []string{"filter:price"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := testDataset(test.typ).ValidateSeriesParams(test.params)
+			got := validationErrors(t, err)
+			if strings.Join(got, " ") != strings.Join(test.want, " ") {
+				t.Errorf("got %v, want %v (%v)", got, test.want, err)
+			}
+		})
+	}
+}
+
+func TestIsValidationError(t *testing.T) {
+	e := &ValidationError{Param: "limit", Reason: "limit must not be negative"}
+	for _, err := range []error{
+		e,
+		ValidationErrors{e},
+		fmt.Errorf("wrapped: %w", e),
+		fmt.Errorf("wrapped: %w", ValidationErrors{e}),
+	} {
+		errs, ok := IsValidationError(err)
+		if !ok || len(errs) != 1 || errs[0] != e {
+			t.Errorf("%v: got %v, %t", err, errs, ok)
+		}
+	}
+	if _, ok := IsValidationError(fmt.Errorf("other")); ok {
+		t.Error("other error detected as validation error")
+	}
+	if _, ok := IsValidationError(nil); ok {
+		t.Error("nil detected as validation error")
+	}
+}
+
+func TestCachedDataset(t *testing.T) {
+	var meta, data int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/BTC/BLOCK/metadata.json"):
+			atomic.AddInt32(&meta, 1)
+			w.Write([]byte(`{"database_code":"BTC","dataset_code":"BLOCK","type":"table",
+				"columns":[{"code":"height","type":"uint64"}],"filters":["height"]}`))
+		case strings.HasSuffix(r.URL.Path, "metadata.json"):
+			atomic.AddInt32(&meta, 1)
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			atomic.AddInt32(&data, 1)
+			w.Write([]byte(`{"columns":[{"code":"height","type":"uint64"}],"data":[[1]]}`))
+		}
+	})
+	ctx := context.Background()
+
+	// metadata is fetched once
+	for i := 0; i < 3; i++ {
+		set, err := c.CachedDataset(ctx, "BTC", "BLOCK")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(set.Columns) != 1 || set.Columns[0].Code != "height" {
+			t.Fatalf("unexpected metadata %#v", set)
+		}
+	}
+	if n := atomic.LoadInt32(&meta); n != 1 {
+		t.Errorf("fetched metadata %d times, want 1", n)
+	}
+
+	// errors are not cached
+	for i := 0; i < 2; i++ {
+		if _, err := c.CachedDataset(ctx, "BTC", "NOPE"); err == nil {
+			t.Error("expected error for missing dataset")
+		}
+	}
+	if n := atomic.LoadInt32(&meta); n != 3 {
+		t.Errorf("fetched metadata %d times, want 3", n)
+	}
+
+	// purge forces a new request
+	c.PurgeDatasetCache()
+	if _, err := c.CachedDataset(ctx, "BTC", "BLOCK"); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&meta); n != 4 {
+		t.Errorf("fetched metadata %d times, want 4", n)
+	}
+
+	// validation fails before sending the query
+	c.EnableValidation(true)
+	_, err := c.GetTable(ctx, "BTC", "BLOCK", TableParams{Columns: []string{"nope"}})
+	if errs, ok := IsValidationError(err); !ok || len(errs) != 1 || errs[0].Field != "nope" {
+		t.Errorf("got %v, want validation error", err)
+	}
+	if n := atomic.LoadInt32(&data); n != 0 {
+		t.Errorf("sent %d queries, want 0", n)
+	}
+	if _, err := c.GetTable(ctx, "BTC", "BLOCK", TableParams{Columns: []string{"height"}}); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&data); n != 1 {
+		t.Errorf("sent %d queries, want 1", n)
+	}
+	if n := atomic.LoadInt32(&meta); n != 4 {
+		t.Errorf("fetched metadata %d times, want 4", n)
+	}
+}
@@ -0,0 +1,158 @@
+// Copyright (c) 2020 Blockwatch Data Inc.
+// Author: alex@blockwatch.cc
+
+package blockwatch
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// Sort returns a view with rows sorted by one or more columns. Sorting is
+// stable, null values sort before all other values in ascending order.
+func (t *Dataframe) Sort(cols []string, asc bool) (*Dataframe, error) {
+	if err := t.initType(nil); err != nil {
+		return nil, err
+	}
+	if len(cols) == 0 {
+		return nil, fmt.Errorf("blockwatch: sort requires at least one column")
+	}
+	idx := make([]int, len(cols))
+	types := make([]FieldType, len(cols))
+	for i, name := range cols {
+		idx[i] = t.columnIndex(name)
+		if idx[i] < 0 {
+			return nil, fmt.Errorf("blockwatch: sort: missing column '%s'", name)
+		}
+		types[i] = t.Columns[idx[i]].Type
+	}
+	keys := make([][]interface{}, len(idx))
+	for i, col := range idx {
+		v, err := t.columnValues(col)
+		if err != nil {
+			return nil, err
+		}
+		keys[i] = v
+	}
+	pos := make([]int, len(t.Data))
+	for i := range pos {
+		pos[i] = i
+	}
+	sort.SliceStable(pos, func(a, b int) bool {
+		for k := range idx {
+			x, y := keys[k][pos[a]], keys[k][pos[b]]
+			var c int
+			switch {
+			case x == nil && y == nil:
+				c = 0
+			case x == nil:
+				c = -1
+			case y == nil:
+				c = 1
+			default:
+				c = compareValues(types[k], x, y)
+			}
+			if !asc {
+				c = -c
+			}
+			if c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	})
+	data := make([]json.RawMessage, len(pos))
+	for i, p := range pos {
+		data[i] = t.Data[p]
+	}
+	return t.view(data), nil
+}
+
+// Slice returns a view of rows [i, j). Bounds are clamped to the available
+// rows.
+func (t *Dataframe) Slice(i, j int) *Dataframe {
+	n := len(t.Data)
+	if i < 0 {
+		i = 0
+	}
+	if j > n {
+		j = n
+	}
+	if i >= j {
+		return t.view(nil)
+	}
+	// limit capacity so appending to the view does not overwrite rows
+	return t.view(t.Data[i:j:j])
+}
+
+// Head returns a view of the first n rows.
+func (t *Dataframe) Head(n int) *Dataframe {
+	return t.Slice(0, n)
+}
+
+// Tail returns a view of the last n rows.
+func (t *Dataframe) Tail(n int) *Dataframe {
+	return t.Slice(len(t.Data)-n, len(t.Data))
+}
+
+// Reverse returns a view with rows in reverse order.
+func (t *Dataframe) Reverse() *Dataframe {
+	data := make([]json.RawMessage, len(t.Data))
+	for i, v := range t.Data {
+		data[len(data)-1-i] = v
+	}
+	return t.view(data)
+}
+
+// Select returns a dataframe with a subset of columns in the given order.
+// Raw column values are copied without decoding.
+func (t *Dataframe) Select(cols ...string) (*Dataframe, error) {
+	if err := t.initType(nil); err != nil {
+		return nil, err
+	}
+	idx := make([]int, len(cols))
+	fields := make([]Datafield, len(cols))
+	for i, name := range cols {
+		idx[i] = t.columnIndex(name)
+		if idx[i] < 0 {
+			return nil, fmt.Errorf("blockwatch: select: missing column '%s'", name)
+		}
+		fields[i] = t.Columns[idx[i]]
+	}
+	data := make([]json.RawMessage, len(t.Data))
+	for i, row := range t.Data {
+		vals := splitColumns(row[1:len(row)-1], ',')
+		if len(vals) < len(t.Columns) {
+			return nil, makeColumnMissingError(t.Columns[len(vals)].Code, len(vals), i)
+		}
+		buf := make([]byte, 0, len(row))
+		buf = append(buf, '[')
+		for j, col := range idx {
+			if j > 0 {
+				buf = append(buf, ',')
+			}
+			buf = append(buf, vals[col]...)
+		}
+		buf = append(buf, ']')
+		data[i] = json.RawMessage(buf)
+	}
+	return &Dataframe{
+		Columns: fields,
+		Data:    data,
+	}, nil
+}
+
+// Reverse returns a view of the series with rows in reverse order and
+// flipped order mode, e.g. to turn descending results chronological.
+func (s *Series) Reverse() *Series {
+	res := *s
+	res.Dataframe = *s.Dataframe.Reverse()
+	switch s.Order {
+	case OrderAsc:
+		res.Order = OrderDesc
+	case OrderDesc:
+		res.Order = OrderAsc
+	}
+	return &res
+}